@@ -0,0 +1,91 @@
+// Copyright (c) 2016 Niklas Wolber
+// This file is licensed under the MIT license.
+// See the LICENSE file for more information.
+
+package xCUTEr
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// newAPI returns the HTTP API to control the executor.
+//
+//	GET  /jobs             lists all jobs
+//	POST /jobs/activate    activates the job given by the form value job
+//	POST /jobs/deactivate  deactivates the job
+//	POST /jobs/pause       pauses the job
+//	POST /jobs/resume      resumes the job
+//	GET  /dag              returns the dependency graph of all jobs
+//
+// Jobs are referred to by their job file, the base name of their job file or
+// their name.
+func newAPI(e *executor) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/jobs", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(e.Jobs()); err != nil {
+			log.Println("failed to encode jobs:", err)
+		}
+	})
+
+	mux.HandleFunc("/dag", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		dag, err := e.DAG()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(dag); err != nil {
+			log.Println("failed to encode dag:", err)
+		}
+	})
+
+	actions := map[string]func(file string) error{
+		"activate":   e.Activate,
+		"deactivate": e.Deactivate,
+		"pause":      e.Pause,
+		"resume":     e.Resume,
+	}
+
+	mux.HandleFunc("/jobs/", func(w http.ResponseWriter, r *http.Request) {
+		action, ok := actions[strings.TrimPrefix(r.URL.Path, "/jobs/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		file, err := e.Lookup(r.FormValue("job"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		if err := action(file); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	return mux
+}
@@ -0,0 +1,152 @@
+// Copyright (c) 2016 Niklas Wolber
+// This file is licensed under the MIT license.
+// See the LICENSE file for more information.
+
+package xCUTEr
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/nwolber/xCUTEr/job"
+)
+
+func TestAPI(t *testing.T) {
+	e, _ := newExecutor(context.TODO(), "")
+	e.manualActive = true
+	e.schedule = func(c *job.Config, f func()) (string, error) {
+		return "TEST-ID", nil
+	}
+	e.remove = func(string) {}
+
+	for _, file := range []string{"jobs/a.job", "jobs/b.job", "other/b.job"} {
+		e.Add(&jobInfo{
+			file: file,
+			c: &job.Config{
+				Name:     "Job " + file,
+				Schedule: "@hourly",
+			},
+		})
+	}
+
+	server := httptest.NewServer(newAPI(e))
+	defer server.Close()
+
+	tests := []struct {
+		action, job string
+		want        int
+	}{
+		{"activate", "a.job", http.StatusNoContent},
+		{"activate", "a.job", http.StatusConflict},
+		{"activate", "Job jobs/b.job", http.StatusNoContent},
+		{"pause", "jobs/b.job", http.StatusNoContent},
+		{"pause", "jobs/b.job", http.StatusConflict},
+		{"resume", "other/b.job", http.StatusConflict},
+		{"deactivate", "b.job", http.StatusNotFound},
+		{"deactivate", "missing.job", http.StatusNotFound},
+		{"restart", "a.job", http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		resp, err := http.PostForm(server.URL+"/jobs/"+test.action, url.Values{"job": {test.job}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		expect(t, test.action+" "+test.job, resp.StatusCode, test.want)
+	}
+
+	resp, err := http.Get(server.URL + "/jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var jobs []*JobStatus
+	if err := json.NewDecoder(resp.Body).Decode(&jobs); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []JobStatus{
+		{File: "jobs/a.job", Active: true},
+		{File: "jobs/b.job", Active: true, Paused: true},
+		{File: "other/b.job"},
+	}
+	expect(t, "jobs", len(jobs), len(want))
+	for i := 0; i < len(jobs) && i < len(want); i++ {
+		got := jobs[i]
+		if got.File != want[i].File || got.Active != want[i].Active || got.Paused != want[i].Paused {
+			t.Errorf("want %+v, got %+v", want[i], *got)
+		}
+	}
+}
+
+func TestAPIDAG(t *testing.T) {
+	e, _ := newExecutor(context.TODO(), "")
+	e.schedule = func(c *job.Config, f func()) (string, error) {
+		return "TEST-ID", nil
+	}
+
+	jobs := []*job.Config{
+		{Name: "backup", Schedule: "@daily"},
+		{Name: "cleanup", DependsOn: []*job.Dependency{{Job: "backup", Condition: job.Always}}},
+		{Name: "report", Schedule: "@hourly", DependsOn: []*job.Dependency{{Job: "import", Condition: job.OnSuccess}}},
+	}
+	for _, c := range jobs {
+		if err := e.Add(&jobInfo{file: c.Name + ".job", c: c}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	server := httptest.NewServer(newAPI(e))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/dag")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	expect(t, "status", resp.StatusCode, http.StatusOK)
+
+	var dag struct {
+		Nodes []job.DAGNode `json:"nodes"`
+		Edges []job.DAGEdge `json:"edges"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&dag); err != nil {
+		t.Fatal(err)
+	}
+
+	wantNodes := []job.DAGNode{
+		{Name: "backup", Schedule: "@daily"},
+		{Name: "cleanup", Triggered: true},
+		{Name: "report", Schedule: "@hourly"},
+	}
+	expect(t, "nodes", len(dag.Nodes), len(wantNodes))
+	for i := 0; i < len(dag.Nodes) && i < len(wantNodes); i++ {
+		if dag.Nodes[i] != wantNodes[i] {
+			t.Errorf("want node %+v, got %+v", wantNodes[i], dag.Nodes[i])
+		}
+	}
+
+	wantEdges := []job.DAGEdge{
+		{From: "backup", To: "cleanup", Condition: job.Always},
+		{From: "import", To: "report", Condition: job.OnSuccess, Unknown: true},
+	}
+	expect(t, "edges", len(dag.Edges), len(wantEdges))
+	for i := 0; i < len(dag.Edges) && i < len(wantEdges); i++ {
+		if dag.Edges[i] != wantEdges[i] {
+			t.Errorf("want edge %+v, got %+v", wantEdges[i], dag.Edges[i])
+		}
+	}
+
+	resp, err = http.PostForm(server.URL+"/dag", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	expect(t, "post", resp.StatusCode, http.StatusMethodNotAllowed)
+}
@@ -9,9 +9,12 @@ import (
 	"fmt"
 	"os"
 	"time"
+
+	"github.com/nwolber/xCUTEr/job"
+	"github.com/nwolber/xCUTEr/secrets"
 )
 
-func config() (jobDir string, sshTTL, sshKeepAlive time.Duration, file, logFile, telemetryEndpoint, perf string, once, quiet bool) {
+func config() (jobDir string, sshTTL, sshKeepAlive time.Duration, file, logFile, telemetryEndpoint, perf, api, secretsFile, secretsKey, stateFile string, maxJobs, maxSessions int, grace time.Duration, vars job.VarValues, once, quiet, manual bool) {
 	const (
 		jobDirDefault            = "."
 		sshTTLDefault            = time.Minute * 10
@@ -19,9 +22,17 @@ func config() (jobDir string, sshTTL, sshKeepAlive time.Duration, file, logFile,
 		logFileDefault           = ""
 		telemetryEndpointDefault = ""
 		defaultPerf              = ""
+		apiDefault               = ""
 		fileDefault              = ""
+		secretsFileDefault       = ""
+		secretsKeyDefault        = ""
+		stateFileDefault         = ""
+		maxJobsDefault           = 0
+		maxSessionsDefault       = 0
+		graceDefault             = time.Minute
 		onceDefault              = false
 		quietDefault             = false
+		manualDefault            = false
 	)
 
 	flag.StringVar(&jobDir, "jobs", jobDirDefault, "Directory to watch for .job files.")
@@ -32,7 +43,17 @@ func config() (jobDir string, sshTTL, sshKeepAlive time.Duration, file, logFile,
 	flag.BoolVar(&quiet, "quiet", quietDefault, "Silence xCUTEr by turning off log messages. Command output is still printed. Overwrites -log.")
 	flag.StringVar(&logFile, "log", logFileDefault, "Log file.")
 	flag.StringVar(&telemetryEndpoint, "statsd", telemetryEndpointDefault, "UDP endpoint for statsd messages (e.g. localhost:12345).")
+	flag.IntVar(&maxJobs, "maxJobs", maxJobsDefault, "Maximum number of jobs running at the same time. Further runs are queued. 0 means unlimited.")
+	flag.IntVar(&maxSessions, "maxSessions", maxSessionsDefault, "Maximum number of concurrent sessions per host across all jobs. Further commands wait. 0 means unlimited.")
+	flag.DurationVar(&grace, "grace", graceDefault, "Time running jobs get to finish on SIGTERM, before they are cancelled.")
 	flag.StringVar(&perf, "perf", defaultPerf, "Perf endpoint.")
+	flag.StringVar(&api, "api", apiDefault, "Endpoint for the HTTP API to list, activate, deactivate, pause and resume jobs (e.g. 8642 or localhost:8642), see xCtl. Binds to localhost, unless a host is given, because the API has no authentication.")
+	flag.BoolVar(&manual, "manual", manualDefault, "Jobs picked up from the job directory are only scheduled after they have been activated, see -api. Use -state to remember activated jobs across restarts.")
+	vars = make(job.VarValues)
+	flag.Var(vars, "var", "Value for a job variable in the form name=value. May be repeated. With -file the job has to declare the variable, otherwise only the jobs declaring it get the value.")
+	flag.StringVar(&secretsFile, "secrets", secretsFileDefault, "Encrypted secrets file, see xSecrets.")
+	flag.StringVar(&stateFile, "state", stateFileDefault, "File to persist the state of jobs in, e.g. their last run. Required for catching up on missed runs after a restart.")
+	flag.StringVar(&secretsKey, "secretsKey", secretsKeyDefault, "Key file for the secrets file. If omitted, the passphrase is read from "+secrets.PassphraseEnv+".")
 
 	help := flag.Bool("help", false, "Display this help")
 	config := flag.Bool("config", false, "Display current configuration")
@@ -53,6 +74,15 @@ func config() (jobDir string, sshTTL, sshKeepAlive time.Duration, file, logFile,
 		fmt.Println("log   :", logFile)
 		fmt.Println("statsd:", telemetryEndpoint)
 		fmt.Println("perf  :", perf)
+		fmt.Println("api   :", api)
+		fmt.Println("manual:", manual)
+		fmt.Println("secrets:", secretsFile)
+		fmt.Println("secretsKey:", secretsKey)
+		fmt.Println("state :", stateFile)
+		fmt.Println("maxJobs:", maxJobs)
+		fmt.Println("maxSessions:", maxSessions)
+		fmt.Println("grace :", grace)
+		fmt.Println("vars  :", vars)
 		os.Exit(0)
 	}
 
@@ -7,6 +7,7 @@ package main
 import (
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -15,10 +16,20 @@ import (
 	_ "net/http/pprof"
 
 	"github.com/nwolber/xCUTEr"
+	"github.com/nwolber/xCUTEr/job"
+	"github.com/nwolber/xCUTEr/secrets"
 )
 
 func main() {
-	jobDir, sshTTL, sshKeepAlive, file, logFile, telemetryEndpoint, perf, once, quiet := config()
+	jobDir, sshTTL, sshKeepAlive, file, logFile, telemetryEndpoint, perf, api, secretsFile, secretsKey, stateFile, maxJobs, maxSessions, grace, vars, once, quiet, manual := config()
+
+	if secretsFile != "" {
+		values, err := secrets.Load(secretsFile, secretsKey)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		job.UseSecrets(values)
+	}
 
 	if perf != "" {
 		go func() {
@@ -27,21 +38,76 @@ func main() {
 	}
 
 	signals := make(chan os.Signal, 1)
-	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
 
-	x, err := xCUTEr.New(jobDir, sshTTL, sshKeepAlive, file, logFile, telemetryEndpoint, once, quiet)
+	x, err := xCUTEr.New(xCUTEr.Options{
+		JobDir:            jobDir,
+		File:              file,
+		Once:              once,
+		SSHTTL:            sshTTL,
+		SSHKeepAlive:      sshKeepAlive,
+		LogFile:           logFile,
+		Quiet:             quiet,
+		TelemetryEndpoint: telemetryEndpoint,
+		StateFile:         stateFile,
+		Manual:            manual,
+		MaxJobs:           maxJobs,
+		MaxSessions:       maxSessions,
+		Vars:              vars,
+	})
 	if err != nil {
 		log.Fatalln(err)
 	}
+
+	if api != "" {
+		go func() {
+			log.Println(http.ListenAndServe(apiAddr(api), x.API))
+		}()
+	}
 	x.Start()
 
-	select {
-	case <-x.Done:
-	case s := <-signals:
-		fmt.Println("Got signal:", s)
-		x.Stop()
-		x.Cancel()
+loop:
+	for {
+		select {
+		case <-x.Done:
+			break loop
+		case s := <-signals:
+			if s == syscall.SIGHUP {
+				fmt.Println("Got signal:", s, "reloading jobs")
+				x.Reload()
+				continue
+			}
+
+			fmt.Println("Got signal:", s, "draining, send again to cancel immediately")
+			drained := make(chan struct{})
+			go func() {
+				x.Drain(grace)
+				close(drained)
+			}()
+
+			select {
+			case <-drained:
+			case s := <-signals:
+				fmt.Println("Got signal:", s, "cancelling")
+			}
+			x.Cancel()
+			break loop
+		}
 	}
 
 	log.Println("fin")
 }
+
+// apiAddr binds the HTTP API to localhost, unless the address contains a
+// host, because the API has no authentication.
+func apiAddr(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		// a bare port
+		host, port = "", addr
+	}
+	if host == "" {
+		host = "localhost"
+	}
+	return net.JoinHostPort(host, port)
+}
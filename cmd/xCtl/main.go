@@ -0,0 +1,149 @@
+// Copyright (c) 2016 Niklas Wolber
+// This file is licensed under the MIT license.
+// See the LICENSE file for more information.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nwolber/xCUTEr"
+)
+
+func main() {
+	log.SetFlags(0)
+	api, command, jobs := flags()
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	base := "http://" + api
+
+	switch command {
+	case "list":
+		if err := list(client, base); err != nil {
+			log.Fatalln(err)
+		}
+	case "activate", "deactivate", "pause", "resume":
+		if len(jobs) == 0 {
+			log.Fatalln(command, "requires at least one job")
+		}
+
+		failed := false
+		for _, job := range jobs {
+			if err := do(client, base, command, job); err != nil {
+				log.Println(err)
+				failed = true
+			}
+		}
+		if failed {
+			os.Exit(1)
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+func list(client *http.Client, base string) error {
+	resp, err := client.Get(base + "/jobs")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+
+	var jobs []*xCUTEr.JobStatus
+	if err := json.NewDecoder(resp.Body).Decode(&jobs); err != nil {
+		return fmt.Errorf("failed to decode jobs: %s", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "FILE\tNAME\tSCHEDULE\tSTATUS\tLAST RUN")
+	for _, job := range jobs {
+		status := "inactive"
+		if job.Active {
+			status = "active"
+		}
+		if job.Paused {
+			status += ", paused"
+		}
+		if job.Running {
+			status += ", running"
+		}
+		if job.Queued > 0 {
+			status += fmt.Sprintf(", %d queued", job.Queued)
+		}
+
+		lastRun := "never"
+		if !job.LastRun.IsZero() {
+			lastRun = job.LastRun.Format("2006-01-02 15:04:05")
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", job.File, job.Name, job.Schedule, status, lastRun)
+	}
+	return w.Flush()
+}
+
+func do(client *http.Client, base, command, job string) error {
+	resp, err := client.PostForm(base+"/jobs/"+command, url.Values{"job": {job}})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("failed to %s %s: %s", command, job, responseError(resp))
+	}
+	return nil
+}
+
+func responseError(resp *http.Response) error {
+	b, _ := ioutil.ReadAll(resp.Body)
+	if msg := strings.TrimSpace(string(b)); msg != "" {
+		return fmt.Errorf("%s", msg)
+	}
+	return fmt.Errorf("%s", resp.Status)
+}
+
+func flags() (api, command string, jobs []string) {
+	const (
+		apiDefault = "localhost:8642"
+	)
+
+	flag.StringVar(&api, "api", apiDefault, "Endpoint of the xCUTEr API, see xCUTEr -api.")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage: %s [flags] command [job...]
+
+Commands:
+  list        List all jobs.
+  activate    Activate inactive jobs.
+  deactivate  Deactivate active jobs.
+  pause       Pause jobs, they stay scheduled, but don't run.
+  resume      Resume paused jobs.
+
+Jobs are given by their job file, the base name of their job file or their name.
+
+Flags:
+`, os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	command = flag.Arg(0)
+	if flag.NArg() > 1 {
+		jobs = flag.Args()[1:]
+	}
+	return
+}
@@ -0,0 +1,308 @@
+// Copyright (c) 2016 Niklas Wolber
+// This file is licensed under the MIT license.
+// See the LICENSE file for more information.
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/nwolber/xCUTEr/secrets"
+)
+
+const usage = `Usage: xSecrets [flags] command [arguments]
+
+Commands:
+  init              Create a new secrets file (and key file, if -key is given).
+  list              List the names of all secrets.
+  set name          Add or change a secret. The value is read from STDIN, so
+                    it doesn't show up in the process list or shell history.
+                    On a terminal, the value isn't echoed.
+  delete name       Remove a secret.
+  rotate            Encrypt all secrets with a new key. The new key is either
+                    generated into the file given by -newKey or derived from
+                    the passphrase in ` + newPassphraseEnv + `.
+
+Flags:
+`
+
+const newPassphraseEnv = "XCUTER_SECRETS_NEW_PASSPHRASE"
+
+func main() {
+	file, keyFile, newKeyFile := flags()
+
+	args := flag.Args()
+	if len(args) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var err error
+	switch cmd, args := args[0], args[1:]; cmd {
+	case "init":
+		err = initFile(file, keyFile)
+	case "list":
+		err = list(file)
+	case "set":
+		err = set(file, keyFile, args)
+	case "delete":
+		err = remove(file, keyFile, args)
+	case "rotate":
+		err = rotate(file, keyFile, newKeyFile)
+	default:
+		err = fmt.Errorf("unknown command %q", cmd)
+	}
+
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
+
+func initFile(file, keyFile string) error {
+	if _, err := os.Stat(file); err == nil {
+		return fmt.Errorf("secrets file %s already exists", file)
+	}
+
+	if keyFile != "" {
+		if _, err := os.Stat(keyFile); os.IsNotExist(err) {
+			if err := secrets.GenerateKeyFile(keyFile); err != nil {
+				return err
+			}
+			fmt.Println("generated key file", keyFile)
+		}
+	}
+
+	f, err := secrets.New()
+	if err != nil {
+		return err
+	}
+
+	key, err := f.Key(keyFile)
+	if err != nil {
+		return err
+	}
+
+	if err := f.Encrypt(nil, key); err != nil {
+		return err
+	}
+
+	return f.Write(file)
+}
+
+func list(file string) error {
+	f, err := secrets.Read(file)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range f.Names() {
+		fmt.Println(name)
+	}
+	return nil
+}
+
+// edit decrypts the secrets file, applies the change and encrypts it again.
+func edit(file, keyFile string, change func(values map[string]string) error) error {
+	f, err := secrets.Read(file)
+	if err != nil {
+		return err
+	}
+
+	key, err := f.Key(keyFile)
+	if err != nil {
+		return err
+	}
+
+	values, err := f.Decrypt(key)
+	if err != nil {
+		return err
+	}
+
+	if err := change(values); err != nil {
+		return err
+	}
+
+	if err := f.Encrypt(values, key); err != nil {
+		return err
+	}
+
+	return f.Write(file)
+}
+
+func set(file, keyFile string, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: xSecrets set name")
+	}
+
+	name := args[0]
+	value, err := readValue(name)
+	if err != nil {
+		return err
+	}
+
+	return edit(file, keyFile, func(values map[string]string) error {
+		values[name] = value
+		return nil
+	})
+}
+
+// readValue reads the value of the secret from STDIN. If STDIN is a terminal,
+// echo is turned off while reading, so the value isn't shown on screen.
+func readValue(name string) (string, error) {
+	if stat, err := os.Stdin.Stat(); err == nil && stat.Mode()&os.ModeCharDevice != 0 {
+		if err := stty("-echo"); err != nil {
+			return "", fmt.Errorf("failed to turn off echo, pipe the value into xSecrets instead: %s", err)
+		}
+
+		// echo is turned on again, even if reading is interrupted
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		done := make(chan struct{})
+		go func() {
+			select {
+			case <-signals:
+				stty("echo")
+				fmt.Fprintln(os.Stderr)
+				os.Exit(1)
+			case <-done:
+			}
+		}()
+		defer func() {
+			signal.Stop(signals)
+			close(done)
+			stty("echo")
+			fmt.Fprintln(os.Stderr)
+		}()
+
+		fmt.Fprintf(os.Stderr, "value of %s: ", name)
+	}
+
+	value, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && value == "" {
+		return "", fmt.Errorf("failed to read value from STDIN: %s", err)
+	}
+	return strings.TrimRight(value, "\r\n"), nil
+}
+
+// stty changes the settings of the terminal connected to STDIN.
+func stty(arg string) error {
+	cmd := exec.Command("stty", arg)
+	cmd.Stdin = os.Stdin
+	return cmd.Run()
+}
+
+func remove(file, keyFile string, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: xSecrets delete name")
+	}
+
+	return edit(file, keyFile, func(values map[string]string) error {
+		if _, ok := values[args[0]]; !ok {
+			return fmt.Errorf("secret %s not found", args[0])
+		}
+		delete(values, args[0])
+		return nil
+	})
+}
+
+func rotate(file, keyFile, newKeyFile string) error {
+	f, err := secrets.Read(file)
+	if err != nil {
+		return err
+	}
+
+	key, err := f.Key(keyFile)
+	if err != nil {
+		return err
+	}
+
+	values, err := f.Decrypt(key)
+	if err != nil {
+		return err
+	}
+
+	// the new key file is only put in place after the secrets file has been
+	// written, so a failed rotation doesn't leave a key file, that doesn't
+	// match the secrets file
+	var tmpKeyFile string
+	if newKeyFile != "" {
+		if _, err := os.Stat(newKeyFile); err == nil {
+			return fmt.Errorf("key file %s already exists", newKeyFile)
+		}
+
+		tmpKeyFile = newKeyFile + ".tmp"
+		if err := secrets.GenerateKeyFile(tmpKeyFile); err != nil {
+			return err
+		}
+
+		if key, err = secrets.ReadKeyFile(tmpKeyFile); err != nil {
+			os.Remove(tmpKeyFile)
+			return err
+		}
+	} else {
+		passphrase, ok := os.LookupEnv(newPassphraseEnv)
+		if !ok {
+			return fmt.Errorf("neither -newKey nor %s is given", newPassphraseEnv)
+		}
+
+		if err := f.NewSalt(); err != nil {
+			return err
+		}
+		key = f.PassphraseKey(passphrase)
+	}
+
+	if err := f.Encrypt(values, key); err != nil {
+		if tmpKeyFile != "" {
+			os.Remove(tmpKeyFile)
+		}
+		return err
+	}
+
+	if err := f.Write(file); err != nil {
+		if tmpKeyFile != "" {
+			os.Remove(tmpKeyFile)
+		}
+		return err
+	}
+
+	if tmpKeyFile != "" {
+		if err := os.Rename(tmpKeyFile, newKeyFile); err != nil {
+			return fmt.Errorf("secrets are encrypted with the key in %s, but it couldn't be renamed to %s: %s", tmpKeyFile, newKeyFile, err)
+		}
+	}
+	return nil
+}
+
+func flags() (file, keyFile, newKeyFile string) {
+	const (
+		fileDefault       = "secrets.json"
+		keyFileDefault    = ""
+		newKeyFileDefault = ""
+	)
+
+	flag.StringVar(&file, "file", fileDefault, "Secrets file.")
+	flag.StringVar(&keyFile, "key", keyFileDefault, "Key file. If omitted, the passphrase is read from "+secrets.PassphraseEnv+".")
+	flag.StringVar(&newKeyFile, "newKey", newKeyFileDefault, "Key file to generate when rotating.")
+	help := flag.Bool("help", false, "Display this help.")
+
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *help {
+		flag.Usage()
+		os.Exit(0)
+	}
+
+	return
+}
@@ -43,10 +43,7 @@ func main() {
 	tree.ApplyStore(store.Get())
 	fmt.Println(tree)
 
-	timing, err := telemetry.NewTiming(config)
-	if err != nil {
-		log.Fatalln("error building timing tree:", err)
-	}
+	timing := store.Timing()
 	timing.ApplyStore(store.Get())
 
 	fmt.Printf("Total runtime: %s\n", timing.JobRuntime)
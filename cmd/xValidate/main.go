@@ -9,23 +9,44 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/nwolber/xCUTEr/job"
 )
 
 func main() {
-	file, all, raw, full, json := flags()
+	file, vars, all, raw, full, json, dag, next := flags()
+
+	if dag {
+		printDAG(flag.Args())
+		return
+	}
 
 	config, err := job.ReadConfig(file)
 	if err != nil {
 		log.Fatalln(err)
 	}
 
+	if err := config.SetVars(vars); err != nil {
+		log.Fatalln(err)
+	}
+
 	if json {
 		fmt.Println(config.JSON())
 		return
 	}
 
+	if next > 0 {
+		printNext(config, next)
+		return
+	}
+
+	if config.Abstract {
+		fmt.Println("abstract job, it is only used as a base job")
+		return
+	}
+
 	maxHosts := 0
 	if !all {
 		maxHosts = 1
@@ -40,18 +61,24 @@ func main() {
 	fmt.Printf("Execution tree:\n%s\n", tree)
 }
 
-func flags() (file string, all, raw, full, json bool) {
+func flags() (file string, vars job.VarValues, all, raw, full, json, dag bool, next int) {
 	const (
 		allDefault  = false
 		rawDefault  = false
 		fullDefault = false
 		jsonDefault = false
+		dagDefault  = false
+		nextDefault = 0
 	)
 
+	vars = make(job.VarValues)
+	flag.Var(vars, "var", "Value for a job variable in the form name=value. May be repeated. The job has to declare the variable.")
 	flag.BoolVar(&all, "all", allDefault, "Display all hosts.")
 	flag.BoolVar(&raw, "raw", rawDefault, "Display without templating.")
 	flag.BoolVar(&full, "full", fullDefault, "Display all directives, including infrastructure.")
-	flag.BoolVar(&json, "json", jsonDefault, "Display json representation.")
+	flag.BoolVar(&json, "json", jsonDefault, "Display json representation of the effective job, including inherited options.")
+	flag.BoolVar(&dag, "dag", dagDefault, "Display the dependency graph of all given job files and directories.")
+	flag.IntVar(&next, "next", nextDefault, "Display the next n times the job runs.")
 	help := flag.Bool("help", false, "Display this help.")
 	flag.Parse()
 
@@ -63,3 +90,64 @@ func flags() (file string, all, raw, full, json bool) {
 	file = flag.Arg(0)
 	return
 }
+
+// printDAG prints the dependency graph of the job files. Directories are
+// searched for .job files.
+func printDAG(paths []string) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		jobFiles, err := filepath.Glob(filepath.Join(path, "*.job"))
+		if err != nil {
+			log.Fatalln(err)
+		}
+		files = append(files, jobFiles...)
+	}
+
+	var configs []*job.Config
+	for _, file := range files {
+		config, err := job.ReadConfig(file)
+		if err != nil {
+			log.Fatalln(file, err)
+		}
+		if config.Abstract {
+			continue
+		}
+		configs = append(configs, config)
+	}
+
+	dag, err := job.NewDAG(configs)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	fmt.Print(dag)
+}
+
+// printNext prints the next n times the job runs, taking its time zone,
+// calendar and business day modifier into account.
+func printNext(config *job.Config, n int) {
+	if config.Schedule == "once" || config.Triggered() {
+		fmt.Println("The job is not scheduled.")
+		return
+	}
+
+	schedule, err := config.ParseSchedule()
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	fmt.Printf("Next runs (%s):\n", schedule.Location())
+	for _, t := range schedule.NextN(time.Now(), n) {
+		fmt.Println(t.Format("Mon 2006-01-02 15:04:05 MST"))
+	}
+}
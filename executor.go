@@ -7,10 +7,15 @@ package xCUTEr
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"math/rand"
+	"path/filepath"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/DataDog/datadog-go/statsd"
@@ -18,6 +23,7 @@ import (
 	"github.com/nwolber/xCUTEr/flunc"
 	"github.com/nwolber/xCUTEr/job"
 	"github.com/nwolber/xCUTEr/telemetry"
+	errs "github.com/pkg/errors"
 )
 
 type jobInfo struct {
@@ -38,6 +44,14 @@ func (info *schedInfo) Config() *job.Config {
 	return info.j.c
 }
 
+// Status of a run.
+const (
+	statusQueued    = "queued"
+	statusRunning   = "running"
+	statusSkipped   = "skipped"
+	statusCompleted = "completed"
+)
+
 // runInfo holds information about a single run of a job.
 type runInfo struct {
 	// The executor the job runs on.
@@ -46,12 +60,40 @@ type runInfo struct {
 	j *jobInfo
 	// Function to cancel the job early.
 	cancel context.CancelFunc
+	// Execution tree and telemetry events of this run.
+	f      flunc.Flunc
+	events *telemetry.EventStore
 	// Start and finish time of the job.
 	start, stop time.Time
 	// Job output.
 	output bytes.Buffer
+	// Error the job ended with.
+	err error
+	// Runs of the upstream jobs, that triggered this run.
+	triggeredBy []*runInfo
+	// One of queued, running, skipped or completed.
+	status string
+	// Missed occurrence of the schedule, this run catches up on.
+	missed time.Time
+	// Why the run has been cancelled, empty if it hasn't.
+	reason string
 }
 
+// Reasons for cancelling a run.
+const (
+	reasonShutdown = "shutdown"
+	reasonRemoved  = "removed"
+	reasonReplaced = "replaced"
+)
+
+// Results of completed runs, also used as names of their statsd counters.
+const (
+	resultSucceeded = "succeeded"
+	resultFailed    = "failed"
+	resultCancelled = "cancelled"
+	resultTimeout   = "timeout"
+)
+
 // Config returns the running Config .
 func (info *runInfo) Config() *job.Config {
 	return info.j.c
@@ -72,40 +114,169 @@ func (info *runInfo) Output() string {
 	return info.output.String()
 }
 
+// Status returns whether the run is queued, running, skipped or completed.
+// Runs are queued while they wait for the previous run of the same job or
+// for concurrency limits.
+func (info *runInfo) Status() string {
+	info.e.mRun.Lock()
+	defer info.e.mRun.Unlock()
+	return info.status
+}
+
+// CatchUp returns the missed occurrence of the schedule, the run catches up
+// on. It is the zero time for regular runs.
+func (info *runInfo) CatchUp() time.Time {
+	return info.missed
+}
+
+// Reason returns why the run has been cancelled, e.g. shutdown. It is empty,
+// if the run hasn't been cancelled.
+func (info *runInfo) Reason() string {
+	info.e.mRun.Lock()
+	defer info.e.mRun.Unlock()
+	return info.reason
+}
+
+// cancelWith cancels the run and records the reason. Only the first reason
+// is kept.
+func (info *runInfo) cancelWith(reason string) {
+	info.e.mRun.Lock()
+	if info.reason == "" {
+		info.reason = reason
+	}
+	info.e.mRun.Unlock()
+
+	info.cancel()
+}
+
+// applyReason records the cancellation of the run as its error.
+func (info *runInfo) applyReason() {
+	if reason := info.Reason(); reason != "" {
+		info.err = errs.Errorf("cancelled: %s", reason)
+	}
+}
+
+// Err returns the error the job ended with, nil if it succeeded.
+func (info *runInfo) Err() error {
+	return info.err
+}
+
+// Result returns whether the run succeeded, failed, has been cancelled or
+// timed out.
+func (info *runInfo) Result() string {
+	switch {
+	case info.Reason() != "":
+		return resultCancelled
+	case info.err == nil:
+		return resultSucceeded
+	case flunc.IsTimeout(info.err):
+		return resultTimeout
+	case flunc.IsCancelled(info.err):
+		return resultCancelled
+	default:
+		return resultFailed
+	}
+}
+
+// TriggeredBy returns the runs of the upstream jobs, that triggered this run.
+// It is empty, if the run wasn't triggered by dependencies.
+func (info *runInfo) TriggeredBy() []*runInfo {
+	return info.triggeredBy
+}
+
 func (info *runInfo) run() {
 	ctx, cancel := context.WithCancel(info.e.mainCtx)
 
+	// sensitive values are redacted before they are captured, the run shares
+	// its Redactor, so secrets resolved during the run are redacted as well
+	redactor := info.j.c.Redactor()
+	ctx = context.WithValue(ctx, job.RedactorKey, redactor)
+	capture := redactor.Writer(&info.output)
 	output, ok := ctx.Value(outputKey).(io.Writer)
 	if ok {
-		ctx = context.WithValue(ctx, outputKey, io.MultiWriter(output, &info.output))
+		ctx = context.WithValue(ctx, outputKey, io.MultiWriter(output, capture))
 	} else {
 		// ctx = context.WithValue(ctx, "output", &info.output)
 	}
 
 	info.cancel = cancel
 
+	if info.e.isDraining() {
+		info.cancelWith(reasonShutdown)
+		log.Println(info.Config().Name, "not started, shutting down")
+		info.applyReason()
+		info.e.skip(info)
+		return
+	}
+
+	// skipped and queued runs count as well, they are not missed
+	info.e.state.setLastRun(info.j.file, time.Now())
+
 	if !info.e.addRunning(info) {
-		log.Printf("another instance of %q is still running, consider adding/lowering the timeout", info.j.c.Name)
+		cancel()
+		info.e.overlap(info)
 		return
 	}
 
+	release := func() {}
 	defer func() {
 		// release resources
+		release()
 		cancel()
+		capture.Flush()
 		info.stop = time.Now()
 
-		if info.j.telemetry {
-			events := info.j.events.Reset()
-			info.e.sendTelemetry(info.j.c, &events)
+		if info.j.telemetry && info.events != nil {
+			// the hosts of this run, which may differ from the config's
+			// current hosts
+			timing := info.events.Timing()
+			timing.ApplyStore(info.events.Reset())
+			info.e.sendTelemetry(info.j.c, info.Result(), timing)
 		}
 
-		info.e.removeRunning(info)
+		info.e.setStatus(info, statusCompleted)
+		// recorded before leaving running, so draining waits for it
 		info.e.addComplete(info)
+		info.e.removeRunning(info)
+		info.e.triggerDownstream(info)
+
+		if next := info.e.dequeue(info.j.file); next != nil {
+			go info.e.run(next)
+		}
 	}()
-	info.start = time.Now()
-	_, err := info.j.f(ctx)
+
+	var err error
+	release, err = info.e.limits.acquire(ctx, info.j.c.Locks, func() {
+		log.Println(info.Config().Name, "waits for concurrency limits")
+		info.e.setStatus(info, statusQueued)
+	})
 	if err != nil {
-		log.Println(info.Config().Name, "ended with an error:", err)
+		log.Println(info.Config().Name, "cancelled while waiting for concurrency limits:", err)
+		info.err = errs.Wrap(flunc.ContextErr(ctx), "cancelled while waiting for concurrency limits")
+		info.applyReason()
+		release = func() {}
+		info.start = time.Now()
+		return
+	}
+	info.e.setStatus(info, statusRunning)
+	info.start = time.Now()
+
+	info.f, info.events = info.j.f, info.j.events
+	if info.j.c.DynamicHosts() {
+		// hosts may have changed since the job was parsed
+		var err error
+		info.f, info.events, err = info.e.build(info.j.c, info.j.telemetry)
+		if err != nil {
+			log.Println(info.Config().Name, "failed to resolve hosts:", err)
+			info.err = err
+			return
+		}
+	}
+
+	_, info.err = info.f(ctx)
+	info.applyReason()
+	if info.err != nil {
+		log.Println(info.Config().Name, "ended with an error:", info.err)
 	}
 }
 
@@ -114,18 +285,31 @@ type executor struct {
 	mainCtx context.Context
 	// Whether jobs need to be activated manually.
 	manualActive bool
+	// Whether xCUTEr is shutting down and no new runs are started.
+	draining int32
+	// Run-time values for job variables.
+	vars map[string]string
+	// Whether jobs have to declare all variables in vars. Otherwise each job
+	// only gets the values of the variables it declares.
+	strictVars bool
 	// Number of completed runInfos kept.
 	maxCompleted uint32
+	// State persisted between restarts.
+	state *state
 	// Functions to start and stop the scheduler.
 	Start, Stop func()
 	// Function to run a runInfo.
 	run func(info *runInfo)
-	// Function to schedule a new runInfo.
-	schedule func(schedule string, f func()) (string, error)
+	// Function to schedule a job according to its Config.
+	schedule func(c *job.Config, f func()) (string, error)
 	// Function to remove an existing runInfo.
 	remove func(string)
+	// Limits for runs of all jobs.
+	limits *limits
+	// Function returning a random number in [0,n) for the jitter of jobs.
+	random func(n int64) int64
 
-	// List of inactive scheduled jobs. Only used if manualActive is true.
+	// List of inactive scheduled jobs, that have to be activated first.
 	inactive  map[string]*schedInfo
 	mInactive sync.Mutex
 
@@ -135,15 +319,35 @@ type executor struct {
 
 	// List of currently running jobs.
 	running map[string]*runInfo
-	mRun    sync.Mutex
+	// Runs waiting for the running run of the same job file to finish.
+	queued map[string][]*runInfo
+	mRun   sync.Mutex
 
 	// List of completed runInfos. A maximum of maxCompleted runInfos is kept.
 	completed  []*runInfo
 	mCompleted sync.Mutex
 
+	// Runs of upstream jobs that met the conditions of their dependencies,
+	// by the file of the dependent job and the name of the upstream job.
+	upstreamRuns map[string]map[string]*runInfo
+	mUpstream    sync.Mutex
+
 	statsdClient *statsd.Client
 }
 
+// newRandom returns a function returning a random number in [0,n). Unlike
+// the global source of math/rand, its source is seeded, so jitters differ
+// between restarts.
+func newRandom() func(n int64) int64 {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	var m sync.Mutex
+	return func(n int64) int64 {
+		m.Lock()
+		defer m.Unlock()
+		return r.Int63n(n)
+	}
+}
+
 func newExecutor(ctx context.Context, telemetryEndpoint string) (*executor, error) {
 	run := func(info *runInfo) { info.run() }
 
@@ -155,14 +359,28 @@ func newExecutor(ctx context.Context, telemetryEndpoint string) (*executor, erro
 		Start:        cron.Start,
 		Stop:         cron.Stop,
 		run:          run,
-		schedule:     cron.AddFunc,
+		schedule: func(c *job.Config, f func()) (string, error) {
+			s, err := c.ParseSchedule()
+			if err != nil {
+				return "", err
+			}
+			return cron.Schedule(s, sched.FuncJob(f)), nil
+		},
 		remove:       cron.Remove,
+		random:       newRandom(),
+		limits:       newLimits(0),
 		inactive:     make(map[string]*schedInfo),
 		scheduled:    make(map[string]*schedInfo),
 		running:      make(map[string]*runInfo),
+		queued:       make(map[string][]*runInfo),
+		upstreamRuns: make(map[string]map[string]*runInfo),
+	}
+	var err error
+	if e.state, err = loadState(""); err != nil {
+		return nil, err
 	}
+
 	if telemetryEndpoint != "" {
-		var err error
 		e.statsdClient, err = statsd.New(telemetryEndpoint)
 		if err != nil {
 			return nil, err
@@ -178,20 +396,16 @@ func newExecutor(ctx context.Context, telemetryEndpoint string) (*executor, erro
 	return e, nil
 }
 
-func (e *executor) sendTelemetry(c *job.Config, events *[]telemetry.Event) {
-	timing, err := telemetry.NewTiming(c)
-	if err != nil {
-		log.Println("Error creating timing:", err)
-		return
-	}
-
-	timing.ApplyStore(*events)
-
+func (e *executor) sendTelemetry(c *job.Config, result string, timing *telemetry.Timing) {
 	log.Println("sending telemetry data for job", c.Name)
 	if err := e.statsdClient.Timing(c.Name+".runtime", timing.JobRuntime, nil, 1.0); err != nil {
 		log.Println("error sending telemetry data for job", c.Name, err)
 	}
 
+	if err := e.statsdClient.Incr(c.Name+"."+result, nil, 1.0); err != nil {
+		log.Println("error sending telemetry data for job", c.Name, err)
+	}
+
 	for host, stats := range timing.Hosts {
 		if err := e.statsdClient.Timing(fmt.Sprintf("%s.%s.runtime", c.Name, host.Name), stats.Runtime, nil, 1.0); err != nil {
 			log.Println("error sending telemetry data for job", c.Name, "host", host.Name, err)
@@ -199,19 +413,55 @@ func (e *executor) sendTelemetry(c *job.Config, events *[]telemetry.Event) {
 	}
 }
 
+// errAbstract is returned by parse for abstract jobs, which are only used as
+// base jobs and never run.
+var errAbstract = errors.New("abstract job")
+
 // parse parses the given file and stores the execution tree in the jobInfo.
+// Abstract jobs are not validated, because they may be incomplete.
 func (e *executor) parse(file string) (*jobInfo, error) {
 	c, err := job.ReadConfig(file)
 	if err != nil {
 		return nil, err
 	}
 
+	if c.Abstract {
+		return nil, errAbstract
+	}
+
+	vars := e.vars
+	if !e.strictVars {
+		vars = c.DeclaredVars(vars)
+	}
+	if err := c.SetVars(vars); err != nil {
+		return nil, err
+	}
+
 	useTelemetry := c.Telemetry && e.statsdClient != nil
 
+	f, events, err := e.build(c, useTelemetry)
+	if err != nil {
+		return nil, err
+	}
+
+	return &jobInfo{
+		file: file,
+		c:    c,
+		f:    f,
+
+		telemetry: useTelemetry,
+		events:    events,
+	}, nil
+}
+
+// build creates the execution tree for the config. If useTelemetry is true
+// the execution tree is instrumented.
+func (e *executor) build(c *job.Config, useTelemetry bool) (flunc.Flunc, *telemetry.EventStore, error) {
 	start := time.Now()
 	var (
 		f      flunc.Flunc
 		events *telemetry.EventStore
+		err    error
 	)
 
 	if useTelemetry {
@@ -221,20 +471,12 @@ func (e *executor) parse(file string) (*jobInfo, error) {
 	}
 
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	stop := time.Now()
 	log.Println("job preparation took", stop.Sub(start))
-
-	return &jobInfo{
-		file: file,
-		c:    c,
-		f:    f,
-
-		telemetry: useTelemetry,
-		events:    events,
-	}, nil
+	return f, events, nil
 }
 
 // scheduleBody returns a function that can be used by the cron
@@ -242,6 +484,15 @@ func (e *executor) parse(file string) (*jobInfo, error) {
 func scheduleBody(e *executor, j *jobInfo) func() {
 	return func() {
 		log.Println(j.c.Name, "woke up")
+		if e.state.get(j.file).Paused {
+			log.Println(j.c.Name, "is paused")
+			return
+		}
+
+		if !e.delay(j) {
+			return
+		}
+
 		info := &runInfo{
 			e: e,
 			j: j,
@@ -251,6 +502,37 @@ func scheduleBody(e *executor, j *jobInfo) func() {
 	}
 }
 
+// delay waits for the splay and jitter of the job. It returns false, if the
+// job has been removed or deactivated in the meantime or xCUTEr is shutting
+// down.
+func (e *executor) delay(j *jobInfo) bool {
+	d, err := j.c.Delay(e.random)
+	if err != nil {
+		log.Println(j.c.Name, "failed to compute delay:", err)
+		return true
+	}
+
+	if d <= 0 {
+		return true
+	}
+
+	log.Println(j.c.Name, "delayed by", d)
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-e.mainCtx.Done():
+		return false
+	}
+
+	if info := e.isScheduled(j.file); info == nil || info.j != j {
+		log.Println(j.c.Name, "was removed while delayed")
+		return false
+	}
+	return true
+}
+
 // Run either executes the job directly if either the job's schedule
 // is "once" or the once parameter is true. Otherwise the job is
 // scheduled as if Add would have been called.
@@ -262,12 +544,32 @@ func (e *executor) Run(j *jobInfo, once bool) {
 		}
 		e.run(info)
 	} else {
-		e.Add(j)
+		e.Load(j)
 	}
 }
 
-// Add schedules the job.
+// Load schedules the job like Add and catches up on the runs, that have been
+// missed while xCUTEr was down. Only jobs loaded on startup are loaded this
+// way, so runs missed because the job has been changed, reloaded or
+// deactivated are not caught up on.
+func (e *executor) Load(j *jobInfo) error {
+	if err := e.Add(j); err != nil {
+		return err
+	}
+
+	if e.isScheduled(j.file) != nil && !j.c.Triggered() {
+		e.catchUp(j)
+	}
+	return nil
+}
+
+// Add schedules the job. Jobs without a schedule that depend on other jobs
+// are only run when triggered by them.
 func (e *executor) Add(j *jobInfo) error {
+	if err := e.checkDependencies(j); err != nil {
+		return err
+	}
+
 	if j.c.Schedule == "once" {
 		info := &runInfo{
 			e: e,
@@ -275,14 +577,23 @@ func (e *executor) Add(j *jobInfo) error {
 		}
 		go e.run(info)
 	} else {
-		if e.manualActive {
+		if e.state.get(j.file).inactive(e.manualActive) {
 			e.addInactive(&schedInfo{
 				j: j,
 			})
+			log.Println(j.c.Name, "waits for activation")
+			return nil
+		}
+
+		if j.c.Triggered() {
+			e.addScheduled(&schedInfo{
+				j: j,
+			})
+			log.Println(j.c.Name, "waits for upstream jobs")
 			return nil
 		}
 
-		id, err := e.schedule(j.c.Schedule, scheduleBody(e, j))
+		id, err := e.schedule(j.c, scheduleBody(e, j))
 
 		if err != nil {
 			return err
@@ -299,18 +610,86 @@ func (e *executor) Add(j *jobInfo) error {
 	return nil
 }
 
+// catchUp runs the occurrences of the job's schedule, that have been missed
+// since its last run, according to its catch-up policy.
+func (e *executor) catchUp(j *jobInfo) {
+	if j.c.CatchUp == nil || e.state.get(j.file).Paused {
+		return
+	}
+
+	schedule, err := j.c.ParseSchedule()
+	if err != nil {
+		log.Println(j.c.Name, "failed to parse schedule:", err)
+		return
+	}
+
+	missed := j.c.CatchUp.Missed(schedule.Next, e.state.lastRun(j.file), time.Now())
+	if len(missed) == 0 {
+		return
+	}
+
+	log.Println(j.c.Name, "missed", len(missed), "runs, catching up")
+	go func() {
+		for _, t := range missed {
+			e.run(&runInfo{
+				e:      e,
+				j:      j,
+				missed: t,
+			})
+		}
+	}()
+}
+
 // Remove removes all resources associated with the given job file.
 func (e *executor) Remove(file string) {
 	log.Println("remove", file)
+	e.mRun.Lock()
+	delete(e.queued, file)
+	e.mRun.Unlock()
+
 	if info := e.isRunning(file); info != nil {
 		e.removeRunning(info)
-		info.cancel()
+		info.cancelWith(reasonRemoved)
 		log.Println("found running", info.j.c.Name)
 	}
 
+	e.unschedule(file)
+
+	e.mUpstream.Lock()
+	delete(e.upstreamRuns, file)
+	e.mUpstream.Unlock()
+}
+
+// Reload replaces the job with the same job file. Unlike Remove, runs of the
+// old job are not cancelled. Jobs scheduled "once" have been run when they
+// were added, so they are only run, if the job file used to schedule the job
+// otherwise.
+func (e *executor) Reload(j *jobInfo) error {
+	log.Println("reload", j.file)
+	ranOnce := e.ranOnce(j)
+	e.unschedule(j.file)
+
+	if ranOnce {
+		log.Println(j.c.Name, "already ran once")
+		return nil
+	}
+	return e.Add(j)
+}
+
+// ranOnce returns true, if the job is scheduled "once" and the job file
+// didn't schedule the job otherwise before, so the job has already been run
+// when it was added.
+func (e *executor) ranOnce(j *jobInfo) bool {
+	return j.c.Schedule == "once" && e.isScheduled(j.file) == nil && e.isInactive(j.file) == nil
+}
+
+// unschedule removes the scheduled or inactive job of the job file.
+func (e *executor) unschedule(file string) {
 	if info := e.isScheduled(file); info != nil {
 		e.removeScheduled(info)
-		e.remove(info.id)
+		if info.id != "" {
+			e.remove(info.id)
+		}
 
 		log.Println("found scheduled", info.j.c.Name)
 	}
@@ -321,30 +700,234 @@ func (e *executor) Remove(file string) {
 	}
 }
 
-// Activates the job associated with the job file.
-func (e *executor) Activate(file string) {
+// Files returns the job files of all scheduled and inactive jobs.
+func (e *executor) Files() []string {
+	var files []string
+	for _, infos := range [][]*schedInfo{e.GetScheduled(), e.GetInactive()} {
+		for _, info := range infos {
+			files = append(files, info.j.file)
+		}
+	}
+	return files
+}
+
+const (
+	// drainPollInterval is the interval Drain checks for running runs.
+	drainPollInterval = 100 * time.Millisecond
+	// drainCancelTimeout is how long Drain waits for cancelled runs to
+	// finish.
+	drainCancelTimeout = 10 * time.Second
+)
+
+// Drain stops the scheduler and starts no new runs. It waits up to grace for
+// running runs to finish. Runs still running after that and runs waiting for
+// concurrency limits are cancelled with reason shutdown. Drain returns false,
+// if runs had to be cancelled.
+func (e *executor) Drain(grace time.Duration) bool {
+	log.Println("draining, waiting up to", grace, "for running jobs")
+	atomic.StoreInt32(&e.draining, 1)
+	e.Stop()
+
+	// runs queued behind the running run of the same job never start
+	e.mRun.Lock()
+	queued := e.queued
+	e.queued = make(map[string][]*runInfo)
+	e.mRun.Unlock()
+	for _, queue := range queued {
+		for _, info := range queue {
+			info.cancelWith(reasonShutdown)
+			info.applyReason()
+			e.skip(info)
+		}
+	}
+
+	// runs waiting for concurrency limits
+	for _, info := range e.GetQueued() {
+		info.cancelWith(reasonShutdown)
+	}
+
+	if e.waitIdle(grace) {
+		log.Println("drained")
+		return true
+	}
+
+	for _, info := range e.GetRunning() {
+		log.Println("cancelling", info.j.c.Name, "after grace period")
+		info.cancelWith(reasonShutdown)
+	}
+
+	if !e.waitIdle(drainCancelTimeout) {
+		log.Println("jobs still running after cancellation")
+	}
+	return false
+}
+
+func (e *executor) isDraining() bool {
+	return atomic.LoadInt32(&e.draining) == 1
+}
+
+// waitIdle waits up to timeout until no run is running or waiting for
+// concurrency limits. It returns false on timeout.
+func (e *executor) waitIdle(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		e.mRun.Lock()
+		idle := len(e.running) == 0
+		e.mRun.Unlock()
+
+		if idle {
+			return true
+		}
+		if !time.Now().Before(deadline) {
+			return false
+		}
+		time.Sleep(drainPollInterval)
+	}
+}
+
+// Activate schedules the inactive job associated with the job file. The
+// activation persists between restarts.
+func (e *executor) Activate(file string) error {
 	log.Println("activate", file)
-	if info := e.isInactive(file); info != nil {
-		e.removeInactive(info)
-		e.schedule(info.j.c.Schedule, scheduleBody(e, info.j))
+	info := e.isInactive(file)
+	if info == nil {
+		return errs.Errorf("job %s is not inactive", file)
+	}
 
-		e.addScheduled(info)
-	} else {
-		log.Println("didn't find ", file, "in inactive list")
+	e.removeInactive(info)
+	if !info.j.c.Triggered() {
+		id, err := e.schedule(info.j.c, scheduleBody(e, info.j))
+		if err != nil {
+			e.addInactive(info)
+			return errs.Wrapf(err, "failed to schedule %s", info.j.c.Name)
+		}
+		info.id = id
 	}
+
+	e.addScheduled(info)
+	active := true
+	e.state.update(file, func(j *jobState) { j.Active = &active })
+	return nil
 }
 
-// Deactivates the job associated with the job file.
-func (e *executor) Deactivate(file string) {
+// Deactivate unschedules the job associated with the job file. Running runs
+// are not affected. The deactivation persists between restarts.
+func (e *executor) Deactivate(file string) error {
 	log.Println("deactivate", file)
+	info := e.isScheduled(file)
+	if info == nil {
+		return errs.Errorf("job %s is not active", file)
+	}
 
-	if info := e.isScheduled(file); info != nil {
-		e.removeScheduled(info)
+	e.removeScheduled(info)
+	if info.id != "" {
 		e.remove(info.id)
-		e.addInactive(info)
-	} else {
-		log.Println("didn't find ", file, "in active list")
 	}
+	e.addInactive(info)
+	active := false
+	e.state.update(file, func(j *jobState) { j.Active = &active })
+	return nil
+}
+
+// Pause skips all runs of the job associated with the job file, until it is
+// resumed. Unlike deactivated jobs, paused jobs stay scheduled. Running runs
+// are not affected. Pausing persists between restarts.
+func (e *executor) Pause(file string) error {
+	return e.setPaused(file, true)
+}
+
+// Resume resumes the paused job associated with the job file.
+func (e *executor) Resume(file string) error {
+	return e.setPaused(file, false)
+}
+
+func (e *executor) setPaused(file string, paused bool) error {
+	if e.isScheduled(file) == nil && e.isInactive(file) == nil {
+		return errs.Errorf("unknown job %s", file)
+	}
+
+	if e.state.get(file).Paused == paused {
+		if paused {
+			return errs.Errorf("job %s is already paused", file)
+		}
+		return errs.Errorf("job %s is not paused", file)
+	}
+
+	log.Println("paused", file, paused)
+	e.state.update(file, func(j *jobState) { j.Paused = paused })
+	return nil
+}
+
+// Lookup returns the job file of the scheduled or inactive job, that is
+// referred to by either its job file, the base name of its job file or its
+// name.
+func (e *executor) Lookup(ref string) (string, error) {
+	files := make(map[string]bool)
+	for _, infos := range [][]*schedInfo{e.GetScheduled(), e.GetInactive()} {
+		for _, info := range infos {
+			if info.j.file == ref {
+				return ref, nil
+			}
+			if filepath.Base(info.j.file) == ref || info.j.c.Name == ref {
+				files[info.j.file] = true
+			}
+		}
+	}
+
+	switch len(files) {
+	case 0:
+		return "", errs.Errorf("unknown job %s", ref)
+	case 1:
+		for file := range files {
+			return file, nil
+		}
+	}
+	return "", errs.Errorf("%s refers to %d jobs, use the job file instead", ref, len(files))
+}
+
+// JobStatus is the status of a scheduled or inactive job.
+type JobStatus struct {
+	File     string    `json:"file"`
+	Name     string    `json:"name"`
+	Schedule string    `json:"schedule,omitempty"`
+	Active   bool      `json:"active"`
+	Paused   bool      `json:"paused"`
+	Running  bool      `json:"running"`
+	Queued   int       `json:"queued"`
+	LastRun  time.Time `json:"lastRun"`
+}
+
+// Jobs returns the status of all scheduled and inactive jobs ordered by
+// their job file.
+func (e *executor) Jobs() []*JobStatus {
+	queued := make(map[string]int)
+	for _, info := range e.GetQueued() {
+		queued[info.j.file]++
+	}
+	running := make(map[string]bool)
+	for _, info := range e.GetRunning() {
+		running[info.j.file] = true
+	}
+
+	var jobs []*JobStatus
+	for i, infos := range [][]*schedInfo{e.GetScheduled(), e.GetInactive()} {
+		for _, info := range infos {
+			state := e.state.get(info.j.file)
+			jobs = append(jobs, &JobStatus{
+				File:     info.j.file,
+				Name:     info.j.c.Name,
+				Schedule: info.j.c.Schedule,
+				Active:   i == 0,
+				Paused:   state.Paused,
+				Running:  running[info.j.file],
+				Queued:   queued[info.j.file],
+				LastRun:  state.LastRun,
+			})
+		}
+	}
+
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].File < jobs[j].File })
+	return jobs
 }
 
 // Start runs a job. If the return value is false,
@@ -358,15 +941,130 @@ func (e *executor) addRunning(info *runInfo) bool {
 	}
 
 	e.running[info.j.file] = info
+	info.status = statusRunning
 	return true
 }
 
+func (e *executor) setStatus(info *runInfo, status string) {
+	e.mRun.Lock()
+	defer e.mRun.Unlock()
+	info.status = status
+}
+
 // Stop halts execution of a job.
 func (e *executor) removeRunning(info *runInfo) {
 	e.mRun.Lock()
 	defer e.mRun.Unlock()
 
-	delete(e.running, info.j.file)
+	if e.running[info.j.file] == info {
+		delete(e.running, info.j.file)
+	}
+}
+
+// overlap applies the overlap policy of the job to a run, that is due while
+// another run of the same job is still running.
+func (e *executor) overlap(info *runInfo) {
+	name := info.j.c.Name
+
+	switch info.j.c.Overlap {
+	case job.OverlapQueue, job.OverlapQueueAll, job.OverlapCancel:
+		replace := info.j.c.Overlap == job.OverlapCancel
+		limit := 0
+		if info.j.c.Overlap != job.OverlapQueueAll {
+			limit = 1
+		}
+
+		skipped, ok := e.enqueue(info, limit, replace)
+		if skipped != nil {
+			log.Printf("skipping queued run of %q, it has been replaced", name)
+			e.skip(skipped)
+		}
+		if !ok {
+			break
+		}
+
+		log.Printf("another instance of %q is still running, queued the run", name)
+		if replace {
+			if running := e.isRunning(info.j.file); running != nil {
+				log.Printf("cancelling the running instance of %q", name)
+				running.cancelWith(reasonReplaced)
+			}
+		}
+		return
+	}
+
+	log.Printf("another instance of %q is still running, consider adding/lowering the timeout", name)
+	e.skip(info)
+}
+
+// skip records the run as skipped.
+func (e *executor) skip(info *runInfo) {
+	e.setStatus(info, statusSkipped)
+	info.start = time.Now()
+	info.stop = info.start
+	e.addComplete(info)
+}
+
+// enqueue queues the run. If limit is greater than zero and the queue is
+// full, the run is not queued, unless replace is true, in which case the
+// oldest queued run is returned and replaced.
+func (e *executor) enqueue(info *runInfo, limit int, replace bool) (skipped *runInfo, ok bool) {
+	e.mRun.Lock()
+	defer e.mRun.Unlock()
+
+	if _, running := e.running[info.j.file]; !running {
+		// the running run finished in the meantime
+		go e.run(info)
+		return nil, true
+	}
+
+	queue := e.queued[info.j.file]
+	if limit > 0 && len(queue) >= limit {
+		if !replace {
+			return nil, false
+		}
+		skipped, queue = queue[0], queue[1:]
+	}
+
+	info.status = statusQueued
+	e.queued[info.j.file] = append(queue, info)
+	return skipped, true
+}
+
+// dequeue returns the next queued run of the job file, if there is one.
+func (e *executor) dequeue(file string) *runInfo {
+	e.mRun.Lock()
+	defer e.mRun.Unlock()
+
+	queue := e.queued[file]
+	if len(queue) == 0 {
+		return nil
+	}
+
+	if len(queue) == 1 {
+		delete(e.queued, file)
+	} else {
+		e.queued[file] = queue[1:]
+	}
+	return queue[0]
+}
+
+// GetQueued returns all queued runs, both those waiting for the previous run
+// of the same job and those waiting for concurrency limits.
+func (e *executor) GetQueued() []*runInfo {
+	e.mRun.Lock()
+	defer e.mRun.Unlock()
+
+	var queued []*runInfo
+	for _, info := range e.running {
+		if info.status == statusQueued {
+			queued = append(queued, info)
+		}
+	}
+	for _, queue := range e.queued {
+		queued = append(queued, queue...)
+	}
+	return queued
 }
 
 // GetRunning returns a runInfo, if there is a running job.
@@ -380,11 +1078,11 @@ func (e *executor) GetRunning() []*runInfo {
 	e.mRun.Lock()
 	defer e.mRun.Unlock()
 
-	running := make([]*runInfo, len(e.running))
-	i := 0
+	running := make([]*runInfo, 0, len(e.running))
 	for _, info := range e.running {
-		running[i] = info
-		i++
+		if info.status != statusQueued {
+			running = append(running, info)
+		}
 	}
 	return running
 }
@@ -438,6 +1136,7 @@ func (e *executor) GetScheduled() []*schedInfo {
 	i := 0
 	for _, info := range e.scheduled {
 		scheduled[i] = info
+		i++
 	}
 	return scheduled
 }
@@ -470,6 +1169,116 @@ func (e *executor) GetInactive() []*schedInfo {
 	i := 0
 	for _, info := range e.inactive {
 		inactive[i] = info
+		i++
 	}
 	return inactive
 }
+
+// DAG returns the dependency graph of all scheduled and inactive jobs.
+func (e *executor) DAG() (*job.DAG, error) {
+	return job.NewDAG(e.configs(""))
+}
+
+// configs returns the Configs of all scheduled and inactive jobs, except the
+// one of the job file.
+func (e *executor) configs(except string) []*job.Config {
+	var configs []*job.Config
+	for _, infos := range [][]*schedInfo{e.GetScheduled(), e.GetInactive()} {
+		for _, info := range infos {
+			if info.j.file != except {
+				configs = append(configs, info.j.c)
+			}
+		}
+	}
+	return configs
+}
+
+// undeclaredVars returns the names of the run-time variables, that none of
+// the scheduled and inactive jobs declares.
+func (e *executor) undeclaredVars() []string {
+	declared := make(map[string]bool)
+	for _, c := range e.configs("") {
+		for name := range c.DeclaredVars(e.vars) {
+			declared[name] = true
+		}
+	}
+
+	var undeclared []string
+	for name := range e.vars {
+		if !declared[name] {
+			undeclared = append(undeclared, name)
+		}
+	}
+	sort.Strings(undeclared)
+	return undeclared
+}
+
+// checkDependencies returns an error if adding the job would introduce a
+// dependency cycle.
+func (e *executor) checkDependencies(j *jobInfo) error {
+	_, err := job.NewDAG(append(e.configs(j.file), j.c))
+	return err
+}
+
+// triggerDownstream runs all scheduled jobs, that depend on the job of the
+// completed run and whose upstream jobs all met their conditions.
+func (e *executor) triggerDownstream(upstream *runInfo) {
+	for _, s := range e.GetScheduled() {
+		if runs := e.upstreamCompleted(s.j, upstream); runs != nil {
+			if e.state.get(s.j.file).Paused {
+				log.Println(upstream.j.c.Name, "would trigger", s.j.c.Name, "but it is paused")
+				continue
+			}
+			log.Println(upstream.j.c.Name, "triggers", s.j.c.Name)
+			go e.run(&runInfo{
+				e:           e,
+				j:           s.j,
+				triggeredBy: runs,
+			})
+		}
+	}
+}
+
+// upstreamCompleted records the completed run, if j depends on its job. If
+// the runs of all upstream jobs of j met their conditions, they are returned
+// and recording starts over.
+func (e *executor) upstreamCompleted(j *jobInfo, upstream *runInfo) []*runInfo {
+	e.mUpstream.Lock()
+	defer e.mUpstream.Unlock()
+
+	runs := e.upstreamRuns[j.file]
+	depends := false
+	for _, dep := range j.c.DependsOn {
+		if dep.Job != upstream.j.c.Name {
+			continue
+		}
+		depends = true
+
+		if runs == nil {
+			runs = make(map[string]*runInfo)
+			e.upstreamRuns[j.file] = runs
+		}
+
+		if dep.Met(upstream.err) {
+			runs[dep.Job] = upstream
+		} else {
+			delete(runs, dep.Job)
+		}
+	}
+
+	if !depends {
+		return nil
+	}
+
+	triggeredBy := make([]*runInfo, 0, len(j.c.DependsOn))
+	for _, dep := range j.c.DependsOn {
+		run, ok := runs[dep.Job]
+		if !ok {
+			return nil
+		}
+		triggeredBy = append(triggeredBy, run)
+	}
+
+	delete(e.upstreamRuns, j.file)
+	return triggeredBy
+}
@@ -11,9 +11,14 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/nwolber/xCUTEr/flunc"
 	"github.com/nwolber/xCUTEr/job"
 )
 
@@ -135,12 +140,16 @@ func TestRunTwice(t *testing.T) {
 	case <-time.After(time.Second):
 	}
 
-	expectExecutor(t, e, "running 2", 0, 0, 1, 0)
+	// the second run is skipped and recorded as such
+	expectExecutor(t, e, "running 2", 0, 0, 1, 1)
+	if status := e.GetCompleted()[0].Status(); status != statusSkipped {
+		t.Errorf("want status %s, got %s", statusSkipped, status)
+	}
 
 	close(wait)
 	<-done
 
-	expectExecutor(t, e, "done", 0, 0, 0, 1)
+	expectExecutor(t, e, "done", 0, 0, 0, 2)
 }
 
 func TestMaxCompleted(t *testing.T) {
@@ -179,7 +188,7 @@ func TestAddSchedule(t *testing.T) {
 
 	waitBeforeWake := make(chan struct{})
 	e, _ := newExecutor(context.TODO(), "")
-	e.schedule = func(schedule string, f func()) (string, error) {
+	e.schedule = func(c *job.Config, f func()) (string, error) {
 		go func() {
 			<-waitBeforeWake
 			f()
@@ -226,13 +235,97 @@ func TestAddSchedule(t *testing.T) {
 	expectExecutor(t, e, "done", 0, 1, 0, 1)
 }
 
+func TestScheduleDelay(t *testing.T) {
+	const (
+		file   = "test.job"
+		jitter = 100 * time.Millisecond
+	)
+
+	tests := []struct {
+		name   string
+		remove bool
+		want   int
+	}{
+		{"delayed", false, 1},
+		{"removed while delayed", true, 0},
+	}
+
+	for _, test := range tests {
+		var body func()
+		e, _ := newExecutor(context.TODO(), "")
+		e.schedule = func(c *job.Config, f func()) (string, error) {
+			body = f
+			return "TEST-ID", nil
+		}
+		e.remove = func(string) {}
+		e.random = func(n int64) int64 { return n - 1 }
+
+		runs := make(chan time.Time, 1)
+		e.run = func(info *runInfo) {
+			runs <- time.Now()
+		}
+
+		e.Add(&jobInfo{
+			file: file,
+			c: &job.Config{
+				Name:     "Test Job",
+				Schedule: "@every 10s",
+				Jitter:   jitter.String(),
+			},
+		})
+
+		woke := time.Now()
+		done := make(chan struct{})
+		go func() {
+			body()
+			close(done)
+		}()
+
+		if test.remove {
+			e.Remove(file)
+		}
+
+		select {
+		case <-done:
+		case <-time.After(gracePeriod):
+			t.Fatalf("%s: expected job to wake up", test.name)
+		}
+
+		expect(t, test.name+" - runs", len(runs), test.want)
+		if test.want > 0 {
+			if delay := (<-runs).Sub(woke); delay < jitter-time.Nanosecond {
+				t.Errorf("%s: want delay of at least %s, got %s", test.name, jitter, delay)
+			}
+		}
+	}
+}
+
+func TestRandom(t *testing.T) {
+	const n = 10
+	random := newRandom()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if got := random(n); got < 0 || got >= n {
+					t.Errorf("want random number in [0,%d), got %d", n, got)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
 func TestAddScheduleError(t *testing.T) {
 	const (
 		file = "test.job"
 	)
 
 	e, _ := newExecutor(context.TODO(), "")
-	e.schedule = func(schedule string, f func()) (string, error) {
+	e.schedule = func(c *job.Config, f func()) (string, error) {
 		return "", errors.New("test error")
 	}
 
@@ -256,7 +349,7 @@ func TestRemoveBeforeWake(t *testing.T) {
 
 	waitBeforeWake := make(chan struct{})
 	e, _ := newExecutor(context.TODO(), "")
-	e.schedule = func(schedule string, f func()) (string, error) {
+	e.schedule = func(c *job.Config, f func()) (string, error) {
 		go func() {
 			<-waitBeforeWake
 		}()
@@ -285,7 +378,7 @@ func TestRemoveWhileRunning(t *testing.T) {
 
 	waitBeforeWake := make(chan struct{})
 	e, _ := newExecutor(context.TODO(), "")
-	e.schedule = func(schedule string, f func()) (string, error) {
+	e.schedule = func(c *job.Config, f func()) (string, error) {
 		go func() {
 			<-waitBeforeWake
 			f()
@@ -330,7 +423,7 @@ func TestRemoveAfterDone(t *testing.T) {
 
 	waitBeforeWake := make(chan struct{})
 	e, _ := newExecutor(context.TODO(), "")
-	e.schedule = func(schedule string, f func()) (string, error) {
+	e.schedule = func(c *job.Config, f func()) (string, error) {
 		go func() {
 			<-waitBeforeWake
 			f()
@@ -386,7 +479,7 @@ func TestAddInactive(t *testing.T) {
 	waitBeforeWake := make(chan struct{})
 	e, _ := newExecutor(context.TODO(), "")
 	e.manualActive = true
-	e.schedule = func(schedule string, f func()) (string, error) {
+	e.schedule = func(c *job.Config, f func()) (string, error) {
 		<-waitBeforeWake
 		return "TEST-ID", nil
 	}
@@ -410,7 +503,7 @@ func TestRemoveInactive(t *testing.T) {
 	waitBeforeWake := make(chan struct{})
 	e, _ := newExecutor(context.TODO(), "")
 	e.manualActive = true
-	e.schedule = func(schedule string, f func()) (string, error) {
+	e.schedule = func(c *job.Config, f func()) (string, error) {
 		<-waitBeforeWake
 		return "TEST-ID", nil
 	}
@@ -426,3 +519,531 @@ func TestRemoveInactive(t *testing.T) {
 
 	expectExecutor(t, e, "after", 0, 0, 0, 0)
 }
+
+func TestTriggerDownstream(t *testing.T) {
+	e, _ := newExecutor(context.TODO(), "")
+	e.schedule = func(c *job.Config, f func()) (string, error) {
+		return "TEST-ID", nil
+	}
+
+	upstreamErr := errors.New("test error")
+	upstream := func(name string, err error) *jobInfo {
+		return &jobInfo{
+			file: name + ".job",
+			c: &job.Config{
+				Name:     name,
+				Schedule: "@every 1h",
+			},
+			f: func(ctx context.Context) (context.Context, error) {
+				return nil, err
+			},
+		}
+	}
+	a, b := upstream("a", nil), upstream("b", upstreamErr)
+
+	triggered := make(chan *runInfo)
+	downstream := &jobInfo{
+		file: "c.job",
+		c: &job.Config{
+			Name: "c",
+			DependsOn: []*job.Dependency{
+				{Job: "a", Condition: job.OnSuccess},
+				{Job: "b", Condition: job.OnFailure},
+			},
+		},
+		f: func(ctx context.Context) (context.Context, error) {
+			return nil, nil
+		},
+	}
+	e.run = func(info *runInfo) {
+		if info.j == downstream {
+			triggered <- info
+			return
+		}
+		info.run()
+	}
+
+	for _, j := range []*jobInfo{a, b, downstream} {
+		if err := e.Add(j); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectExecutor(t, e, "scheduled", 0, 3, 0, 0)
+
+	e.run(&runInfo{e: e, j: a})
+
+	select {
+	case <-triggered:
+		t.Fatal("expected job not to be triggered before all upstream jobs completed")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	e.run(&runInfo{e: e, j: b})
+
+	select {
+	case info := <-triggered:
+		expect(t, "triggered by", len(info.TriggeredBy()), 2)
+		if info.TriggeredBy()[0].j != a || info.TriggeredBy()[1].j != b {
+			t.Error("expected run to be triggered by a and b")
+		}
+		if info.TriggeredBy()[1].Err() != upstreamErr {
+			t.Errorf("want upstream error %v, got %v", upstreamErr, info.TriggeredBy()[1].Err())
+		}
+	case <-time.After(gracePeriod):
+		t.Fatal("expected job to be triggered")
+	}
+
+	// replaces a.job
+	cyclic := upstream("a", nil)
+	cyclic.c.DependsOn = []*job.Dependency{{Job: "c", Condition: job.Always}}
+	if err := e.Add(cyclic); err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Errorf("expected dependency cycle to be rejected, got %v", err)
+	}
+}
+
+func TestOverlap(t *testing.T) {
+	tests := []struct {
+		overlap string
+		// number of runs started while the first one is running
+		due int
+		// number of runs that are executed and skipped
+		executed, skipped int
+		// whether the first run is cancelled
+		cancelled bool
+	}{
+		{overlap: "", due: 2, executed: 1, skipped: 2},
+		{overlap: job.OverlapSkip, due: 2, executed: 1, skipped: 2},
+		{overlap: job.OverlapQueue, due: 3, executed: 2, skipped: 2},
+		{overlap: job.OverlapQueueAll, due: 3, executed: 4, skipped: 0},
+		{overlap: job.OverlapCancel, due: 3, executed: 2, skipped: 2, cancelled: true},
+	}
+
+	for _, test := range tests {
+		e, _ := newExecutor(context.TODO(), "")
+		e.maxCompleted = 0
+
+		started := make(chan struct{})
+		release := make(chan struct{})
+		cancelled := make(chan struct{}, 1)
+		first := true
+		j := &jobInfo{
+			file: "test.job",
+			c: &job.Config{
+				Name:    "Test Job",
+				Overlap: test.overlap,
+			},
+			f: func(ctx context.Context) (context.Context, error) {
+				if first {
+					first = false
+					started <- struct{}{}
+					select {
+					case <-release:
+					case <-ctx.Done():
+						cancelled <- struct{}{}
+						// finish only after all due runs have been started
+						<-release
+					}
+					return nil, ctx.Err()
+				}
+				return nil, nil
+			},
+		}
+
+		go e.run(&runInfo{e: e, j: j})
+		<-started
+
+		for i := 0; i < test.due; i++ {
+			e.run(&runInfo{e: e, j: j})
+		}
+
+		if test.cancelled {
+			select {
+			case <-cancelled:
+			case <-time.After(gracePeriod):
+				t.Fatalf("%q: expected the running instance to be cancelled", test.overlap)
+			}
+		} else if queued := len(e.GetQueued()); queued != test.executed-1 {
+			t.Errorf("%q: want %d queued runs, got %d", test.overlap, test.executed-1, queued)
+		}
+		close(release)
+
+		deadline := time.After(gracePeriod)
+		for len(e.GetCompleted()) < test.executed+test.skipped {
+			select {
+			case <-deadline:
+				t.Fatalf("%q: want %d completed runs, got %d", test.overlap, test.executed+test.skipped, len(e.GetCompleted()))
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+
+		var executed, skipped int
+		for _, info := range e.GetCompleted() {
+			switch info.Status() {
+			case statusCompleted:
+				executed++
+			case statusSkipped:
+				skipped++
+			}
+		}
+		expect(t, fmt.Sprintf("%q: executed", test.overlap), executed, test.executed)
+		expect(t, fmt.Sprintf("%q: skipped", test.overlap), skipped, test.skipped)
+	}
+}
+
+func TestRunResult(t *testing.T) {
+	wait := flunc.MakeFlunc(func(ctx context.Context) (context.Context, error) {
+		<-ctx.Done()
+		return nil, nil
+	})
+
+	tests := []struct {
+		name string
+		f    flunc.Flunc
+		want string
+	}{
+		{
+			name: "succeeded",
+			f: func(ctx context.Context) (context.Context, error) {
+				return nil, nil
+			},
+			want: resultSucceeded,
+		},
+		{
+			name: "failed",
+			f: func(ctx context.Context) (context.Context, error) {
+				return nil, errors.New("test error")
+			},
+			want: resultFailed,
+		},
+		{
+			name: "cancelled",
+			f: func(ctx context.Context) (context.Context, error) {
+				ctx, cancel := context.WithCancel(ctx)
+				go cancel()
+				return flunc.Parallel(wait, wait)(ctx)
+			},
+			want: resultCancelled,
+		},
+		{
+			name: "timeout",
+			f: func(ctx context.Context) (context.Context, error) {
+				ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+				defer cancel()
+				return flunc.Sequential(wait, wait)(ctx)
+			},
+			want: resultTimeout,
+		},
+	}
+
+	for _, test := range tests {
+		e, _ := newExecutor(context.TODO(), "")
+		info := &runInfo{e: e, j: &jobInfo{
+			file: "test.job",
+			c:    &job.Config{Name: "Test Job"},
+			f:    test.f,
+		}}
+		e.run(info)
+
+		if got := info.Result(); got != test.want {
+			t.Errorf("%s: want %s, got %s (%v)", test.name, test.want, got, info.Err())
+		}
+		if (info.Err() == nil) != (test.want == resultSucceeded) {
+			t.Errorf("%s: unexpected error %v", test.name, info.Err())
+		}
+	}
+}
+
+func TestConcurrencyLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		maxJobs int
+		a, b    []string
+		// whether the run of b has to wait for a
+		queued bool
+	}{
+		{name: "unlimited", queued: false},
+		{name: "max jobs", maxJobs: 1, queued: true},
+		{name: "same lock", a: []string{"db"}, b: []string{"web", "db"}, queued: true},
+		{name: "different locks", a: []string{"db"}, b: []string{"web"}, queued: false},
+	}
+
+	for _, test := range tests {
+		e, _ := newExecutor(context.TODO(), "")
+		e.limits = newLimits(test.maxJobs)
+
+		release := make(chan struct{})
+		started := make(chan string, 2)
+		newJob := func(name string, locks []string) *jobInfo {
+			return &jobInfo{
+				file: name + ".job",
+				c: &job.Config{
+					Name:  name,
+					Locks: locks,
+				},
+				f: func(ctx context.Context) (context.Context, error) {
+					started <- name
+					<-release
+					return nil, nil
+				},
+			}
+		}
+
+		go e.run(&runInfo{e: e, j: newJob("a", test.a)})
+		<-started
+		go e.run(&runInfo{e: e, j: newJob("b", test.b)})
+
+		if test.queued {
+			deadline := time.After(gracePeriod)
+			for len(e.GetQueued()) == 0 {
+				select {
+				case <-deadline:
+					t.Fatalf("%s: expected b to be queued", test.name)
+				case <-time.After(time.Millisecond):
+				}
+			}
+			expect(t, test.name+" - running", len(e.GetRunning()), 1)
+			close(release)
+		}
+
+		select {
+		case <-started:
+		case <-time.After(gracePeriod):
+			t.Fatalf("%s: expected b to run", test.name)
+		}
+
+		if !test.queued {
+			expect(t, test.name+" - queued", len(e.GetQueued()), 0)
+			close(release)
+		}
+	}
+}
+
+func TestDrain(t *testing.T) {
+	tests := []struct {
+		name string
+		// whether the running job finishes within the grace period
+		finishes bool
+	}{
+		{"finishes", true},
+		{"cancelled", false},
+	}
+
+	for _, test := range tests {
+		e, _ := newExecutor(context.TODO(), "")
+		e.maxCompleted = 0
+
+		started := make(chan struct{})
+		j := &jobInfo{
+			file: "test.job",
+			c: &job.Config{
+				Name: "Test Job",
+			},
+			f: func(ctx context.Context) (context.Context, error) {
+				close(started)
+				if test.finishes {
+					time.Sleep(10 * time.Millisecond)
+					return nil, nil
+				}
+				<-ctx.Done()
+				return nil, nil
+			},
+		}
+
+		go e.run(&runInfo{e: e, j: j})
+		<-started
+
+		if got := e.Drain(50 * time.Millisecond); got != test.finishes {
+			t.Errorf("%s: want drained %t, got %t", test.name, test.finishes, got)
+		}
+
+		// runs after draining never start
+		e.run(&runInfo{e: e, j: j})
+
+		completed := e.GetCompleted()
+		expect(t, test.name+" - completed", len(completed), 2)
+		if len(completed) != 2 {
+			continue
+		}
+
+		wantReason := ""
+		if !test.finishes {
+			wantReason = reasonShutdown
+		}
+		if reason := completed[0].Reason(); reason != wantReason {
+			t.Errorf("%s: want reason %q, got %q", test.name, wantReason, reason)
+		}
+		if (completed[0].Err() != nil) != !test.finishes {
+			t.Errorf("%s: unexpected error %v", test.name, completed[0].Err())
+		}
+
+		if status, reason := completed[1].Status(), completed[1].Reason(); status != statusSkipped || reason != reasonShutdown {
+			t.Errorf("%s: want run after draining %s with reason %q, got %s with %q", test.name, statusSkipped, reasonShutdown, status, reason)
+		}
+	}
+}
+
+func TestReload(t *testing.T) {
+	const file = "test.job"
+
+	e, _ := newExecutor(context.TODO(), "")
+	var schedules []string
+	e.schedule = func(c *job.Config, f func()) (string, error) {
+		schedules = append(schedules, c.Schedule)
+		return c.Schedule, nil
+	}
+	var removed []string
+	e.remove = func(id string) {
+		removed = append(removed, id)
+	}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	old := &jobInfo{
+		file: file,
+		c: &job.Config{
+			Name:     "Test Job",
+			Schedule: "@hourly",
+		},
+		f: func(ctx context.Context) (context.Context, error) {
+			close(started)
+			select {
+			case <-release:
+			case <-ctx.Done():
+				t.Error("expected the running run not to be cancelled")
+			}
+			return nil, nil
+		},
+	}
+	if err := e.Add(old); err != nil {
+		t.Fatal(err)
+	}
+
+	go e.run(&runInfo{e: e, j: old})
+	<-started
+
+	if err := e.Reload(&jobInfo{
+		file: file,
+		c: &job.Config{
+			Name:     "Test Job",
+			Schedule: "@daily",
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	expectExecutor(t, e, "reloaded", 0, 1, 1, 0)
+	if got := strings.Join(schedules, " "); got != "@hourly @daily" {
+		t.Errorf("want schedules %q, got %q", "@hourly @daily", got)
+	}
+	if got := strings.Join(removed, " "); got != "@hourly" {
+		t.Errorf("want removed %q, got %q", "@hourly", got)
+	}
+	close(release)
+}
+
+func TestReloadOnce(t *testing.T) {
+	e, _ := newExecutor(context.TODO(), "")
+
+	var runs int32
+	done := make(chan struct{}, 2)
+	j := &jobInfo{
+		file: "test.job",
+		c: &job.Config{
+			Name:     "Test Job",
+			Schedule: "once",
+		},
+		f: func(ctx context.Context) (context.Context, error) {
+			atomic.AddInt32(&runs, 1)
+			done <- struct{}{}
+			return nil, nil
+		},
+	}
+	if err := e.Add(j); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(gracePeriod):
+		t.Fatal("expected job to be run immediatelly")
+	}
+
+	if err := e.Reload(j); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-done:
+		t.Error("expected the job not to be run again")
+	case <-time.After(100 * time.Millisecond):
+	}
+	expect(t, "runs", int(atomic.LoadInt32(&runs)), 1)
+}
+
+func TestParseAbstract(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xCUTEr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	base := filepath.Join(dir, "base.job")
+	// incomplete, there is no command
+	if err := ioutil.WriteFile(base, []byte(`{"abstract": true, "schedule": "@hourly", "host": {"addr": "localhost"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	web := filepath.Join(dir, "web.job")
+	if err := ioutil.WriteFile(web, []byte(`{"name": "web", "extends": "base.job", "command": {"command": "true"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	e, _ := newExecutor(context.TODO(), "")
+	if _, err := e.parse(base); err != errAbstract {
+		t.Errorf("want %v, got %v", errAbstract, err)
+	}
+
+	j, err := e.parse(web)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j.c.Abstract {
+		t.Error("expected the extending job not to be abstract")
+	}
+}
+
+func TestParseVars(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xCUTEr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "deploy.job")
+	config := `{"name": "deploy", "schedule": "@hourly", "host": {"addr": "localhost"}, "vars": {"version": {}}, "command": {"command": "true"}}`
+	if err := ioutil.WriteFile(file, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	e, _ := newExecutor(context.TODO(), "")
+	e.schedule = func(c *job.Config, f func()) (string, error) {
+		return "TEST-ID", nil
+	}
+	e.vars = map[string]string{"version": "1.2.3", "verison": "1.2.4"}
+
+	j, err := e.parse(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Add(j); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(e.undeclaredVars(), " "); got != "verison" {
+		t.Errorf("want undeclared variables %q, got %q", "verison", got)
+	}
+
+	e.strictVars = true
+	if _, err := e.parse(file); err == nil || !strings.Contains(err.Error(), "verison") {
+		t.Errorf("expected an error for the undeclared variable, got %v", err)
+	}
+}
@@ -6,10 +6,45 @@ package flunc
 
 import (
 	"context"
+	"errors"
 
 	errs "github.com/pkg/errors"
 )
 
+var (
+	// ErrCancelled is the cause of errors of Fluncs, that stopped because
+	// their context has been cancelled.
+	ErrCancelled = errors.New("cancelled")
+
+	// ErrTimeout is the cause of errors of Fluncs, that stopped because the
+	// deadline of their context has been exceeded.
+	ErrTimeout = errors.New("timed out")
+)
+
+// ContextErr returns ErrTimeout if the deadline of the context has been
+// exceeded, ErrCancelled if it has been cancelled otherwise and nil if it
+// is not done.
+func ContextErr(ctx context.Context) error {
+	switch ctx.Err() {
+	case nil:
+		return nil
+	case context.DeadlineExceeded:
+		return ErrTimeout
+	default:
+		return ErrCancelled
+	}
+}
+
+// IsCancelled reports whether err has been caused by a cancelled context.
+func IsCancelled(err error) bool {
+	return err != nil && errs.Cause(err) == ErrCancelled
+}
+
+// IsTimeout reports whether err has been caused by an exceeded deadline.
+func IsTimeout(err error) bool {
+	return err != nil && errs.Cause(err) == ErrTimeout
+}
+
 // A Flunc is a function that is able to run in a given context. It may
 // manipulate the context by returning a new one.
 type Flunc func(context.Context) (context.Context, error)
@@ -18,13 +53,14 @@ type Flunc func(context.Context) (context.Context, error)
 // are propagated to later running Fluncs.
 //
 // If a Flunc returns an error, execution of following Fluncs is canceled and
-// the error is returned to the calling Flunc.
+// the error is returned to the calling Flunc. If the context is done before
+// all Fluncs ran, an error caused by ErrCancelled or ErrTimeout is returned.
 func Sequential(children ...Flunc) Flunc {
 	return func(ctx context.Context) (context.Context, error) {
 		for i, child := range children {
 			select {
 			case <-ctx.Done():
-				return nil, ctx.Err()
+				return nil, errs.Wrapf(ContextErr(ctx), "sequential flunc, child %d not started", i)
 			default:
 			}
 
@@ -56,11 +92,14 @@ func Sequential(children ...Flunc) Flunc {
 //
 // If more than one Flunc errors at a time, there is a race, which error gets to
 // read first. Later errors will be lost.
+//
+// If the context is done before all Fluncs finished, an error caused by
+// ErrCancelled or ErrTimeout is returned.
 func Parallel(children ...Flunc) Flunc {
 	return func(ctx context.Context) (context.Context, error) {
 		select {
 		case <-ctx.Done():
-			return nil, nil
+			return nil, errs.Wrap(ContextErr(ctx), "parallel flunc not started")
 		default:
 		}
 
@@ -91,7 +130,7 @@ func Parallel(children ...Flunc) Flunc {
 					return nil, err
 				}
 			case <-ctx.Done():
-				return nil, ctx.Err()
+				return nil, errs.Wrap(ContextErr(ctx), "parallel flunc")
 			}
 		}
 
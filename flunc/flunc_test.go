@@ -9,6 +9,7 @@ import (
 	"errors"
 	"sync/atomic"
 	"testing"
+	"time"
 )
 
 var (
@@ -229,3 +230,125 @@ func TestParallelContext(t *testing.T) {
 		t.Fatalf("want: %#v: got: %#v", nil, ctx)
 	}
 }
+
+// doneTests are contexts, that are done either by cancellation or by an
+// exceeded deadline, along with the check for the error they cause.
+var doneTests = []struct {
+	name string
+	// ctx returns a context, that is done after calling done
+	ctx func() (ctx context.Context, done func())
+	is  func(error) bool
+}{
+	{
+		name: "cancelled",
+		ctx: func() (context.Context, func()) {
+			return context.WithCancel(context.Background())
+		},
+		is: IsCancelled,
+	},
+	{
+		name: "timeout",
+		ctx: func() (context.Context, func()) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			go func() {
+				<-ctx.Done()
+				cancel()
+			}()
+			return ctx, func() { <-ctx.Done() }
+		},
+		is: IsTimeout,
+	},
+}
+
+func TestContextErr(t *testing.T) {
+	if err := ContextErr(context.Background()); err != nil {
+		t.Fatalf("want: %#v: got: %#v", nil, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := ContextErr(ctx); err != ErrCancelled {
+		t.Fatalf("want: %#v: got: %#v", ErrCancelled, err)
+	}
+
+	ctx, cancel = context.WithDeadline(context.Background(), time.Now())
+	defer cancel()
+	if err := ContextErr(ctx); err != ErrTimeout {
+		t.Fatalf("want: %#v: got: %#v", ErrTimeout, err)
+	}
+
+	if IsCancelled(errTest) || IsTimeout(errTest) || IsCancelled(nil) || IsTimeout(nil) {
+		t.Fatal("expected other errors not to be a cancellation or timeout")
+	}
+}
+
+func TestSequentialDone(t *testing.T) {
+	for _, test := range doneTests {
+		ctx, done := test.ctx()
+
+		f := Sequential(
+			func(ctx context.Context) (context.Context, error) {
+				done()
+				return nil, nil
+			},
+
+			func(ctx context.Context) (context.Context, error) {
+				t.Fatalf("%s: expected not to be called", test.name)
+				return nil, nil
+			},
+		)
+
+		if _, err := f(ctx); !test.is(err) {
+			t.Errorf("%s: got: %#v", test.name, err)
+		}
+	}
+}
+
+func TestParallelDone(t *testing.T) {
+	for _, test := range doneTests {
+		ctx, done := test.ctx()
+		done()
+
+		f := Parallel(
+			func(ctx context.Context) (context.Context, error) {
+				t.Fatalf("%s: expected not to be called", test.name)
+				return nil, nil
+			},
+		)
+
+		if _, err := f(ctx); !test.is(err) {
+			t.Errorf("%s, before start: got: %#v", test.name, err)
+		}
+
+		ctx, done = test.ctx()
+		block := make(chan struct{})
+		f = Parallel(
+			func(ctx context.Context) (context.Context, error) {
+				done()
+				return nil, nil
+			},
+
+			func(ctx context.Context) (context.Context, error) {
+				<-block
+				return nil, nil
+			},
+		)
+
+		if _, err := f(ctx); !test.is(err) {
+			t.Errorf("%s, while running: got: %#v", test.name, err)
+		}
+		close(block)
+	}
+}
+
+func TestParallelTimeoutChild(t *testing.T) {
+	f := Parallel(
+		func(ctx context.Context) (context.Context, error) {
+			return nil, ErrTimeout
+		},
+	)
+
+	if _, err := f(context.Background()); !IsTimeout(err) {
+		t.Fatalf("want: %#v: got: %#v", ErrTimeout, err)
+	}
+}
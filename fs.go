@@ -8,7 +8,9 @@ import (
 	"context"
 	"io/ioutil"
 	"log"
+	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/fsnotify/fsnotify"
 )
@@ -17,13 +19,23 @@ type watcher struct {
 	path string
 }
 
-func (w *watcher) watch(ctx context.Context, events chan<- fsnotify.Event) {
-	files, err := ioutil.ReadDir(w.path)
+// jobFiles returns the paths of all job files in the directory.
+func jobFiles(dir string) ([]string, error) {
+	files, err := ioutil.ReadDir(dir)
 	if err != nil {
-		log.Println(err)
-		return
+		return nil, err
+	}
+
+	var paths []string
+	for _, file := range files {
+		if strings.HasSuffix(file.Name(), ".job") {
+			paths = append(paths, filepath.Join(dir, file.Name()))
+		}
 	}
+	return paths, nil
+}
 
+func (w *watcher) watch(ctx context.Context, events chan<- fsnotify.Event) {
 	fsWatcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		log.Println(err)
@@ -32,16 +44,6 @@ func (w *watcher) watch(ctx context.Context, events chan<- fsnotify.Event) {
 
 	fsWatcher.Add(w.path)
 
-	// generate an event for every existing file
-	for _, file := range files {
-		if strings.HasSuffix(file.Name(), ".job") {
-			events <- fsnotify.Event{
-				Name: file.Name(),
-				Op:   fsnotify.Create,
-			}
-		}
-	}
-
 	for {
 		select {
 		case event := <-fsWatcher.Events:
@@ -55,3 +57,119 @@ func (w *watcher) watch(ctx context.Context, events chan<- fsnotify.Event) {
 		}
 	}
 }
+
+// dependencyWatcher watches files that jobs depend on, e.g. hosts files, and
+// reports the job files that depend on a changed file.
+type dependencyWatcher struct {
+	fsWatcher *fsnotify.Watcher
+
+	// Job files by dependency.
+	deps map[string]map[string]struct{}
+	// Watched directories.
+	dirs map[string]struct{}
+	m    sync.Mutex
+}
+
+func newDependencyWatcher() (*dependencyWatcher, error) {
+	fsWatcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	return &dependencyWatcher{
+		fsWatcher: fsWatcher,
+		deps:      make(map[string]map[string]struct{}),
+		dirs:      make(map[string]struct{}),
+	}, nil
+}
+
+// set replaces the dependencies of the job file.
+func (d *dependencyWatcher) set(jobFile string, deps []string) {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	d.removeLocked(jobFile)
+
+	for _, dep := range deps {
+		path, err := filepath.Abs(dep)
+		if err != nil {
+			log.Println("unable to watch", dep, err)
+			continue
+		}
+
+		// watch the directory instead of the file itself, because editors
+		// tend to replace files instead of writing to them
+		dir := filepath.Dir(path)
+		if _, ok := d.dirs[dir]; !ok {
+			if err := d.fsWatcher.Add(dir); err != nil {
+				log.Println("unable to watch", dir, err)
+				continue
+			}
+			d.dirs[dir] = struct{}{}
+		}
+
+		jobs, ok := d.deps[path]
+		if !ok {
+			jobs = make(map[string]struct{})
+			d.deps[path] = jobs
+		}
+		jobs[jobFile] = struct{}{}
+	}
+}
+
+// remove removes all dependencies of the job file.
+func (d *dependencyWatcher) remove(jobFile string) {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	d.removeLocked(jobFile)
+}
+
+func (d *dependencyWatcher) removeLocked(jobFile string) {
+	for path, jobs := range d.deps {
+		delete(jobs, jobFile)
+		if len(jobs) == 0 {
+			delete(d.deps, path)
+		}
+	}
+}
+
+// dependents returns all job files that depend on the file.
+func (d *dependencyWatcher) dependents(file string) []string {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	path, err := filepath.Abs(file)
+	if err != nil {
+		return nil
+	}
+
+	var jobFiles []string
+	for jobFile := range d.deps[path] {
+		jobFiles = append(jobFiles, jobFile)
+	}
+	return jobFiles
+}
+
+// watch sends every job file that depends on a changed file to jobFiles.
+func (d *dependencyWatcher) watch(ctx context.Context, jobFiles chan<- string) {
+	defer d.fsWatcher.Close()
+
+	for {
+		select {
+		case event := <-d.fsWatcher.Events:
+			for _, jobFile := range d.dependents(event.Name) {
+				log.Println(event.Name, "changed, reloading", jobFile)
+				select {
+				case jobFiles <- jobFile:
+				case <-ctx.Done():
+					return
+				}
+			}
+		case err := <-d.fsWatcher.Errors:
+			log.Println(err)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright (c) 2016 Niklas Wolber
+// This file is licensed under the MIT license.
+// See the LICENSE file for more information.
+
+package xCUTEr
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDependencyWatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xCUTEr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	hostsFile := filepath.Join(dir, "hosts.json")
+	if err := ioutil.WriteFile(hostsFile, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := newDependencyWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	jobFiles := make(chan string)
+	go d.watch(ctx, jobFiles)
+
+	d.set("a.job", []string{hostsFile})
+	d.set("b.job", []string{hostsFile})
+	d.remove("b.job")
+
+	if got := len(d.dependents(hostsFile)); got != 1 {
+		t.Fatalf("want 1 dependent job, got %d", got)
+	}
+
+	if err := ioutil.WriteFile(hostsFile, []byte(`{"a": {}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case file := <-jobFiles:
+		if file != "a.job" {
+			t.Errorf("want a.job, got %s", file)
+		}
+	case <-time.After(gracePeriod):
+		t.Error("expected dependent job to be reported")
+	}
+}
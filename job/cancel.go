@@ -0,0 +1,193 @@
+// Copyright (c) 2016 Niklas Wolber
+// This file is licensed under the MIT license.
+// See the LICENSE file for more information.
+
+package job
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nwolber/xCUTEr/logger"
+	errs "github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	defaultCancelSignal = ssh.SIGTERM
+	defaultKillAfter    = 5 * time.Second
+
+	// pgidMarker prefixes the process group id a remote command reports on
+	// stderr, if its process group is killed on cancellation.
+	pgidMarker = "xCUTEr-pgid:"
+)
+
+var signals = map[string]ssh.Signal{
+	"ABRT": ssh.SIGABRT,
+	"ALRM": ssh.SIGALRM,
+	"FPE":  ssh.SIGFPE,
+	"HUP":  ssh.SIGHUP,
+	"ILL":  ssh.SIGILL,
+	"INT":  ssh.SIGINT,
+	"KILL": ssh.SIGKILL,
+	"PIPE": ssh.SIGPIPE,
+	"QUIT": ssh.SIGQUIT,
+	"SEGV": ssh.SIGSEGV,
+	"TERM": ssh.SIGTERM,
+	"USR1": ssh.SIGUSR1,
+	"USR2": ssh.SIGUSR2,
+}
+
+// Cancellation configures how remote commands are stopped, when the job is
+// cancelled or times out. The signal is sent first. If the command is still
+// running after KillAfter, it is killed.
+type Cancellation struct {
+	// Signal sent first, e.g. TERM or INT. Default is TERM.
+	Signal string `json:"signal,omitempty"`
+	// KillAfter is the time the command gets to exit after the signal.
+	// Default is 5 seconds.
+	KillAfter string `json:"killAfter,omitempty"`
+	// KillGroup signals the whole process group of the command instead of
+	// just the command, so processes it started are stopped as well.
+	// Requires a POSIX shell on the host.
+	KillGroup bool `json:"killGroup,omitempty"`
+}
+
+// validate checks the signal and the grace period.
+func (c *Cancellation) validate() error {
+	if c == nil {
+		return nil
+	}
+
+	if _, ok := signals[strings.TrimPrefix(strings.ToUpper(c.Signal), "SIG")]; c.Signal != "" && !ok {
+		return errs.Errorf("unknown signal %q", c.Signal)
+	}
+
+	if c.KillAfter != "" {
+		if _, err := time.ParseDuration(c.KillAfter); err != nil {
+			return errs.Wrapf(err, "failed to parse killAfter %s", c.KillAfter)
+		}
+	}
+	return nil
+}
+
+func (c *Cancellation) signal() ssh.Signal {
+	if c == nil || c.Signal == "" {
+		return defaultCancelSignal
+	}
+	return signals[strings.TrimPrefix(strings.ToUpper(c.Signal), "SIG")]
+}
+
+func (c *Cancellation) killAfter() time.Duration {
+	if c == nil || c.KillAfter == "" {
+		return defaultKillAfter
+	}
+	d, _ := time.ParseDuration(c.KillAfter)
+	return d
+}
+
+func (c *Cancellation) killGroup() bool {
+	return c != nil && c.KillGroup
+}
+
+// stop signals the remote command and waits for it to exit. If it doesn't
+// exit within the grace period, it is killed.
+func (s *sshClient) stop(l logger.Logger, session *ssh.Session, pgid *pgidWriter, c *Cancellation, done <-chan error) {
+	sigs := []ssh.Signal{c.signal()}
+	if sigs[0] != ssh.SIGKILL {
+		sigs = append(sigs, ssh.SIGKILL)
+	}
+
+	for _, sig := range sigs {
+		s.signal(l, session, pgid, sig)
+
+		select {
+		case <-done:
+			return
+		case <-time.After(c.killAfter()):
+		}
+	}
+	l.Println("remote command still running after", ssh.SIGKILL)
+}
+
+// signal sends the signal either to the process group of the command, if it
+// is known, or to the command itself.
+func (s *sshClient) signal(l logger.Logger, session *ssh.Session, pgid *pgidWriter, sig ssh.Signal) {
+	if id := pgid.id(); id > 0 {
+		l.Printf("sending %s to remote process group %d", sig, id)
+		kill, err := s.c.NewSession()
+		if err == nil {
+			defer kill.Close()
+			err = kill.Run(fmt.Sprintf("kill -%s -- -%d", sig, id))
+		}
+		if err == nil {
+			return
+		}
+		l.Printf("failed to signal remote process group %d: %s", id, err)
+	}
+
+	l.Printf("sending %s to remote command", sig)
+	if err := session.Signal(sig); err != nil {
+		l.Printf("failed to send %s: %s", sig, err)
+	}
+}
+
+// pgidWriter extracts the process group id a command reports on its first
+// line of stderr and passes everything else on.
+type pgidWriter struct {
+	w io.Writer
+
+	m    sync.Mutex
+	buf  []byte
+	done bool
+	pgid int
+}
+
+func (p *pgidWriter) Write(b []byte) (int, error) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	if p.done {
+		return p.w.Write(b)
+	}
+
+	p.buf = append(p.buf, b...)
+	i := bytes.IndexByte(p.buf, '\n')
+	if i < 0 {
+		return len(b), nil
+	}
+
+	p.done = true
+	line, rest := p.buf[:i], p.buf[i+1:]
+	p.buf = nil
+
+	if bytes.HasPrefix(line, []byte(pgidMarker)) {
+		p.pgid, _ = strconv.Atoi(string(line[len(pgidMarker):]))
+	} else {
+		// not our marker, pass it on
+		rest = append(append(line, '\n'), rest...)
+	}
+
+	if len(rest) > 0 {
+		if _, err := p.w.Write(rest); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// id returns the process group id, zero if it is unknown.
+func (p *pgidWriter) id() int {
+	if p == nil {
+		return 0
+	}
+
+	p.m.Lock()
+	defer p.m.Unlock()
+	return p.pgid
+}
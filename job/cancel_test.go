@@ -0,0 +1,223 @@
+// Copyright (c) 2016 Niklas Wolber
+// This file is licensed under the MIT license.
+// See the LICENSE file for more information.
+
+package job
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nwolber/xCUTEr/flunc"
+	"golang.org/x/crypto/ssh"
+)
+
+// newExecServer starts a SSH server that hands exec requests to handle, along
+// with the signals the session receives.
+func newExecServer(t *testing.T, handle func(command string, ch ssh.Channel, signals <-chan string)) string {
+	config := &ssh.ServerConfig{
+		KeyboardInteractiveCallback: func(c ssh.ConnMetadata, client ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+			return nil, nil
+		},
+	}
+
+	key, err := generateSSHKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.AddHostKey(key)
+
+	listener := newLocalListener()
+	go func() {
+		conn, err := listener.Accept()
+		listener.Close()
+		if err != nil {
+			return
+		}
+
+		_, chans, reqs, err := ssh.NewServerConn(conn, config)
+		if err != nil {
+			return
+		}
+		go ssh.DiscardRequests(reqs)
+
+		for newChannel := range chans {
+			ch, reqs, err := newChannel.Accept()
+			if err != nil {
+				continue
+			}
+
+			go func() {
+				signals := make(chan string, 10)
+				for req := range reqs {
+					var payload struct{ Value string }
+					ssh.Unmarshal(req.Payload, &payload)
+
+					switch req.Type {
+					case "exec":
+						req.Reply(true, nil)
+						go func() {
+							handle(payload.Value, ch, signals)
+							ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+							ch.Close()
+						}()
+					case "signal":
+						signals <- payload.Value
+					default:
+						if req.WantReply {
+							req.Reply(false, nil)
+						}
+					}
+				}
+			}()
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+func TestExecuteCommandCancelled(t *testing.T) {
+	tests := []struct {
+		name   string
+		cancel *Cancellation
+		// signal the command exits on
+		exitOn string
+		want   string
+	}{
+		{name: "default", exitOn: "TERM", want: "TERM"},
+		{name: "custom signal", cancel: &Cancellation{Signal: "INT"}, exitOn: "INT", want: "INT"},
+		{name: "kill after", cancel: &Cancellation{KillAfter: "20ms"}, exitOn: "KILL", want: "TERM KILL"},
+	}
+
+	for _, test := range tests {
+		var (
+			m        sync.Mutex
+			received []string
+		)
+		started := make(chan struct{})
+
+		addr := newExecServer(t, func(command string, ch ssh.Channel, signals <-chan string) {
+			close(started)
+			for sig := range signals {
+				m.Lock()
+				received = append(received, sig)
+				m.Unlock()
+				if sig == test.exitOn {
+					return
+				}
+			}
+		})
+
+		client, err := createClient(context.Background(), addr, "user", "", "", map[string]string{"question": "answer"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			<-started
+			cancel()
+		}()
+
+		err = client.executeCommand(ctx, "sleep 3600", nil, nil, test.cancel)
+		client.c.Close()
+		if !flunc.IsCancelled(err) {
+			t.Errorf("%s: want %v, got %v", test.name, flunc.ErrCancelled, err)
+		}
+
+		m.Lock()
+		expect(t, test.want, strings.Join(received, " "))
+		m.Unlock()
+	}
+}
+
+func TestExecuteCommandKillGroup(t *testing.T) {
+	var (
+		m     sync.Mutex
+		kills []string
+	)
+	killed := make(chan struct{})
+	started := make(chan struct{})
+
+	addr := newExecServer(t, func(command string, ch ssh.Channel, signals <-chan string) {
+		if strings.HasPrefix(command, "kill ") {
+			m.Lock()
+			kills = append(kills, command)
+			m.Unlock()
+			close(killed)
+			return
+		}
+
+		if !strings.HasPrefix(command, "echo "+pgidMarker+"$$ >&2; ") {
+			t.Errorf("command doesn't report its process group: %q", command)
+		}
+		ch.Stderr().Write([]byte(pgidMarker + "4242\nstarted\n"))
+		close(started)
+		<-killed
+	})
+
+	client, err := createClient(context.Background(), addr, "user", "", "", map[string]string{"question": "answer"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.c.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		// give the client time to read stderr
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	var stderr bytes.Buffer
+	err = client.executeCommand(ctx, "sleep 3600", nil, &stderr, &Cancellation{KillGroup: true})
+	if !flunc.IsCancelled(err) {
+		t.Errorf("want %v, got %v", flunc.ErrCancelled, err)
+	}
+
+	m.Lock()
+	expect(t, "kill -TERM -- -4242", strings.Join(kills, ", "))
+	m.Unlock()
+	expect(t, "started\n", stderr.String())
+}
+
+func TestPgidWriter(t *testing.T) {
+	tests := []struct {
+		writes []string
+		pgid   int
+		want   string
+	}{
+		{[]string{pgidMarker + "42\nout\n"}, 42, "out\n"},
+		{[]string{pgidMarker, "4", "2\n", "out"}, 42, "out"},
+		{[]string{"no marker\n", "out"}, 0, "no marker\nout"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := &pgidWriter{w: &buf}
+		for _, s := range test.writes {
+			w.Write([]byte(s))
+		}
+		expect(t, test.pgid, w.id())
+		expect(t, test.want, buf.String())
+	}
+}
+
+func TestCancellationValidate(t *testing.T) {
+	for _, c := range []*Cancellation{nil, {}, {Signal: "int"}, {Signal: "SIGHUP", KillAfter: "1m"}} {
+		if err := c.validate(); err != nil {
+			t.Errorf("%+v: %s", c, err)
+		}
+	}
+
+	for _, c := range []*Cancellation{{Signal: "STOP"}, {KillAfter: "soon"}} {
+		if err := c.validate(); err == nil {
+			t.Errorf("%+v: expected an error", c)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2016 Niklas Wolber
+// This file is licensed under the MIT license.
+// See the LICENSE file for more information.
+
+package job
+
+import (
+	"encoding/json"
+	"time"
+
+	errs "github.com/pkg/errors"
+)
+
+// Catch-up policies.
+const (
+	// CatchUpNone doesn't run missed occurrences. This is the default.
+	CatchUpNone = "none"
+	// CatchUpLast runs the latest missed occurrence.
+	CatchUpLast = "last"
+	// CatchUpAll runs all missed occurrences.
+	CatchUpAll = "all"
+)
+
+const (
+	defaultCatchUpWindow = 24 * time.Hour
+	// maxMissed limits the number of missed occurrences that are run.
+	maxMissed = 1000
+)
+
+// CatchUp decides which occurrences of the schedule, that have been missed
+// while xCUTEr was not running, are run on startup.
+type CatchUp struct {
+	// Policy is one of none, last or all.
+	Policy string `json:"policy"`
+	// Only occurrences within the window before startup are run. Default is
+	// 24 hours.
+	Window string `json:"window,omitempty"`
+
+	window time.Duration
+}
+
+// MarshalJSON marshals catch-up options without window in the short form.
+func (c *CatchUp) MarshalJSON() ([]byte, error) {
+	if c.Window == "" {
+		return json.Marshal(c.Policy)
+	}
+
+	type plain CatchUp
+	return json.Marshal((*plain)(c))
+}
+
+// UnmarshalJSON unmarshals CatchUp either from the policy or from an object.
+func (c *CatchUp) UnmarshalJSON(b []byte) error {
+	var policy string
+	if err := json.Unmarshal(b, &policy); err == nil {
+		*c = CatchUp{Policy: policy}
+	} else {
+		type plain CatchUp
+		var p plain
+		if err := json.Unmarshal(b, &p); err != nil {
+			return errs.Wrap(err, "failed to unmarshal catch-up")
+		}
+		*c = CatchUp(p)
+	}
+
+	switch c.Policy {
+	case "":
+		c.Policy = CatchUpNone
+	case CatchUpNone, CatchUpLast, CatchUpAll:
+	default:
+		return errs.Errorf("unknown catch-up policy %q", c.Policy)
+	}
+
+	c.window = defaultCatchUpWindow
+	if c.Window != "" {
+		window, err := time.ParseDuration(c.Window)
+		if err != nil {
+			return errs.Wrapf(err, "failed to parse catch-up window %s", c.Window)
+		}
+		c.window = window
+	}
+	return nil
+}
+
+// Missed returns the occurrences of the schedule between the last run and
+// now, that are run according to the policy. Next returns the next
+// occurrence of the schedule after the given time. If the job never ran,
+// nothing has been missed.
+func (c *CatchUp) Missed(next func(time.Time) time.Time, last, now time.Time) []time.Time {
+	if c == nil || c.Policy == CatchUpNone || last.IsZero() {
+		return nil
+	}
+
+	window := c.window
+	if window == 0 {
+		window = defaultCatchUpWindow
+	}
+	if start := now.Add(-window); last.Before(start) {
+		last = start
+	}
+
+	var missed []time.Time
+	for t := next(last); !t.IsZero() && !t.After(now); t = next(t) {
+		missed = append(missed, t)
+		if len(missed) > maxMissed {
+			missed = missed[1:]
+		}
+	}
+
+	if c.Policy == CatchUpLast && len(missed) > 1 {
+		missed = missed[len(missed)-1:]
+	}
+	return missed
+}
@@ -0,0 +1,79 @@
+// Copyright (c) 2016 Niklas Wolber
+// This file is licensed under the MIT license.
+// See the LICENSE file for more information.
+
+package job
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestUnmarshalCatchUp(t *testing.T) {
+	var c Config
+	if err := json.Unmarshal([]byte(`{"catchUp": "last"}`), &c); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, CatchUpLast, c.CatchUp.Policy)
+	expect(t, defaultCatchUpWindow, c.CatchUp.window)
+
+	if err := json.Unmarshal([]byte(`{"catchUp": {"policy": "all", "window": "2h"}}`), &c); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, CatchUpAll, c.CatchUp.Policy)
+	expect(t, 2*time.Hour, c.CatchUp.window)
+
+	b, err := json.Marshal(c.CatchUp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, `{"policy":"all","window":"2h"}`, string(b))
+
+	for _, invalid := range []string{
+		`{"catchUp": "sometimes"}`,
+		`{"catchUp": {"policy": "all", "window": "forever"}}`,
+	} {
+		if err := json.Unmarshal([]byte(invalid), &c); err == nil {
+			t.Errorf("%s: expected an error", invalid)
+		}
+	}
+}
+
+func TestCatchUpMissed(t *testing.T) {
+	hourly := func(t time.Time) time.Time {
+		return t.Truncate(time.Hour).Add(time.Hour)
+	}
+
+	now := time.Date(2016, 12, 24, 10, 30, 0, 0, time.UTC)
+	last := time.Date(2016, 12, 24, 6, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		catchUp *CatchUp
+		last    time.Time
+		want    []int
+	}{
+		{"no catch-up", nil, last, nil},
+		{"none", &CatchUp{Policy: CatchUpNone}, last, nil},
+		{"never ran", &CatchUp{Policy: CatchUpAll}, time.Time{}, nil},
+		{"all", &CatchUp{Policy: CatchUpAll}, last, []int{7, 8, 9, 10}},
+		{"last", &CatchUp{Policy: CatchUpLast}, last, []int{10}},
+		{"window", &CatchUp{Policy: CatchUpAll, window: 2 * time.Hour}, last, []int{9, 10}},
+		{"nothing missed", &CatchUp{Policy: CatchUpAll}, now.Add(-time.Minute), nil},
+	}
+
+	for _, test := range tests {
+		missed := test.catchUp.Missed(hourly, test.last, now)
+		if len(missed) != len(test.want) {
+			t.Errorf("%s: want %d missed runs, got %v", test.name, len(test.want), missed)
+			continue
+		}
+
+		for i, hour := range test.want {
+			if missed[i].Hour() != hour {
+				t.Errorf("%s: want missed run at %d:00, got %s", test.name, hour, missed[i])
+			}
+		}
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
 	"sync"
@@ -16,6 +17,7 @@ import (
 
 	"golang.org/x/crypto/ssh"
 
+	"github.com/nwolber/xCUTEr/flunc"
 	"github.com/nwolber/xCUTEr/logger"
 	errs "github.com/pkg/errors"
 )
@@ -26,9 +28,14 @@ type storeElement struct {
 	lastUsed time.Time
 }
 
+// jumpClientKey is used to pass a connected jump host to newSSHClient.
+const jumpClientKey contextKey = "jumpClient"
+
 type sshClientStore struct {
 	clients map[string]*storeElement
-	m       sync.Mutex
+	// session slots by host, shared by all jobs
+	sessions map[string]chan struct{}
+	m        sync.Mutex
 }
 
 var (
@@ -40,13 +47,19 @@ var (
 	// Changes to the time interval only apply to newly
 	// created connections.
 	KeepAliveInterval = 30 * time.Second
+
+	// MaxSessionsPerHost limits the number of concurrent sessions per host
+	// across all jobs. Zero means unlimited. Changes only apply to hosts
+	// without sessions so far.
+	MaxSessionsPerHost = 0
 )
 
 // InitializeSSHClientStore initialies the global SSH connection store and
 // sets the time-to-live for unused connections.
 func InitializeSSHClientStore(ttl time.Duration) {
 	store = &sshClientStore{
-		clients: make(map[string]*storeElement),
+		clients:  make(map[string]*storeElement),
+		sessions: make(map[string]chan struct{}),
 	}
 
 	// This go routine runs for the lifetime of the program.
@@ -91,6 +104,9 @@ func newSSHClient(ctx context.Context, addr, user, keyFile, password string, key
 	}
 
 	key := fmt.Sprintf("%s@%s", user, addr)
+	if jump, ok := ctx.Value(jumpClientKey).(*sshClient); ok && jump != nil {
+		key = fmt.Sprintf("%s via %s@%s", key, jump.c.User(), jump.c.RemoteAddr())
+	}
 
 	// lock store only briefly while finding out if there is an existing client
 	// thus creation of a new client won't block all other client requests
@@ -158,6 +174,7 @@ func newSSHClient(ctx context.Context, addr, user, keyFile, password string, key
 		l.Println("reusing existing connection to", key)
 	}
 
+	elem.client.host = addr
 	elem.ref++
 	elem.lastUsed = time.Now()
 	l.Println("incrementing ref counter for", key, "new value:", elem.ref)
@@ -183,6 +200,45 @@ func newSSHClient(ctx context.Context, addr, user, keyFile, password string, key
 type sshClient struct {
 	c       *ssh.Client
 	trashed chan struct{}
+	// host the client is connected to, used to limit sessions per host,
+	// guarded by the mutex of the store
+	host string
+}
+
+// acquireSession waits for a free session slot on the host. It returns a
+// function to release the slot, or an error if the context is done first.
+func (s *sshClient) acquireSession(ctx context.Context, l logger.Logger) (func(), error) {
+	if MaxSessionsPerHost <= 0 || store == nil {
+		return func() {}, nil
+	}
+
+	store.m.Lock()
+	host := s.host
+	if host == "" {
+		store.m.Unlock()
+		return func() {}, nil
+	}
+
+	slots, ok := store.sessions[host]
+	if !ok {
+		slots = make(chan struct{}, MaxSessionsPerHost)
+		store.sessions[host] = slots
+	}
+	store.m.Unlock()
+
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	default:
+	}
+
+	l.Println("waiting for a free session on", host)
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
 }
 
 var createClient = func(ctx context.Context, addr, user, keyFile, password string, keyboardInteractive map[string]string) (*sshClient, error) {
@@ -223,10 +279,27 @@ var createClient = func(ctx context.Context, addr, user, keyFile, password strin
 		config.Auth = append(config.Auth, ssh.KeyboardInteractive(keyboardInteractiveChallenge(user, keyboardInteractive)))
 	}
 
-	l.Println("no existing connection, connecting to", addr)
-	client, err := ssh.Dial("tcp", addr, config)
-	if err != nil {
-		return nil, errs.Wrapf(err, "failed to dial SSH %s", addr)
+	var client *ssh.Client
+	if jump, ok := ctx.Value(jumpClientKey).(*sshClient); ok && jump != nil {
+		l.Println("no existing connection, connecting to", addr, "via", jump.c.RemoteAddr())
+		conn, err := jump.c.Dial("tcp", addr)
+		if err != nil {
+			return nil, errs.Wrapf(err, "failed to dial %s via jump host %s", addr, jump.c.RemoteAddr())
+		}
+
+		c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+		if err != nil {
+			conn.Close()
+			return nil, errs.Wrapf(err, "failed to establish SSH connection to %s via jump host %s", addr, jump.c.RemoteAddr())
+		}
+		client = ssh.NewClient(c, chans, reqs)
+	} else {
+		l.Println("no existing connection, connecting to", addr)
+		var err error
+		client, err = ssh.Dial("tcp", addr, config)
+		if err != nil {
+			return nil, errs.Wrapf(err, "failed to dial SSH %s", addr)
+		}
 	}
 
 	l.Println("connected to", addr)
@@ -252,7 +325,10 @@ func keyboardInteractiveChallenge(user string, keyboardInteractive map[string]st
 	}
 }
 
-func (s *sshClient) executeCommand(ctx context.Context, command string, stdout, stderr io.Writer) error {
+// executeCommand runs the command on the host. If the context is done
+// before the command finishes, the command is stopped as configured by c and
+// an error caused by flunc.ErrCancelled or flunc.ErrTimeout is returned.
+func (s *sshClient) executeCommand(ctx context.Context, command string, stdout, stderr io.Writer, c *Cancellation) error {
 	l, ok := ctx.Value(LoggerKey).(logger.Logger)
 	if !ok || l == nil {
 		l = logger.New(log.New(os.Stderr, "", log.LstdFlags), false)
@@ -261,10 +337,17 @@ func (s *sshClient) executeCommand(ctx context.Context, command string, stdout,
 	select {
 	case <-ctx.Done():
 		l.Printf("won't execute %q because context is done", command)
-		return nil
+		return errs.Wrapf(flunc.ContextErr(ctx), "%q", command)
 	default:
 	}
 
+	release, err := s.acquireSession(ctx, l)
+	if err != nil {
+		l.Printf("won't execute %q because context is done", command)
+		return errs.Wrapf(flunc.ContextErr(ctx), "%q", command)
+	}
+	defer release()
+
 	session, err := s.c.NewSession()
 	if err != nil {
 		err = errs.Wrap(err, "failed to create session")
@@ -281,22 +364,37 @@ func (s *sshClient) executeCommand(ctx context.Context, command string, stdout,
 		session.Stderr = stderr
 	}
 
+	remote := command
+	var pgid *pgidWriter
+	if c.killGroup() {
+		// the shell started by the SSH server leads the process group
+		if stderr == nil {
+			stderr = ioutil.Discard
+		}
+		pgid = &pgidWriter{w: stderr}
+		session.Stderr = pgid
+		remote = fmt.Sprintf("echo %s$$ >&2; %s", pgidMarker, command)
+	}
+
 	l.Printf("executing %q", command)
-	if err := session.Start(command); err != nil {
+	if err := session.Start(remote); err != nil {
 		err = errs.Wrapf(err, "failed to start %q", command)
 		l.Error(err)
 		return err
 	}
 
-	done := make(chan error)
+	done := make(chan error, 1)
 	go func() {
 		done <- session.Wait()
 	}()
 
 	select {
 	case <-ctx.Done():
-		l.Println("closing session, context done")
-		return nil
+		l.Printf("context done, stopping %q", command)
+		s.stop(l, session, pgid, c, done)
+		err := errs.Wrapf(flunc.ContextErr(ctx), "%q", command)
+		l.Error(err)
+		return err
 	case err, _ := <-done:
 		if err != nil {
 			err = errs.Wrapf(err, "failed to execute %q", command)
@@ -7,12 +7,15 @@ import (
 	"crypto/rand"
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"log"
 	"net"
 	"os"
 	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/nwolber/xCUTEr/logger"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -393,3 +396,37 @@ func TestKeepalive(t *testing.T) {
 		t.Fatal("grace period ran out, server didn't receive a keep-alive")
 	}
 }
+
+func TestAcquireSession(t *testing.T) {
+	MaxSessionsPerHost = 1
+	defer func() { MaxSessionsPerHost = 0 }()
+
+	l := logger.New(log.New(ioutil.Discard, "", 0), false)
+	a := &sshClient{host: "limited:22"}
+	b := &sshClient{host: "limited:22"}
+
+	release, err := a.acquireSession(context.Background(), l)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := b.acquireSession(ctx, l); err != context.DeadlineExceeded {
+		t.Errorf("want %v while host is busy, got %v", context.DeadlineExceeded, err)
+	}
+
+	other, err := (&sshClient{host: "other:22"}).acquireSession(ctx, l)
+	if err != nil {
+		t.Fatalf("want no limit across hosts, got %v", err)
+	}
+	// slots are kept in the client store, free them for later tests
+	defer other()
+
+	release()
+	release, err = b.acquireSession(context.Background(), l)
+	if err != nil {
+		t.Fatalf("want session after release, got %v", err)
+	}
+	release()
+}
@@ -7,36 +7,76 @@ package job
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
+	"os/exec"
 	"regexp"
+	"sort"
 	"strings"
 	"text/template"
 	"time"
 
+	shellwords "github.com/mattn/go-shellwords"
 	errs "github.com/pkg/errors"
 )
 
 // Config is the in-memory representation of a job configuration.
 type Config struct {
-	Name       string           `json:"name,omitempty"`
-	Schedule   string           `json:"schedule,omitempty"`
-	Timeout    string           `json:"timeout,omitempty"`
-	Telemetry  bool             `json:"telemetry,omitempty"`
-	Output     *Output          `json:"output,omitempty"`
-	Host       *Host            `json:"host,omitempty"`
-	HostsFile  hostsFileOrArray `json:"hosts,omitempty"`
-	Pre        *Command         `json:"pre,omitempty"`
-	Command    *Command         `json:"command,omitempty"`
-	Post       *Command         `json:"post,omitempty"`
-	Forwarding *Forwarding      `json:"forwarding,omitempty"`
-	Tunnel     *Forwarding      `json:"tunnel,omitempty"`
-	SCP        *ScpData         `json:"scp,omitempty"`
+	Name         string           `json:"name,omitempty"`
+	Abstract     bool             `json:"abstract,omitempty"`
+	Schedule     string           `json:"schedule,omitempty"`
+	Overlap      string           `json:"overlap,omitempty"`
+	CatchUp      *CatchUp         `json:"catchUp,omitempty"`
+	Timezone     string           `json:"timezone,omitempty"`
+	Calendar     string           `json:"calendar,omitempty"`
+	Blackouts    []*Window        `json:"blackouts,omitempty"`
+	BusinessDays string           `json:"businessDays,omitempty"`
+	Jitter       string           `json:"jitter,omitempty"`
+	Splay        string           `json:"splay,omitempty"`
+	Timeout      string           `json:"timeout,omitempty"`
+	Cancel       *Cancellation    `json:"cancel,omitempty"`
+	Telemetry    bool             `json:"telemetry,omitempty"`
+	Output       *Output          `json:"output,omitempty"`
+	Host         *Host            `json:"host,omitempty"`
+	HostsFile    hostsFileOrArray `json:"hosts,omitempty"`
+	Pre          *Command         `json:"pre,omitempty"`
+	Command      *Command         `json:"command,omitempty"`
+	Post         *Command         `json:"post,omitempty"`
+	Forwarding   *Forwarding      `json:"forwarding,omitempty"`
+	Tunnel       *Forwarding      `json:"tunnel,omitempty"`
+	SCP          *ScpData         `json:"scp,omitempty"`
+	Redact       redactPatterns   `json:"redact,omitempty"`
+	Vars         jobVars          `json:"vars,omitempty"`
+	Facts        bool             `json:"facts,omitempty"`
+	Import       []string         `json:"import,omitempty"`
+	DependsOn    []*Dependency    `json:"dependsOn,omitempty"`
+	Locks        []string         `json:"locks,omitempty"`
+
+	// libraries imported by the job, directly or indirectly
+	libraries []string
+	// base jobs the job extends, directly or indirectly
+	bases []string
 }
 
+// Overlap policies decide what happens, if a job is due while its previous
+// run is still running.
+const (
+	// OverlapSkip skips the new run. This is the default.
+	OverlapSkip = "skip"
+	// OverlapQueue runs the new run after the running one. Only a single run
+	// is queued, further runs are skipped.
+	OverlapQueue = "queue"
+	// OverlapQueueAll queues all runs.
+	OverlapQueueAll = "queueAll"
+	// OverlapCancel cancels the running run and starts the new one.
+	OverlapCancel = "cancel"
+)
+
 func (c *Config) String() string {
 	s, err := c.Tree(true, false, 1, 0)
 	if err != nil {
@@ -69,6 +109,33 @@ func (c *Config) Tree(full, raw bool, maxHosts, maxCommands int) (string, error)
 	}), nil
 }
 
+// DynamicHosts returns true if the hosts of the Config may change between two
+// runs of the job, because they are read from hosts files or generated by
+// commands. Those hosts have to be resolved at the start of every run.
+func (c *Config) DynamicHosts() bool {
+	return len(c.HostsFile) > 0
+}
+
+// Dependencies returns all files, besides the job file itself, the Config
+// depends on, such as base jobs, hosts files, OpenSSH client configs and the
+// files they include, libraries and the calendar.
+func (c *Config) Dependencies() []string {
+	files := append(append([]string(nil), c.bases...), c.libraries...)
+	if c.Calendar != "" {
+		files = append(files, c.Calendar)
+	}
+	for _, file := range c.HostsFile {
+		if file.File != "" {
+			files = append(files, file.File)
+		}
+
+		if file.SSHConfig != "" {
+			files = append(files, sshConfigFiles(file.SSHConfig)...)
+		}
+	}
+	return files
+}
+
 // JSON generates the Config's JSON representation.
 func (c *Config) JSON() string {
 	b, err := json.MarshalIndent(c, "", "\t")
@@ -82,11 +149,26 @@ func (c *Config) JSON() string {
 type hostConfig map[string]*Host
 
 type hostsFile struct {
-	File        string `json:"file,omitempty"`
-	Pattern     string `json:"pattern,omitempty"`
-	MatchString string `json:"matchString,omitempty"`
+	File        string            `json:"file,omitempty"`
+	Exec        string            `json:"exec,omitempty"`
+	SSHConfig   string            `json:"sshConfig,omitempty"`
+	Timeout     string            `json:"timeout,omitempty"`
+	Hosts       []*Host           `json:"hosts,omitempty"`
+	Pattern     string            `json:"pattern,omitempty"`
+	MatchString string            `json:"matchString,omitempty"`
+	Exclude     string            `json:"exclude,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	Groups      []string          `json:"groups,omitempty"`
+	Op          string            `json:"op,omitempty"`
 }
 
+const (
+	unionOp        = "union"
+	intersectionOp = "intersection"
+
+	defaultExecTimeout = time.Minute
+)
+
 type hostsFileOrArray []*hostsFile
 
 func (f hostsFileOrArray) MarshalJSON() ([]byte, error) {
@@ -100,19 +182,26 @@ func (f hostsFileOrArray) MarshalJSON() ([]byte, error) {
 	}
 }
 
-func (f hostsFileOrArray) UnmarshalJSON(b []byte) error {
+// UnmarshalJSON unmarshals either a single hosts file structure or an array
+// of hosts file structures.
+func (f *hostsFileOrArray) UnmarshalJSON(b []byte) error {
+	if bytes.Equal(bytes.TrimSpace(b), []byte("null")) {
+		*f = nil
+		return nil
+	}
+
 	var file hostsFile
 	if err := json.Unmarshal(b, &file); err == nil {
-		f = append(f, &file)
+		*f = hostsFileOrArray{&file}
 		return nil
 	}
 
 	var arr []*hostsFile
 	if err := json.Unmarshal(b, &arr); err != nil {
-		return err
+		return errs.Wrap(err, "failed to unmarshal hosts")
 	}
 
-	f = arr
+	*f = arr
 	return nil
 }
 
@@ -124,9 +213,11 @@ type Host struct {
 	Port                uint              `json:"port,omitempty"`
 	User                string            `json:"user,omitempty"`
 	PrivateKey          string            `json:"privateKey,omitempty"`
-	Password            string            `json:"password,omitempty"`
-	KeyboardInteractive map[string]string `json:"keyboardInteractive,omitempty"`
+	Password            *Secret           `json:"password,omitempty"`
+	KeyboardInteractive map[string]Secret `json:"keyboardInteractive,omitempty"`
 	Tags                map[string]string `json:"tags,omitempty"`
+	Groups              []string          `json:"groups,omitempty"`
+	Jump                *Host             `json:"jump,omitempty"`
 }
 
 func (h *Host) String() string {
@@ -204,16 +295,39 @@ type Forwarding struct {
 
 // ScpData describes configuration for a SCP server.
 type ScpData struct {
-	Addr    string `json:"addr,omitempty"`
-	Port    uint   `json:"port,omitempty"`
-	Key     string `json:"key,omitempty"`
-	Verbose bool   `json:"verbose,omitempty"`
+	Addr    string  `json:"addr,omitempty"`
+	Port    uint    `json:"port,omitempty"`
+	Key     *Secret `json:"key,omitempty"`
+	Verbose bool    `json:"verbose,omitempty"`
 }
 
 func (s *ScpData) String() string {
 	return fmt.Sprintf("%s:%d", s.Addr, s.Port)
 }
 
+// key returns the private key of the SCP server. A clear text Key is the path
+// to the key file, a secret reference resolves to the key itself, which is
+// remembered with the Redactor.
+func (s *ScpData) key(r *Redactor) ([]byte, error) {
+	if s.Key.IsRef() {
+		key, err := r.resolve(s.Key)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(key), nil
+	}
+
+	if s.Key == nil {
+		return nil, errs.New("no key given")
+	}
+
+	b, err := ioutil.ReadFile(s.Key.Value)
+	if err != nil {
+		return nil, errs.Wrapf(err, "failed to read key file %s", s.Key.Value)
+	}
+	return b, nil
+}
+
 type CommandTarget string
 
 const CommandTargetLocal CommandTarget = "local"
@@ -221,16 +335,19 @@ const CommandTargetLocal CommandTarget = "local"
 // Command describes a command that can be executed on the client or a remote
 // host connected via SSH.
 type Command struct {
-	Name        string        `json:"name,omitempty"`
-	Command     string        `json:"command,omitempty"`
-	Commands    []*Command    `json:"commands,omitempty"`
-	Flow        string        `json:"flow,omitempty"`
-	Target      CommandTarget `json:"target,omitempty"`
-	Retries     uint          `json:"retries,omitempty"`
-	Timeout     string        `json:"timeout,omitempty"`
-	IgnoreError bool          `json:"ignoreError,omitempty"`
-	Stdout      *Output       `json:"stdout,omitempty"`
-	Stderr      *Output       `json:"stderr,omitempty"`
+	Name        string            `json:"name,omitempty"`
+	Command     string            `json:"command,omitempty"`
+	Commands    []*Command        `json:"commands,omitempty"`
+	Flow        string            `json:"flow,omitempty"`
+	Target      CommandTarget     `json:"target,omitempty"`
+	Retries     uint              `json:"retries,omitempty"`
+	Timeout     string            `json:"timeout,omitempty"`
+	IgnoreError bool              `json:"ignoreError,omitempty"`
+	Stdout      *Output           `json:"stdout,omitempty"`
+	Stderr      *Output           `json:"stderr,omitempty"`
+	When        string            `json:"when,omitempty"`
+	Include     string            `json:"include,omitempty"`
+	Params      map[string]string `json:"params,omitempty"`
 }
 
 // IsRemote returns true if either the command or any of its child commands are executed on the remote.
@@ -248,15 +365,33 @@ func (c *Command) IsRemote() bool {
 	return false
 }
 
-// ReadConfig parses the file into a Config.
+// ReadConfig parses the file into a Config. If the job extends a base job,
+// the Config is the result of merging both.
 func ReadConfig(file string) (*Config, error) {
-	f, err := os.Open(file)
+	job, bases, err := readJobFile(file, nil)
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
 
-	return parseConfig(f)
+	b, err := json.Marshal(job)
+	if err != nil {
+		return nil, errs.Wrap(err, "failed to merge config")
+	}
+
+	c, err := parseConfig(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	c.bases = bases
+
+	if err := c.resolveIncludes(file); err != nil {
+		return nil, errs.Wrap(err, "failed to resolve includes")
+	}
+
+	if _, err := NewDAG([]*Config{c}); err != nil {
+		return nil, err
+	}
+	return c, nil
 }
 
 const (
@@ -321,42 +456,206 @@ func parseConfig(r io.Reader) (*Config, error) {
 	return &c, errs.Wrap(err, "failed to decode config")
 }
 
+// readHostsFiles reads all hosts files and combines the selected hosts
+// according to each files set operation. The first hosts file always
+// determines the initial set of hosts.
 func readHostsFiles(files hostsFileOrArray) (hostConfig, error) {
 	config := make(hostConfig)
-	for _, file := range files {
+	for i, file := range files {
 		c, err := readHostsFile(file)
 		if err != nil {
 			return nil, errs.Wrapf(err, "failed to read hosts file %s", file.File)
 		}
 
-		for name, host := range c {
-			config[name] = host
+		switch file.Op {
+		case "", unionOp:
+			for name, host := range c {
+				config[name] = host
+			}
+		case intersectionOp:
+			if i == 0 {
+				config = c
+				continue
+			}
+
+			for name := range config {
+				if _, ok := c[name]; !ok {
+					delete(config, name)
+				}
+			}
+		default:
+			return nil, errs.Errorf("unknown set operation %q", file.Op)
 		}
 	}
 
 	return config, nil
 }
 
+// readHostsFile reads the hosts from the file, the command output or the
+// OpenSSH client config and the inline hosts and returns those that match all of the hosts file's selectors.
 func readHostsFile(file *hostsFile) (hostConfig, error) {
-	f, err := os.Open(file.File)
+	hosts := make(hostConfig)
+
+	sources := 0
+	for _, source := range []string{file.File, file.Exec, file.SSHConfig} {
+		if source != "" {
+			sources++
+		}
+	}
+
+	if sources > 1 {
+		return nil, errs.New("either 'file', 'exec' or 'sshConfig' may be present")
+	}
+
+	if file.SSHConfig != "" {
+		var err error
+		hosts, err = readSSHConfigHosts(file.SSHConfig)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if file.Exec != "" {
+		var err error
+		hosts, err = execHostsFile(file.Exec, file.Timeout)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if file.File != "" {
+		f, err := os.Open(file.File)
+		if err != nil {
+			return nil, errs.Wrapf(err, "failed to open file %s", file.File)
+		}
+		defer f.Close()
+
+		hosts, err = parseHostsFile(f)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, host := range file.Hosts {
+		hosts[host.String()] = host
+	}
+
+	return file.filter(hosts)
+}
+
+// execHostsFile runs the command locally and parses its STDOUT as hosts file.
+// The command is killed, if it doesn't complete within the timeout.
+func execHostsFile(command, timeout string) (hostConfig, error) {
+	d := defaultExecTimeout
+	if timeout != "" {
+		var err error
+		d, err = time.ParseDuration(timeout)
+		if err != nil {
+			return nil, errs.Wrapf(err, "failed to parse hosts command timeout %s", timeout)
+		}
+	}
+
+	parts, err := shellwords.Parse(command)
 	if err != nil {
-		return nil, errs.Wrapf(err, "failed to open file %s", file.File)
+		return nil, errs.Wrapf(err, "error parsing hosts command line %s", command)
+	}
+
+	if len(parts) == 0 {
+		return nil, errs.New("hosts command is empty")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, parts[0], parts[1:]...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, errs.Errorf("hosts command %q timed out after %s", command, d)
+		}
+		return nil, errs.Wrapf(err, "hosts command %q failed: %s", command, strings.TrimSpace(stderr.String()))
 	}
-	defer f.Close()
 
-	return parseHostsFile(f, file.Pattern, file.MatchString)
+	return parseHostsFile(&stdout)
 }
 
-func parseHostsFile(r io.Reader, pattern, matchString string) (hostConfig, error) {
+func parseHostsFile(r io.Reader) (hostConfig, error) {
 	r = removeLineComments(r, cLineComments)
-	d := json.NewDecoder(r)
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errs.Wrap(err, "failed to read hosts file")
+	}
 
-	var hosts hostConfig
-	if err := d.Decode(&hosts); err != nil {
-		return nil, errs.Wrapf(err, "failed to decode hosts file")
+	hosts, err := decodeHosts(b)
+	if err != nil {
+		return nil, errs.Wrap(err, "failed to decode hosts file")
+	}
+
+	return hosts, nil
+}
+
+// filter applies the pattern, exclusion pattern, tag and group selectors to
+// hosts.
+func (f *hostsFile) filter(hosts hostConfig) (hostConfig, error) {
+	hosts, err := filterHosts(hosts, f.Pattern, f.MatchString)
+	if err != nil {
+		return nil, err
+	}
+
+	if f.Exclude != "" {
+		excluded, err := filterHosts(hosts, f.Exclude, f.MatchString)
+		if err != nil {
+			return nil, errs.Wrap(err, "failed to apply exclusion pattern")
+		}
+
+		for name := range excluded {
+			delete(hosts, name)
+		}
+	}
+
+	return selectGroups(selectTags(hosts, f.Tags), f.Groups), nil
+}
+
+// selectTags returns a new hostConfig that only contains hosts that have
+// all of the given tags with the exact same values.
+func selectTags(hosts hostConfig, tags map[string]string) hostConfig {
+	if len(tags) == 0 {
+		return hosts
+	}
+
+	selected := make(hostConfig)
+	for name, host := range hosts {
+		matches := true
+		for key, value := range tags {
+			if v, ok := host.Tags[key]; !ok || v != value {
+				matches = false
+				break
+			}
+		}
+
+		if matches {
+			selected[name] = host
+		}
 	}
+	return selected
+}
 
-	return filterHosts(hosts, pattern, matchString)
+// sorted returns all hosts in lexical order of their names.
+func (hosts hostConfig) sorted() []*Host {
+	names := make([]string, 0, len(hosts))
+	for name := range hosts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	sorted := make([]*Host, len(names))
+	for i, name := range names {
+		sorted[i] = hosts[name]
+	}
+	return sorted
 }
 
 // filterHosts returns a new hostConfig that only containes hosts matching
@@ -5,7 +5,6 @@
 package job
 
 import (
-	"fmt"
 	"log"
 	"time"
 
@@ -24,6 +23,7 @@ const (
 	TemplatingKey contextKey = "templating"
 	StdoutKey     contextKey = "stdout"
 	StderrKey     contextKey = "stderr"
+	RedactorKey   contextKey = "redactor"
 )
 
 type ConfigBuilder interface {
@@ -40,8 +40,10 @@ type ConfigBuilder interface {
 	ErrorSafeguard(child interface{}) interface{}
 	ContextBounds(child interface{}) interface{}
 	Retry(child interface{}, retries uint) interface{}
-	Templating(c *Config, h *Host) interface{}
-	SSHClient(host, user, keyFile, password string, keyboardInteractive map[string]string) interface{}
+	When(expr string, child interface{}) interface{}
+	Templating(c *Config, h *Host, hosts []*Host) interface{}
+	SSHClient(h *Host) interface{}
+	Facts(h *Host) interface{}
 	Forwarding(f *Forwarding) interface{}
 	Tunnel(f *Forwarding) interface{}
 	Commands(cmd *Command) Group
@@ -65,8 +67,50 @@ func VisitConfig(builder ConfigBuilder, c *Config) (interface{}, error) {
 		return nil, errs.New("either 'host' or 'hostsFile' may be present")
 	}
 
+	switch c.Overlap {
+	case "", OverlapSkip, OverlapQueue, OverlapQueueAll, OverlapCancel:
+	default:
+		return nil, errs.Errorf("unknown overlap policy %q", c.Overlap)
+	}
+
+	if _, err := c.Delay(func(int64) int64 { return 0 }); err != nil {
+		return nil, err
+	}
+
+	if err := c.Cancel.validate(); err != nil {
+		return nil, err
+	}
+
+	for _, lock := range c.Locks {
+		if lock == "" {
+			return nil, errs.New("empty lock name")
+		}
+	}
+
+	if err := c.compileTemplates(); err != nil {
+		return nil, err
+	}
+
+	// hosts of the job in lexical order, as available to templates
+	var (
+		hosts  hostConfig
+		sorted []*Host
+	)
+	if c.Host != nil {
+		sorted = []*Host{c.Host}
+	}
+
+	if c.HostsFile != nil {
+		var err error
+		hosts, err = readHostsFiles(c.HostsFile)
+		if err != nil {
+			return nil, errs.Wrap(err, "failed to read hosts file")
+		}
+		sorted = hosts.sorted()
+	}
+
 	children := builder.Job(c.Name)
-	children.Append(builder.Templating(c, nil))
+	children.Append(builder.Templating(c, nil, sorted))
 	children.Append(builder.Output(c.Output))
 	children.Append(builder.JobLogger(c.Name))
 
@@ -96,7 +140,7 @@ func VisitConfig(builder ConfigBuilder, c *Config) (interface{}, error) {
 	}
 
 	if c.Host != nil {
-		host, err := visitHost(builder, c, c.Host)
+		host, err := visitHost(builder, c, c.Host, sorted)
 		if err != nil {
 			return nil, errs.Wrapf(err, "failed to visit host %s", c.Host)
 		}
@@ -106,14 +150,9 @@ func VisitConfig(builder ConfigBuilder, c *Config) (interface{}, error) {
 	}
 
 	if c.HostsFile != nil {
-		hosts, err := readHostsFiles(c.HostsFile)
-		if err != nil {
-			return nil, errs.Wrap(err, "failed to read hosts file")
-		}
-
 		hostFluncs := builder.Hosts()
 		for _, host := range hosts {
-			h, err := visitHost(builder, c, host)
+			h, err := visitHost(builder, c, host, sorted)
 			if err != nil {
 				return nil, errs.Wrapf(err, "failed to visit host %s", host)
 			}
@@ -146,6 +185,7 @@ func localCommand(c *Command) *Command {
 		Retries:     c.Retries,
 		Stdout:      c.Stdout,
 		Stderr:      c.Stderr,
+		When:        c.When,
 	}
 
 	if len(c.Commands) > 0 {
@@ -157,19 +197,26 @@ func localCommand(c *Command) *Command {
 	return lc
 }
 
-func visitHost(builder ConfigBuilder, c *Config, host *Host) (Group, error) {
+func visitHost(builder ConfigBuilder, c *Config, host *Host, hosts []*Host) (Group, error) {
 	if c.Command == nil {
 		return nil, errs.New("config does not contain any commands")
 	}
 
+	if _, err := c.varValues(host); err != nil {
+		return nil, err
+	}
+
 	children := builder.Host(c, host)
 	children.Append(builder.HostLogger(c.Name, host))
-	children.Append(builder.Templating(c, host))
+	children.Append(builder.Templating(c, host, hosts))
 
 	isRemote := c.Command.IsRemote()
 	if isRemote {
-		children.Append(builder.SSHClient(fmt.Sprintf("%s:%d", host.Addr, host.Port),
-			host.User, host.PrivateKey, host.Password, host.KeyboardInteractive))
+		children.Append(builder.SSHClient(host))
+	}
+
+	if c.Facts {
+		children.Append(builder.Facts(host))
 	}
 
 	if f := c.Forwarding; f != nil {
@@ -197,6 +244,10 @@ func visitCommand(builder ConfigBuilder, cmd *Command) (interface{}, error) {
 		parallel   = "parallel"
 	)
 
+	if cmd.Include != "" {
+		return nil, errs.Errorf("unresolved include %q in %+v", cmd.Include, cmd)
+	}
+
 	if cmd.Command != "" && cmd.Commands != nil && len(cmd.Commands) > 0 {
 		return nil, errs.Errorf("either command or commands can be present in %+v", cmd)
 	}
@@ -258,6 +309,10 @@ func visitCommand(builder ConfigBuilder, cmd *Command) (interface{}, error) {
 		wrappedChildren = builder.ErrorSafeguard(wrappedChildren)
 	}
 
+	if cmd.When != "" {
+		wrappedChildren = builder.When(cmd.When, wrappedChildren)
+	}
+
 	return wrappedChildren, nil
 }
 
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"encoding/json"
 	"io/ioutil"
+	"reflect"
+	"sort"
 	"testing"
 )
 
@@ -65,7 +67,7 @@ func TestFilterHosts(t *testing.T) {
 		Addr:     "thaddeus.example.com",
 		Port:     1337,
 		User:     "me",
-		Password: "secret",
+		Password: &Secret{Value: "secret"},
 		Tags: map[string]string{
 			"provider": "Leet Corporation",
 		},
@@ -73,10 +75,9 @@ func TestFilterHosts(t *testing.T) {
 
 	host2Name := "Crappy box"
 	host2 := &Host{
-		Addr:     "eugene.example.com",
-		Port:     15289,
-		User:     "me",
-		Password: "",
+		Addr: "eugene.example.com",
+		Port: 15289,
+		User: "me",
 		Tags: map[string]string{
 			"provider": "Me PLC",
 		},
@@ -229,31 +230,199 @@ func Test_hostsFileOrArray_MarshalJSON(t *testing.T) {
 func Test_hostsFileOrArray_UnmarshalJSON(t *testing.T) {
 	tests := []struct {
 		name    string
-		f       hostsFileOrArray
 		input   string
+		want    int
 		wantErr bool
 	}{
 		{
 			name:  "no element",
-			f:     nil,
 			input: `null`,
+			want:  0,
 		},
 		{
 			name:  "one element",
-			f:     hostsFileOrArray{{}},
 			input: `{}`,
+			want:  1,
 		},
 		{
-			name:  "no element",
-			f:     hostsFileOrArray{{}, {}},
+			name:  "two elements",
 			input: `[{},{}]`,
+			want:  2,
+		},
+		{
+			name:    "invalid",
+			input:   `"hosts.json"`,
+			wantErr: true,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if err := tt.f.UnmarshalJSON([]byte(tt.input)); (err != nil) != tt.wantErr {
+			var f hostsFileOrArray
+			if err := f.UnmarshalJSON([]byte(tt.input)); (err != nil) != tt.wantErr {
 				t.Errorf("hostsFileOrArray.UnmarshalJSON() error = %v, wantErr %v", err, tt.wantErr)
 			}
+			if got := len(f); got != tt.want {
+				t.Errorf("hostsFileOrArray.UnmarshalJSON() len = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_hostsFileOrArray_RoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{
+			name:  "file",
+			input: `{"hosts":{"file":"hosts.json","pattern":".*","matchString":"{{.Tags.os}}"}}`,
+		},
+		{
+			name:  "selectors",
+			input: `{"hosts":{"file":"hosts.json","exclude":"canary.*","tags":{"env":"prod"}}}`,
+		},
+		{
+			name:  "inline",
+			input: `{"hosts":{"hosts":[{"name":"a","addr":"a.example.com","port":22}]}}`,
+		},
+		{
+			name:  "set operations",
+			input: `{"hosts":[{"file":"hosts.json"},{"file":"other.json","op":"intersection"}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var c Config
+			if err := json.Unmarshal([]byte(tt.input), &c); err != nil {
+				t.Fatal(err)
+			}
+
+			b, err := json.Marshal(&c)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := string(b); got != tt.input {
+				t.Errorf("round trip = '%s', want '%s'", got, tt.input)
+			}
+		})
+	}
+}
+
+func TestReadHostsFiles(t *testing.T) {
+	inline := []*Host{
+		{Name: "web-1", Tags: map[string]string{"env": "prod", "role": "web"}},
+		{Name: "web-2", Tags: map[string]string{"env": "staging", "role": "web"}},
+		{Name: "canary-1", Tags: map[string]string{"env": "prod", "role": "web"}},
+		{Name: "db-1", Tags: map[string]string{"env": "prod", "role": "db"}},
+	}
+
+	tests := []struct {
+		name    string
+		files   hostsFileOrArray
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:  "inline",
+			files: hostsFileOrArray{{Hosts: inline}},
+			want:  []string{"canary-1", "db-1", "web-1", "web-2"},
+		},
+		{
+			name:  "exclude",
+			files: hostsFileOrArray{{Hosts: inline, Exclude: "canary.*"}},
+			want:  []string{"db-1", "web-1", "web-2"},
+		},
+		{
+			name:  "tags",
+			files: hostsFileOrArray{{Hosts: inline, Tags: map[string]string{"env": "prod", "role": "web"}}},
+			want:  []string{"canary-1", "web-1"},
+		},
+		{
+			name: "union",
+			files: hostsFileOrArray{
+				{Hosts: inline, Pattern: "db-.*"},
+				{Hosts: inline, Pattern: "web-1"},
+			},
+			want: []string{"db-1", "web-1"},
+		},
+		{
+			name: "intersection",
+			files: hostsFileOrArray{
+				{Hosts: inline, Tags: map[string]string{"env": "prod"}},
+				{Hosts: inline, Pattern: "web-.*", Op: intersectionOp},
+			},
+			want: []string{"web-1"},
+		},
+		{
+			name:    "unknown operation",
+			files:   hostsFileOrArray{{Hosts: inline, Op: "xor"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hosts, err := readHostsFiles(tt.files)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readHostsFiles() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			var got []string
+			for name := range hosts {
+				got = append(got, name)
+			}
+			sort.Strings(got)
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readHostsFiles() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExecHostsFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    *hostsFile
+		want    int
+		wantErr bool
+	}{
+		{
+			name: "hosts file",
+			file: &hostsFile{Exec: `sh -c 'echo "{\"a\": {\"addr\": \"a.example.com\"}, \"b\": {}}"'`},
+			want: 2,
+		},
+		{
+			name: "inventory",
+			file: &hostsFile{Exec: `sh -c 'echo "{\"groups\": {\"g\": {\"hosts\": {\"a\": {}}}}}"'`, Groups: []string{"g"}},
+			want: 1,
+		},
+		{
+			name:    "failing command",
+			file:    &hostsFile{Exec: "sh -c 'exit 1'"},
+			wantErr: true,
+		},
+		{
+			name:    "timeout",
+			file:    &hostsFile{Exec: "sleep 5", Timeout: "10ms"},
+			wantErr: true,
+		},
+		{
+			name:    "file and exec",
+			file:    &hostsFile{Exec: "true", File: "hosts.json"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hosts, err := readHostsFile(tt.file)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readHostsFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got := len(hosts); got != tt.want {
+				t.Errorf("readHostsFile() = %d hosts, want %d", got, tt.want)
+			}
 		})
 	}
 }
@@ -0,0 +1,302 @@
+// Copyright (c) 2016 Niklas Wolber
+// This file is licensed under the MIT license.
+// See the LICENSE file for more information.
+
+package job
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	errs "github.com/pkg/errors"
+)
+
+// Conditions of a Dependency.
+const (
+	OnSuccess = "success"
+	OnFailure = "failure"
+	Always    = "always"
+)
+
+// A Dependency triggers a job, when the upstream job completes and the
+// condition is met.
+type Dependency struct {
+	// Name of the upstream job.
+	Job string `json:"job"`
+	// Condition is one of success, failure or always. Default is success.
+	Condition string `json:"condition,omitempty"`
+}
+
+// MarshalJSON marshals dependencies on the success of a job in the short form.
+func (d *Dependency) MarshalJSON() ([]byte, error) {
+	if d.Condition == OnSuccess {
+		return json.Marshal(d.Job)
+	}
+
+	type plain Dependency
+	return json.Marshal((*plain)(d))
+}
+
+// UnmarshalJSON unmarshals a Dependency either from the name of the upstream
+// job or from an object.
+func (d *Dependency) UnmarshalJSON(b []byte) error {
+	var name string
+	if err := json.Unmarshal(b, &name); err == nil {
+		*d = Dependency{Job: name}
+	} else {
+		type plain Dependency
+		var p plain
+		if err := json.Unmarshal(b, &p); err != nil {
+			return errs.Wrap(err, "failed to unmarshal dependency")
+		}
+		*d = Dependency(p)
+	}
+
+	if d.Job == "" {
+		return errs.New("dependency without job name")
+	}
+
+	switch d.Condition {
+	case "":
+		d.Condition = OnSuccess
+	case OnSuccess, OnFailure, Always:
+	default:
+		return errs.Errorf("unknown condition %q for dependency on %s", d.Condition, d.Job)
+	}
+	return nil
+}
+
+// Met reports whether a run of the upstream job, that ended with err,
+// triggers the dependent job.
+func (d *Dependency) Met(err error) bool {
+	switch d.Condition {
+	case OnFailure:
+		return err != nil
+	case Always:
+		return true
+	default:
+		return err == nil
+	}
+}
+
+// Triggered returns true, if the job is only run when triggered by its
+// upstream jobs, because it doesn't have a schedule.
+func (c *Config) Triggered() bool {
+	return c.Schedule == "" && len(c.DependsOn) > 0
+}
+
+// A DAG is the directed acyclic graph of jobs and their dependencies.
+type DAG struct {
+	// jobs by name
+	jobs map[string]*Config
+	// downstream jobs by the name of their upstream job
+	downstream map[string][]*Config
+}
+
+// NewDAG builds the DAG of the jobs. It fails if the dependencies contain a
+// cycle or if an upstream job name is ambiguous. Dependencies on unknown jobs
+// are allowed, as those may be added later.
+func NewDAG(configs []*Config) (*DAG, error) {
+	d := &DAG{
+		jobs:       make(map[string]*Config),
+		downstream: make(map[string][]*Config),
+	}
+
+	duplicates := make(map[string]bool)
+	for _, c := range configs {
+		if _, ok := d.jobs[c.Name]; ok {
+			duplicates[c.Name] = true
+		}
+		d.jobs[c.Name] = c
+	}
+
+	for _, c := range configs {
+		for _, dep := range c.DependsOn {
+			if duplicates[dep.Job] {
+				return nil, errs.Errorf("job %q depends on %q, but there are multiple jobs with that name", c.Name, dep.Job)
+			}
+			d.downstream[dep.Job] = append(d.downstream[dep.Job], c)
+		}
+	}
+
+	if cycle := d.cycle(); cycle != nil {
+		return nil, errs.Errorf("dependency cycle %s", strings.Join(cycle, " -> "))
+	}
+	return d, nil
+}
+
+// cycle returns the names of the jobs forming a cycle, if there is one.
+func (d *DAG) cycle() []string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	state := make(map[string]int)
+	var stack []string
+
+	var visit func(name string) []string
+	visit = func(name string) []string {
+		switch state[name] {
+		case visiting:
+			for i, n := range stack {
+				if n == name {
+					return append(append([]string(nil), stack[i:]...), name)
+				}
+			}
+		case visited:
+			return nil
+		}
+
+		state[name] = visiting
+		stack = append(stack, name)
+		for _, down := range d.downstream[name] {
+			if cycle := visit(down.Name); cycle != nil {
+				return cycle
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[name] = visited
+		return nil
+	}
+
+	for _, name := range d.names() {
+		if cycle := visit(name); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
+
+func (d *DAG) names() []string {
+	names := make([]string, 0, len(d.jobs))
+	for name := range d.jobs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Downstream returns the jobs that depend on the job.
+func (d *DAG) Downstream(name string) []*Config {
+	return d.downstream[name]
+}
+
+// Upstream returns the names of the jobs the job depends on.
+func (d *DAG) Upstream(name string) []string {
+	c, ok := d.jobs[name]
+	if !ok {
+		return nil
+	}
+
+	names := make([]string, len(c.DependsOn))
+	for i, dep := range c.DependsOn {
+		names[i] = dep.Job
+	}
+	return names
+}
+
+// Order returns the names of all jobs, upstream jobs always come before
+// their downstream jobs.
+func (d *DAG) Order() []string {
+	var (
+		order   []string
+		visited = make(map[string]bool)
+		visit   func(name string)
+	)
+
+	visit = func(name string) {
+		if visited[name] {
+			return
+		}
+		visited[name] = true
+
+		for _, up := range d.Upstream(name) {
+			if _, ok := d.jobs[up]; ok {
+				visit(up)
+			}
+		}
+		order = append(order, name)
+	}
+
+	for _, name := range d.names() {
+		visit(name)
+	}
+	return order
+}
+
+// DAGNode is a job in the JSON representation of a DAG.
+type DAGNode struct {
+	Name     string `json:"name"`
+	Schedule string `json:"schedule,omitempty"`
+	// Whether the job is only run when triggered by its upstream jobs.
+	Triggered bool `json:"triggered,omitempty"`
+}
+
+// DAGEdge is a dependency in the JSON representation of a DAG. It points from
+// the upstream to the downstream job.
+type DAGEdge struct {
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Condition string `json:"condition"`
+	// Whether the upstream job is not part of the DAG.
+	Unknown bool `json:"unknown,omitempty"`
+}
+
+// MarshalJSON marshals the jobs as nodes and their dependencies as edges.
+// Nodes come in the order returned by Order.
+func (d *DAG) MarshalJSON() ([]byte, error) {
+	v := struct {
+		Nodes []DAGNode `json:"nodes"`
+		Edges []DAGEdge `json:"edges"`
+	}{
+		Nodes: []DAGNode{},
+		Edges: []DAGEdge{},
+	}
+
+	for _, name := range d.Order() {
+		c := d.jobs[name]
+		v.Nodes = append(v.Nodes, DAGNode{
+			Name:      name,
+			Schedule:  c.Schedule,
+			Triggered: c.Triggered(),
+		})
+
+		for _, dep := range c.DependsOn {
+			_, ok := d.jobs[dep.Job]
+			v.Edges = append(v.Edges, DAGEdge{
+				From:      dep.Job,
+				To:        name,
+				Condition: dep.Condition,
+				Unknown:   !ok,
+			})
+		}
+	}
+	return json.Marshal(v)
+}
+
+// String returns every job with the jobs it depends on.
+func (d *DAG) String() string {
+	var buf bytes.Buffer
+	for _, name := range d.Order() {
+		c := d.jobs[name]
+		trigger := c.Schedule
+		if c.Triggered() {
+			trigger = "triggered"
+		}
+		fmt.Fprintf(&buf, "%s (%s)\n", name, trigger)
+
+		for _, dep := range c.DependsOn {
+			unknown := ""
+			if _, ok := d.jobs[dep.Job]; !ok {
+				unknown = ", unknown job"
+			}
+			fmt.Fprintf(&buf, "  after %s (on %s%s)\n", dep.Job, dep.Condition, unknown)
+		}
+	}
+	return buf.String()
+}
@@ -0,0 +1,135 @@
+// Copyright (c) 2016 Niklas Wolber
+// This file is licensed under the MIT license.
+// See the LICENSE file for more information.
+
+package job
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestUnmarshalDependency(t *testing.T) {
+	var c Config
+	err := json.Unmarshal([]byte(`{"dependsOn": ["a", {"job": "b", "condition": "failure"}, {"job": "c", "condition": "always"}]}`), &c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect(t, Dependency{Job: "a", Condition: OnSuccess}, *c.DependsOn[0])
+	expect(t, Dependency{Job: "b", Condition: OnFailure}, *c.DependsOn[1])
+	expect(t, Dependency{Job: "c", Condition: Always}, *c.DependsOn[2])
+
+	b, err := json.Marshal(c.DependsOn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, `["a",{"job":"b","condition":"failure"},{"job":"c","condition":"always"}]`, string(b))
+
+	for _, invalid := range []string{
+		`{"dependsOn": [{"job": "a", "condition": "sometimes"}]}`,
+		`{"dependsOn": [{"condition": "always"}]}`,
+		`{"dependsOn": [""]}`,
+	} {
+		if err := json.Unmarshal([]byte(invalid), &c); err == nil {
+			t.Errorf("%s: expected an error", invalid)
+		}
+	}
+}
+
+func TestDependencyMet(t *testing.T) {
+	failed := errors.New("failed")
+
+	tests := []struct {
+		condition string
+		err       error
+		want      bool
+	}{
+		{OnSuccess, nil, true},
+		{OnSuccess, failed, false},
+		{OnFailure, nil, false},
+		{OnFailure, failed, true},
+		{Always, nil, true},
+		{Always, failed, true},
+	}
+
+	for _, test := range tests {
+		d := &Dependency{Job: "a", Condition: test.condition}
+		if got := d.Met(test.err); got != test.want {
+			t.Errorf("%s with error %v: want %t, got %t", test.condition, test.err, test.want, got)
+		}
+	}
+}
+
+func dependsOn(name string, upstream ...string) *Config {
+	c := &Config{Name: name}
+	for _, up := range upstream {
+		c.DependsOn = append(c.DependsOn, &Dependency{Job: up, Condition: OnSuccess})
+	}
+	return c
+}
+
+func TestNewDAG(t *testing.T) {
+	backup := dependsOn("backup")
+	backup.Schedule = "@daily"
+
+	dag, err := NewDAG([]*Config{
+		dependsOn("report", "verify", "backup"),
+		dependsOn("verify", "backup"),
+		backup,
+		dependsOn("notify", "missing"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect(t, "backup notify verify report", strings.Join(dag.Order(), " "))
+	expect(t, "verify backup", strings.Join(dag.Upstream("report"), " "))
+	expect(t, 2, len(dag.Downstream("backup")))
+	expect(t, `backup (@daily)
+notify (triggered)
+  after missing (on success, unknown job)
+verify (triggered)
+  after backup (on success)
+report (triggered)
+  after verify (on success)
+  after backup (on success)
+`, dag.String())
+}
+
+func TestNewDAGErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		configs []*Config
+		want    string
+	}{
+		{
+			name:    "self",
+			configs: []*Config{dependsOn("a", "a")},
+			want:    "dependency cycle a -> a",
+		},
+		{
+			name:    "cycle",
+			configs: []*Config{dependsOn("a", "c"), dependsOn("b", "a"), dependsOn("c", "b"), dependsOn("d", "a")},
+			want:    "dependency cycle a -> b -> c -> a",
+		},
+		{
+			name:    "ambiguous",
+			configs: []*Config{dependsOn("a"), dependsOn("a"), dependsOn("b", "a")},
+			want:    `multiple jobs with that name`,
+		},
+	}
+
+	for _, test := range tests {
+		_, err := NewDAG(test.configs)
+		if err == nil {
+			t.Errorf("%s: expected an error", test.name)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: want error containing %q, got %q", test.name, test.want, err)
+		}
+	}
+}
@@ -7,6 +7,7 @@ package job
 import (
 	"bufio"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -76,7 +77,8 @@ func (e *ExecutionTreeBuilder) Job(name string) Group {
 
 // Output returns a Flunc that, when executed, adds an io.Writer to the
 // context. If there is already an output present, it creates an
-// io.MultiWriter that writes to both outputs.
+// io.MultiWriter that writes to both outputs. It also adds a Redactor to the
+// context, that masks sensitive values in everything written to the output.
 //
 // It requires a TemplatingEngine to function properly.
 func (*ExecutionTreeBuilder) Output(o *Output) interface{} {
@@ -87,11 +89,25 @@ func (*ExecutionTreeBuilder) Output(o *Output) interface{} {
 			return ctx, nil
 		}
 
-		if o == nil {
-			return context.WithValue(ctx, OutputKey, os.Stdout), nil
+		tt, ok := ctx.Value(TemplatingKey).(*TemplatingEngine)
+
+		// the executor provides the Redactor of the run
+		r, hasRedactor := ctx.Value(RedactorKey).(*Redactor)
+		if !hasRedactor {
+			if ok {
+				r = tt.Config.Redactor()
+			}
+			ctx = context.WithValue(ctx, RedactorKey, r)
 		}
 
-		tt, ok := ctx.Value(TemplatingKey).(*TemplatingEngine)
+		if o == nil {
+			w := r.Writer(os.Stdout)
+			go func(ctx context.Context) {
+				<-ctx.Done()
+				w.Flush()
+			}(ctx)
+			return context.WithValue(ctx, OutputKey, w), nil
+		}
 
 		if !ok {
 			err := errs.Errorf("error during output setup: no %s available", TemplatingKey)
@@ -105,11 +121,12 @@ func (*ExecutionTreeBuilder) Output(o *Output) interface{} {
 			return nil, err
 		}
 
-		f, err := openOutputFile(file, o.Raw, o.Overwrite)
+		of, err := openOutputFile(file, o.Raw, o.Overwrite)
 		if err != nil {
 			err = errs.Wrapf(err, "error during output setup: unable to open output file for job %s", file)
 			return nil, err
 		}
+		f := r.Writer(of)
 
 		go func(ctx context.Context, f io.Closer) {
 			<-ctx.Done()
@@ -226,9 +243,10 @@ func (e *ExecutionTreeBuilder) SCP(scp *ScpData) interface{} {
 			return nil, err
 		}
 
-		b, err := ioutil.ReadFile(scp.Key)
+		r, _ := ctx.Value(RedactorKey).(*Redactor)
+		b, err := scp.key(r)
 		if err != nil {
-			err = errs.Wrapf(err, "error while setting up scp to %s: failed to read key file %s", scp, scp.Key)
+			err = errs.Wrapf(err, "error while setting up scp to %s", scp)
 			l.Println(err)
 			return nil, err
 		}
@@ -252,7 +270,9 @@ func (e *ExecutionTreeBuilder) Host(c *Config, h *Host) Group {
 
 // ErrorSafeguard returns a Flunc that, when executed, will call its child.
 // If the child returns an error the error will be logged but otherwise
-// discarded and not passed to the parent.
+// discarded and not passed to the parent. Errors of a child, that stopped
+// because the context of the safeguard is done, are passed to the parent, so
+// cancellations and timeouts of the parent are not mistaken for success.
 //
 // It requires a logger to function properly.
 func (e *ExecutionTreeBuilder) ErrorSafeguard(child interface{}) interface{} {
@@ -269,12 +289,15 @@ func (e *ExecutionTreeBuilder) ErrorSafeguard(child interface{}) interface{} {
 			return nil, err
 		}
 
-		ctx, err := f(ctx)
+		childCtx, err := f(ctx)
 		if err != nil {
+			if ctxErr := flunc.ContextErr(ctx); ctxErr != nil {
+				return nil, errs.Wrap(ctxErr, "safeguard")
+			}
 			l.Println("safeguard caught an error:", err)
 			return nil, nil
 		}
-		return ctx, nil
+		return childCtx, nil
 	})
 }
 
@@ -299,7 +322,8 @@ func (e *ExecutionTreeBuilder) ContextBounds(child interface{}) interface{} {
 
 // Retry returns a Flunc that, when executed, restarts its child, if it returned
 // an error. When numRetires retries have been made and the child still failed
-// the latest error will be returned to the parent.
+// the latest error will be returned to the parent. If the context is done, no
+// more retries are made.
 //
 // It requires a logger to function properly.
 func (e *ExecutionTreeBuilder) Retry(child interface{}, numRetries uint) interface{} {
@@ -326,6 +350,10 @@ func (e *ExecutionTreeBuilder) Retry(child interface{}, numRetries uint) interfa
 			if err == nil {
 				break
 			}
+			if ctxErr := flunc.ContextErr(ctx); ctxErr != nil {
+				l.Println("not retrying, context is done:", err)
+				return nil, errs.Wrap(ctxErr, "retry")
+			}
 			l.Println("retrying, previous attempt failed:", err)
 		}
 
@@ -333,42 +361,161 @@ func (e *ExecutionTreeBuilder) Retry(child interface{}, numRetries uint) interfa
 	})
 }
 
+// When returns a Flunc that, when executed, only calls its child if the
+// expression evaluates to true. The expression is interpolated with the
+// TemplatingEngine, results other than "", "false", "0" and "<no value>"
+// are true.
+//
+// It requires a logger and a TemplatingEngine to function properly.
+func (e *ExecutionTreeBuilder) When(expr string, child interface{}) interface{} {
+	f, ok := child.(flunc.Flunc)
+	if !ok {
+		log.Panicf("not a flunc %T", child)
+	}
+
+	return flunc.MakeFlunc(func(ctx context.Context) (context.Context, error) {
+		l, ok := ctx.Value(LoggerKey).(logger.Logger)
+		if !ok {
+			err := errs.Errorf("error while evaluating condition: no %s available", LoggerKey)
+			log.Println(err)
+			return nil, err
+		}
+
+		tt, ok := ctx.Value(TemplatingKey).(*TemplatingEngine)
+		if !ok {
+			err := errs.Errorf("error while evaluating condition: no %s available", TemplatingKey)
+			l.Println(err)
+			return nil, err
+		}
+
+		result, err := tt.Interpolate(whenTemplate(expr))
+		if err != nil {
+			err = errs.Wrapf(err, "error evaluating condition %s", expr)
+			l.Println(err)
+			return nil, err
+		}
+
+		if !isTrue(result) {
+			l.Printf("skipping, condition %s is false", expr)
+			return nil, nil
+		}
+
+		return f(ctx)
+	})
+}
+
 // Templating returns a Flunc that, when executed, adds a new TemplatingEngine
-// with the information from config and host to the context.
-func (e *ExecutionTreeBuilder) Templating(config *Config, host *Host) interface{} {
+// with the information from config, host and all hosts of the run to the
+// context.
+func (e *ExecutionTreeBuilder) Templating(config *Config, host *Host, hosts []*Host) interface{} {
 	return flunc.MakeFlunc(func(ctx context.Context) (context.Context, error) {
-		tt := newTemplatingEngine(config, host)
+		tt := newTemplatingEngine(config, host, hosts)
 		return context.WithValue(ctx, TemplatingKey, tt), nil
 	})
 }
 
 // SSHClient returns a Flunc that, when executed, adds a SSH client to the
 // context. This is either a new client or an existing client that is being
-// reused.
+// reused. If the host has a jump host, the connection is established through
+// the jump host.
 //
 // It requires a logger to function properly.
-func (*ExecutionTreeBuilder) SSHClient(host, user, keyFile, password string, keyboardInteractive map[string]string) interface{} {
+func (*ExecutionTreeBuilder) SSHClient(h *Host) interface{} {
 	return flunc.MakeFlunc(func(ctx context.Context) (context.Context, error) {
+		host := fmt.Sprintf("%s:%d", h.Addr, h.Port)
+
 		l, ok := ctx.Value(LoggerKey).(logger.Logger)
 		if !ok {
-			err := errs.Errorf("error while setting up ssh to %s@%s: no %s available", host, user, LoggerKey)
+			err := errs.Errorf("error while setting up ssh to %s@%s: no %s available", h.User, host, LoggerKey)
 			log.Println(err)
 			return nil, err
 		}
 
-		l.Println("connecting to", host)
-		s, err := newSSHClient(ctx, host, user, keyFile, password, keyboardInteractive)
+		s, err := connect(ctx, l, h)
 		if err != nil {
-			err = errs.Wrapf(err, "ssh client setup to %s@%s failed", host, user)
+			err = errs.Wrapf(err, "ssh client setup to %s@%s failed", h.User, host)
 			l.Println(err)
 			return nil, err
 		}
-		l.Println("connected to", host)
 
 		return context.WithValue(ctx, SshClientKey, s), nil
 	})
 }
 
+// Facts returns a Flunc that, when executed, gathers the facts of the host
+// and adds a TemplatingEngine containing them to the context. The facts are
+// gathered through the SSH client, if there is one, otherwise locally.
+//
+// It requires a logger and a TemplatingEngine to function properly.
+func (*ExecutionTreeBuilder) Facts(h *Host) interface{} {
+	return flunc.MakeFlunc(func(ctx context.Context) (context.Context, error) {
+		l, ok := ctx.Value(LoggerKey).(logger.Logger)
+		if !ok {
+			err := errs.Errorf("error while gathering facts of %s: no %s available", h, LoggerKey)
+			log.Println(err)
+			return nil, err
+		}
+
+		tt, ok := ctx.Value(TemplatingKey).(*TemplatingEngine)
+		if !ok {
+			err := errs.Errorf("error while gathering facts of %s: no %s available", h, TemplatingKey)
+			l.Println(err)
+			return nil, err
+		}
+
+		s, _ := ctx.Value(SshClientKey).(*sshClient)
+		facts, err := gatherFacts(ctx, s)
+		if err != nil {
+			err = errs.Wrapf(err, "failed to gather facts of %s", h)
+			l.Println(err)
+			return nil, err
+		}
+
+		b, _ := json.Marshal(facts)
+		l.Println("gathered facts", string(b))
+
+		withFacts := *tt
+		withFacts.Facts = facts
+		return context.WithValue(ctx, TemplatingKey, &withFacts), nil
+	})
+}
+
+// connect establishes a SSH connection to the host. Jump hosts are connected
+// first, recursively.
+func connect(ctx context.Context, l logger.Logger, h *Host) (*sshClient, error) {
+	host := fmt.Sprintf("%s:%d", h.Addr, h.Port)
+
+	if h.Jump != nil {
+		jump, err := connect(ctx, l, h.Jump)
+		if err != nil {
+			return nil, errs.Wrapf(err, "failed to connect to jump host %s", h.Jump)
+		}
+		ctx = context.WithValue(ctx, jumpClientKey, jump)
+	}
+
+	// secrets are only resolved when they are actually needed and are
+	// redacted from the output of the run from then on
+	r, _ := ctx.Value(RedactorKey).(*Redactor)
+	password, err := r.resolve(h.Password)
+	if err != nil {
+		return nil, errs.Wrapf(err, "failed to resolve password for %s", host)
+	}
+
+	keyboardInteractive, err := resolveSecrets(r, h.KeyboardInteractive)
+	if err != nil {
+		return nil, errs.Wrapf(err, "failed to resolve keyboard interactive answers for %s", host)
+	}
+
+	l.Println("connecting to", host)
+	s, err := newSSHClient(ctx, host, h.User, h.PrivateKey, password, keyboardInteractive)
+	if err != nil {
+		return nil, err
+	}
+	l.Println("connected to", host)
+
+	return s, nil
+}
+
 // Forwarding returns a Flunc that, when executed, establishes a port forwarding
 // from the host to the client.
 //
@@ -432,7 +579,8 @@ func (e *ExecutionTreeBuilder) Commands(cmd *Command) Group {
 //
 // It requires a logger, a SSHClient and a TemplatingEngine to function properly.
 // It also redirects the commands STDERR and STDOUT to the ones in the context,
-// if available. Otherwise os.Stderr and os.Stdout will be used, respectivly.
+// if available. Otherwise os.Stderr and os.Stdout will be used, respectivly,
+// with sensitive values redacted.
 func (*ExecutionTreeBuilder) Command(cmd *Command) interface{} {
 	return flunc.MakeFlunc(func(ctx context.Context) (context.Context, error) {
 		l, ok := ctx.Value(LoggerKey).(logger.Logger)
@@ -461,17 +609,28 @@ func (*ExecutionTreeBuilder) Command(cmd *Command) interface{} {
 			return nil, err
 		}
 
+		r, _ := ctx.Value(RedactorKey).(*Redactor)
+
 		stdout, _ := ctx.Value(StdoutKey).(io.Writer)
 		if stdout == nil {
-			stdout = os.Stdout
+			w := r.Writer(os.Stdout)
+			defer w.Flush()
+			stdout = w
 		}
 
 		stderr, _ := ctx.Value(StderrKey).(io.Writer)
 		if stderr == nil {
-			stderr = os.Stderr
+			w := r.Writer(os.Stderr)
+			defer w.Flush()
+			stderr = w
+		}
+
+		var cancellation *Cancellation
+		if tt.Config != nil {
+			cancellation = tt.Config.Cancel
 		}
 
-		err = s.executeCommand(ctx, command, stdout, stderr)
+		err = s.executeCommand(ctx, command, stdout, stderr, cancellation)
 		return nil, errs.Wrap(err, "failed to remote command")
 	})
 }
@@ -481,7 +640,8 @@ func (*ExecutionTreeBuilder) Command(cmd *Command) interface{} {
 //
 // It requires a logger and a TemplatingEngine to function properly.
 // It also redirects the commands STDERR and STDOUT to the ones in the context,
-// if available. Otherwise os.Stderr and os.Stdout will be used, respectivly.
+// if available. Otherwise os.Stderr and os.Stdout will be used, respectivly,
+// with sensitive values redacted.
 func (*ExecutionTreeBuilder) LocalCommand(cmd *Command) interface{} {
 	return flunc.MakeFlunc(func(ctx context.Context) (context.Context, error) {
 		l, ok := ctx.Value(LoggerKey).(logger.Logger)
@@ -516,9 +676,13 @@ func (*ExecutionTreeBuilder) LocalCommand(cmd *Command) interface{} {
 
 		cmd := exec.CommandContext(ctx, exe, args...)
 
+		r, _ := ctx.Value(RedactorKey).(*Redactor)
+
 		stdout, _ := ctx.Value(StdoutKey).(io.Writer)
 		if stdout == nil {
-			stdout = os.Stdout
+			w := r.Writer(os.Stdout)
+			defer w.Flush()
+			stdout = w
 		}
 		stdout = bufio.NewWriter(stdout)
 		defer stdout.(*bufio.Writer).Flush()
@@ -526,7 +690,9 @@ func (*ExecutionTreeBuilder) LocalCommand(cmd *Command) interface{} {
 
 		stderr, _ := ctx.Value(StderrKey).(io.Writer)
 		if stderr == nil {
-			stderr = os.Stderr
+			w := r.Writer(os.Stderr)
+			defer w.Flush()
+			stderr = w
 		}
 		stderr = bufio.NewWriter(stderr)
 		defer stderr.(*bufio.Writer).Flush()
@@ -534,6 +700,10 @@ func (*ExecutionTreeBuilder) LocalCommand(cmd *Command) interface{} {
 
 		l.Println("executing local command", command)
 		if err := cmd.Run(); err != nil {
+			if ctxErr := flunc.ContextErr(ctx); ctxErr != nil {
+				// the command has been killed, because the context is done
+				err = ctxErr
+			}
 			err = errs.Wrapf(err, "error running %q locally", command)
 			l.Println(err)
 			return nil, err
@@ -545,7 +715,7 @@ func (*ExecutionTreeBuilder) LocalCommand(cmd *Command) interface{} {
 
 // Stdout returns a Flunc that, when executed, adds a file to the context that
 // can be used as STDOUT for Commands. It will close the file, when the Flunc
-// returns.
+// returns. Sensitive values are redacted before they are written to the file.
 //
 // It requires a logger and a TemplatingEngine to function properly.
 func (e *ExecutionTreeBuilder) Stdout(o *Output) interface{} {
@@ -575,12 +745,14 @@ func (e *ExecutionTreeBuilder) Stdout(o *Output) interface{} {
 			return nil, err
 		}
 
-		f, err := openOutputFile(path, o.Raw, o.Overwrite)
+		of, err := openOutputFile(path, o.Raw, o.Overwrite)
 		if err != nil {
 			err = errs.Wrapf(err, "unable to open stdout file %s", o.File)
 			l.Println(err)
 			return nil, err
 		}
+		r, _ := ctx.Value(RedactorKey).(*Redactor)
+		f := r.Writer(of)
 		l.Println("opened", path, "for stdout")
 
 		go func(ctx context.Context, f io.Closer, path string) {
@@ -595,7 +767,7 @@ func (e *ExecutionTreeBuilder) Stdout(o *Output) interface{} {
 
 // Stderr returns a Flunc that, when executed, adds a file to the context that
 // can be used as STDERR for Commands. It will close the file when the Flunc
-// returns.
+// returns. Sensitive values are redacted before they are written to the file.
 //
 // It requires a logger and a TemplatingEngine to function properly.
 func (*ExecutionTreeBuilder) Stderr(o *Output) interface{} {
@@ -625,12 +797,14 @@ func (*ExecutionTreeBuilder) Stderr(o *Output) interface{} {
 			return nil, err
 		}
 
-		f, err := openOutputFile(path, o.Raw, o.Overwrite)
+		of, err := openOutputFile(path, o.Raw, o.Overwrite)
 		if err != nil {
 			err = errs.Wrapf(err, "unable to open stderr file %s", o.File)
 			l.Println(err)
 			return nil, err
 		}
+		r, _ := ctx.Value(RedactorKey).(*Redactor)
+		f := r.Writer(of)
 		l.Println("opened", path, "for stderr")
 
 		go func(ctx context.Context, f io.Closer, path string) {
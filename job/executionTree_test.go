@@ -0,0 +1,151 @@
+// Copyright (c) 2016 Niklas Wolber
+// This file is licensed under the MIT license.
+// See the LICENSE file for more information.
+
+package job
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/nwolber/xCUTEr/flunc"
+	"github.com/nwolber/xCUTEr/logger"
+)
+
+func testContext() context.Context {
+	ctx := context.WithValue(context.Background(), LoggerKey, logger.New(log.New(ioutil.Discard, "", 0), false))
+	ctx = context.WithValue(ctx, TemplatingKey, newTemplatingEngine(&Config{}, nil, nil))
+	ctx = context.WithValue(ctx, StdoutKey, ioutil.Discard)
+	return context.WithValue(ctx, StderrKey, ioutil.Discard)
+}
+
+func TestErrorSafeguard(t *testing.T) {
+	errTest := errors.New("test error")
+	b := &ExecutionTreeBuilder{}
+
+	tests := []struct {
+		name string
+		// whether the context of the safeguard is cancelled
+		cancel bool
+		err    error
+		is     func(error) bool
+	}{
+		{name: "success", is: func(err error) bool { return err == nil }},
+		{name: "error", err: errTest, is: func(err error) bool { return err == nil }},
+		// the child's own timeout is an error like any other
+		{name: "child timeout", err: flunc.ErrTimeout, is: func(err error) bool { return err == nil }},
+		{name: "cancelled", cancel: true, err: flunc.ErrCancelled, is: flunc.IsCancelled},
+		{name: "cancelled, other error", cancel: true, err: errTest, is: flunc.IsCancelled},
+	}
+
+	for _, test := range tests {
+		ctx, cancel := context.WithCancel(testContext())
+		child := flunc.MakeFlunc(func(context.Context) (context.Context, error) {
+			if test.cancel {
+				cancel()
+			}
+			return nil, test.err
+		})
+
+		_, err := b.ErrorSafeguard(child).(flunc.Flunc)(ctx)
+		if !test.is(err) {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		}
+		cancel()
+	}
+}
+
+func TestRetry(t *testing.T) {
+	errTest := errors.New("test error")
+	b := &ExecutionTreeBuilder{}
+
+	tests := []struct {
+		name     string
+		cancel   bool
+		err      error
+		attempts int
+		is       func(error) bool
+	}{
+		{name: "error", err: errTest, attempts: 3, is: func(err error) bool { return err == errTest }},
+		{name: "child timeout", err: flunc.ErrTimeout, attempts: 3, is: flunc.IsTimeout},
+		{name: "cancelled", cancel: true, err: errTest, attempts: 1, is: flunc.IsCancelled},
+	}
+
+	for _, test := range tests {
+		ctx, cancel := context.WithCancel(testContext())
+		attempts := 0
+		child := flunc.MakeFlunc(func(context.Context) (context.Context, error) {
+			attempts++
+			if test.cancel {
+				cancel()
+			}
+			return nil, test.err
+		})
+
+		_, err := b.Retry(child, 3).(flunc.Flunc)(ctx)
+		if !test.is(err) {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		}
+		expect(t, test.attempts, attempts)
+		cancel()
+	}
+}
+
+func TestTimeoutLocalCommand(t *testing.T) {
+	b := &ExecutionTreeBuilder{}
+	f := flunc.Sequential(
+		b.Timeout(10*time.Millisecond).(flunc.Flunc),
+		b.LocalCommand(&Command{Command: "sleep 10"}).(flunc.Flunc),
+	)
+
+	ctx, cancel := context.WithCancel(testContext())
+	defer cancel()
+
+	if _, err := f(ctx); !flunc.IsTimeout(err) {
+		t.Errorf("want %v, got %v", flunc.ErrTimeout, err)
+	}
+
+	// the timeout of a child doesn't cancel the parent, so it's ignored by
+	// a safeguard
+	f = b.ErrorSafeguard(b.ContextBounds(f)).(flunc.Flunc)
+	if _, err := f(ctx); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestRedactLocalCommandStdout(t *testing.T) {
+	os.Setenv("XCUTER_TEST_COMMAND", "s3cr3t")
+	defer os.Unsetenv("XCUTER_TEST_COMMAND")
+
+	f, err := ioutil.TempFile("", "xcuter-stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	r := (&Config{}).Redactor()
+	if _, err := r.resolve(&Secret{Ref: "env:XCUTER_TEST_COMMAND"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// no output is configured, so the command writes to os.Stdout
+	ctx := context.WithValue(context.Background(), LoggerKey, logger.New(log.New(ioutil.Discard, "", 0), false))
+	ctx = context.WithValue(ctx, TemplatingKey, newTemplatingEngine(&Config{}, nil, nil))
+	ctx = context.WithValue(ctx, RedactorKey, r)
+
+	stdout := os.Stdout
+	os.Stdout = f
+	_, err = (&ExecutionTreeBuilder{}).LocalCommand(&Command{Command: "echo password: s3cr3t"}).(flunc.Flunc)(ctx)
+	os.Stdout = stdout
+	expect(t, nil, err)
+
+	b, err := ioutil.ReadFile(f.Name())
+	expect(t, nil, err)
+	expect(t, "password: "+redacted+"\n", string(b))
+}
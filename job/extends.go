@@ -0,0 +1,232 @@
+// Copyright (c) 2016 Niklas Wolber
+// This file is licensed under the MIT license.
+// See the LICENSE file for more information.
+
+package job
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	errs "github.com/pkg/errors"
+)
+
+const (
+	extendsKey = "extends"
+	// abstractKey marks jobs, that are only used as base jobs. It isn't
+	// inherited.
+	abstractKey = "abstract"
+)
+
+// commandKeys are the options holding command trees. They are replaced as a
+// whole when a job overrides them, instead of being merged.
+var commandKeys = map[string]bool{
+	"pre":     true,
+	"command": true,
+	"post":    true,
+}
+
+// readJobFile reads the job file into a generic JSON object and merges it
+// with the base jobs it extends. Paths of bases are relative to the
+// extending file, paths in the options of bases are made absolute. The
+// returned files contain all base jobs.
+func readJobFile(file string, stack []string) (map[string]interface{}, []string, error) {
+	path, err := filepath.Abs(file)
+	if err != nil {
+		return nil, nil, errs.Wrapf(err, "invalid job path %s", file)
+	}
+
+	for i, extending := range stack {
+		if extending == path {
+			return nil, nil, errs.Errorf("extends cycle %s", strings.Join(append(stack[i:], path), " -> "))
+		}
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	r := removeLineComments(f, cLineComments)
+	defer r.Close()
+
+	d := json.NewDecoder(r)
+	d.UseNumber()
+
+	var job map[string]interface{}
+	if err := d.Decode(&job); err != nil {
+		return nil, nil, errs.Wrapf(err, "failed to decode %s", file)
+	}
+
+	// paths are relative to the file declaring them, so those of base jobs
+	// are made absolute
+	if len(stack) > 0 {
+		if err := rebasePaths(file, job); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	ext, ok := job[extendsKey]
+	if !ok {
+		return job, nil, nil
+	}
+	delete(job, extendsKey)
+
+	base, ok := ext.(string)
+	if !ok || base == "" {
+		return nil, nil, errs.Errorf("%s: extends has to be a file name", file)
+	}
+
+	baseFile := importPath(file, base)
+	baseJob, files, err := readJobFile(baseFile, append(stack, path))
+	if err != nil {
+		return nil, nil, errs.Wrapf(err, "%s: extends %q", file, base)
+	}
+	delete(baseJob, abstractKey)
+
+	return mergeJob(baseJob, job), append(files, baseFile), nil
+}
+
+// rebasePaths makes the relative paths in the options of the base job
+// absolute, resolved against the directory of the base job file. Paths
+// starting with a template are kept, as they may evaluate to any path.
+func rebasePaths(file string, job map[string]interface{}) error {
+	var err error
+	rebase := func(value interface{}) interface{} {
+		path, ok := value.(string)
+		if !ok || path == "" || strings.HasPrefix(path, "{{") || err != nil {
+			return value
+		}
+
+		abs, absErr := filepath.Abs(importPath(file, path))
+		if absErr != nil {
+			err = errs.Wrapf(absErr, "%s: invalid path %q", file, path)
+			return value
+		}
+		return abs
+	}
+
+	// rebaseKeys rebases the values of the keys, if value is an object.
+	rebaseKeys := func(value interface{}, keys ...string) interface{} {
+		if obj, ok := value.(map[string]interface{}); ok {
+			for _, key := range keys {
+				if v, ok := obj[key]; ok {
+					obj[key] = rebase(v)
+				}
+			}
+		}
+		return value
+	}
+
+	// outputs and hosts files are either a file name or an object
+	rebaseOutput := func(value interface{}) interface{} {
+		return rebaseKeys(rebase(value), "file")
+	}
+
+	var rebaseHost func(value interface{})
+	rebaseHost = func(value interface{}) {
+		if obj, ok := rebaseKeys(value, "privateKey").(map[string]interface{}); ok {
+			rebaseHost(obj["jump"])
+		}
+	}
+
+	rebaseHostsFile := func(value interface{}) interface{} {
+		value = rebaseKeys(rebase(value), "file", "sshConfig")
+		if obj, ok := value.(map[string]interface{}); ok {
+			hosts, _ := obj["hosts"].([]interface{})
+			for _, host := range hosts {
+				rebaseHost(host)
+			}
+		}
+		return value
+	}
+
+	var rebaseCommand func(value interface{})
+	rebaseCommand = func(value interface{}) {
+		cmd, ok := value.(map[string]interface{})
+		if !ok {
+			return
+		}
+
+		for _, key := range []string{"stdout", "stderr"} {
+			if output, ok := cmd[key]; ok {
+				cmd[key] = rebaseOutput(output)
+			}
+		}
+
+		children, _ := cmd["commands"].([]interface{})
+		for _, child := range children {
+			rebaseCommand(child)
+		}
+	}
+
+	imports, _ := job["import"].([]interface{})
+	for i, imp := range imports {
+		imports[i] = rebase(imp)
+	}
+
+	rebaseKeys(job, "calendar")
+	if output, ok := job["output"]; ok {
+		job["output"] = rebaseOutput(output)
+	}
+
+	rebaseHost(job["host"])
+	if files, ok := job["hosts"].([]interface{}); ok {
+		for i, f := range files {
+			files[i] = rebaseHostsFile(f)
+		}
+	} else if f, ok := job["hosts"]; ok {
+		job["hosts"] = rebaseHostsFile(f)
+	}
+
+	for key := range commandKeys {
+		rebaseCommand(job[key])
+	}
+	return err
+}
+
+// mergeJob merges the job into its base. Objects are merged recursively,
+// other values and command trees replace the base's ones. A null value
+// removes the option inherited from the base. Imports are combined, so
+// inherited commands can still include commands of the base's libraries.
+func mergeJob(base, job map[string]interface{}) map[string]interface{} {
+	merged := mergeObjects(base, job)
+	for key := range commandKeys {
+		if value, ok := job[key]; ok && value != nil {
+			merged[key] = value
+		}
+	}
+
+	baseImports, _ := base["import"].([]interface{})
+	imports, ok := job["import"].([]interface{})
+	if ok && len(baseImports) > 0 {
+		merged["import"] = append(append([]interface{}(nil), baseImports...), imports...)
+	}
+	return merged
+}
+
+func mergeObjects(base, override map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(base)+len(override))
+	for key, value := range base {
+		merged[key] = value
+	}
+
+	for key, value := range override {
+		if value == nil {
+			delete(merged, key)
+			continue
+		}
+
+		baseObject, baseIsObject := merged[key].(map[string]interface{})
+		object, isObject := value.(map[string]interface{})
+		if baseIsObject && isObject {
+			merged[key] = mergeObjects(baseObject, object)
+		} else {
+			merged[key] = value
+		}
+	}
+	return merged
+}
@@ -0,0 +1,202 @@
+// Copyright (c) 2016 Niklas Wolber
+// This file is licensed under the MIT license.
+// See the LICENSE file for more information.
+
+package job
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadConfigExtends(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"base/common.lib": `{"commands": {"cleanup": {"command": "rm -rf /tmp/job"}}}`,
+		"base/root.job": `{
+			"schedule": "@every 1h",
+			"telemetry": true
+		}`,
+		"base/base.job": `{
+			// shared settings
+			"extends": "root.job",
+			"import": ["common.lib"],
+			"timeout": "1m",
+			"output": {"file": "base.log", "raw": true},
+			"forwarding": {"remoteHost": "localhost", "remotePort": 80, "localPort": 8080},
+			"host": {"addr": "localhost", "user": "base"},
+			"pre": {"command": "echo pre"},
+			"command": {"flow": "sequential", "commands": [{"command": "a"}, {"command": "b"}]},
+			"post": {"include": "cleanup"}
+		}`,
+		"test.job": `{
+			"extends": "base/base.job",
+			"name": "child",
+			"timeout": "5m",
+			"output": {"file": "child.log"},
+			"host": {"user": "child"},
+			"forwarding": null,
+			"command": {"command": "c"}
+		}`,
+	})
+	defer os.RemoveAll(dir)
+
+	c, err := ReadConfig(filepath.Join(dir, "test.job"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect(t, "child", c.Name)
+	expect(t, "@every 1h", c.Schedule)
+	expect(t, true, c.Telemetry)
+	expect(t, "5m", c.Timeout)
+	expect(t, Output{File: "child.log", Raw: true}, *c.Output)
+	expect(t, "localhost", c.Host.Addr)
+	expect(t, "child", c.Host.User)
+	expect(t, (*Forwarding)(nil), c.Forwarding)
+	expect(t, "echo pre", c.Pre.Command)
+	expect(t, "c", c.Command.Command)
+	expect(t, 0, len(c.Command.Commands))
+	expect(t, "", c.Command.Flow)
+	expect(t, "rm -rf /tmp/job", c.Post.Command)
+
+	expect(t, false, strings.Contains(c.JSON(), "extends"))
+
+	deps := c.Dependencies()
+	expect(t, 3, len(deps))
+	expect(t, filepath.Join(dir, "base/root.job"), deps[0])
+	expect(t, filepath.Join(dir, "base/base.job"), deps[1])
+	expect(t, filepath.Join(dir, "base/common.lib"), deps[2])
+}
+
+func TestReadConfigExtendsErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{
+			name: "cycle",
+			files: map[string]string{
+				"a.job":    `{"extends": "test.job"}`,
+				"test.job": `{"extends": "a.job"}`,
+			},
+			want: "extends cycle",
+		},
+		{
+			name: "missing base",
+			files: map[string]string{
+				"test.job": `{"extends": "missing.job"}`,
+			},
+			want: `test.job: extends "missing.job"`,
+		},
+		{
+			name: "invalid extends",
+			files: map[string]string{
+				"test.job": `{"extends": 42}`,
+			},
+			want: "extends has to be a file name",
+		},
+	}
+
+	for _, test := range tests {
+		dir := writeFiles(t, test.files)
+		_, err := ReadConfig(filepath.Join(dir, "test.job"))
+		os.RemoveAll(dir)
+
+		if err == nil {
+			t.Errorf("%s: expected an error", test.name)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: want error containing %q, got %q", test.name, test.want, err)
+		}
+	}
+}
+
+func TestReadConfigAbstract(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"base.job": `{
+			"abstract": true,
+			"schedule": "@hourly",
+			"host": {"addr": "localhost"}
+		}`,
+		"web.job": `{
+			"extends": "base.job",
+			"command": {"command": "true"}
+		}`,
+	})
+	defer os.RemoveAll(dir)
+
+	base, err := ReadConfig(filepath.Join(dir, "base.job"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, true, base.Abstract)
+
+	web, err := ReadConfig(filepath.Join(dir, "web.job"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, false, web.Abstract)
+	expect(t, "@hourly", web.Schedule)
+}
+
+func TestReadConfigExtendsPaths(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"base/base.job": `{
+			"calendar": "holidays.json",
+			"output": "base.log",
+			"host": {"addr": "localhost", "privateKey": "keys/id", "jump": {"addr": "bastion", "privateKey": "/keys/jump"}},
+			"hosts": [{"file": "hosts.json"}, {"sshConfig": "ssh_config"}],
+			"command": {"commands": [
+				{"command": "a", "stdout": "a.txt"},
+				{"command": "b", "stderr": {"file": "{{.Host.Name}}.err"}}
+			]}
+		}`,
+		"test.job": `{
+			"extends": "base/base.job",
+			"name": "child",
+			"host": null,
+			"pre": {"command": "true", "stdout": "pre.txt"}
+		}`,
+	})
+	defer os.RemoveAll(dir)
+
+	c, err := ReadConfig(filepath.Join(dir, "test.job"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base := filepath.Join(dir, "base")
+	expect(t, filepath.Join(base, "holidays.json"), c.Calendar)
+	expect(t, filepath.Join(base, "base.log"), c.Output.File)
+	expect(t, 2, len(c.HostsFile))
+	expect(t, filepath.Join(base, "hosts.json"), c.HostsFile[0].File)
+	expect(t, filepath.Join(base, "ssh_config"), c.HostsFile[1].SSHConfig)
+	expect(t, filepath.Join(base, "a.txt"), c.Command.Commands[0].Stdout.File)
+	// templates may evaluate to any path
+	expect(t, "{{.Host.Name}}.err", c.Command.Commands[1].Stderr.File)
+	// paths of the extending job are kept
+	expect(t, "pre.txt", c.Pre.Stdout.File)
+
+	c, err = ReadConfig(filepath.Join(base, "base.job"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "keys/id", c.Host.PrivateKey)
+
+	dir = writeFiles(t, map[string]string{
+		"base/base.job": `{"host": {"addr": "localhost", "privateKey": "keys/id", "jump": {"addr": "bastion", "privateKey": "/keys/jump"}}}`,
+		"test.job":      `{"extends": "base/base.job", "command": {"command": "true"}}`,
+	})
+	defer os.RemoveAll(dir)
+
+	c, err = ReadConfig(filepath.Join(dir, "test.job"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, filepath.Join(dir, "base", "keys/id"), c.Host.PrivateKey)
+	expect(t, "/keys/jump", c.Host.Jump.PrivateKey)
+}
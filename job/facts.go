@@ -0,0 +1,137 @@
+// Copyright (c) 2016 Niklas Wolber
+// This file is licensed under the MIT license.
+// See the LICENSE file for more information.
+
+package job
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	errs "github.com/pkg/errors"
+)
+
+// factsProbe is a shell script that prints the facts of a host as lines of
+// the form path=value. Path elements are separated by dots.
+var factsProbe = strings.Join([]string{
+	`echo "hostname=$(hostname 2>/dev/null)"`,
+	`echo "kernel.name=$(uname -s 2>/dev/null)"`,
+	`echo "kernel.release=$(uname -r 2>/dev/null)"`,
+	`echo "kernel.machine=$(uname -m 2>/dev/null)"`,
+	`[ -r /etc/os-release ] && sed -e '/^[A-Za-z_]*=/!d' -e 's/^/os./' /etc/os-release`,
+	`echo "cpu.count=$(getconf _NPROCESSORS_ONLN 2>/dev/null)"`,
+	`[ -r /proc/meminfo ] && awk '/^MemTotal:/ { print "memory.total_kb=" $2 }' /proc/meminfo`,
+	`echo "ips=$(hostname -I 2>/dev/null)"`,
+	`true`,
+}, "; ")
+
+// Facts describe a host, e.g. its operating system, as gathered by the
+// facts probe.
+type Facts map[string]interface{}
+
+// gatherFacts runs the facts probe either through the SSH client or, if it
+// is nil, locally.
+func gatherFacts(ctx context.Context, s *sshClient) (Facts, error) {
+	var stdout bytes.Buffer
+
+	if s != nil {
+		if err := s.executeCommand(ctx, factsProbe, &stdout, nil, nil); err != nil {
+			return nil, errs.Wrap(err, "facts probe failed")
+		}
+	} else {
+		cmd := exec.CommandContext(ctx, "sh", "-c", factsProbe)
+		cmd.Stdout = &stdout
+		if err := cmd.Run(); err != nil {
+			return nil, errs.Wrap(err, "facts probe failed")
+		}
+	}
+
+	return parseFacts(&stdout)
+}
+
+// parseFacts parses the output of the facts probe. Keys are lower-cased,
+// quoted values are unquoted. Empty values are omitted.
+func parseFacts(r io.Reader) (Facts, error) {
+	facts := make(Facts)
+
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := s.Text()
+		i := strings.Index(line, "=")
+		if i <= 0 {
+			continue
+		}
+
+		path := strings.Split(strings.ToLower(line[:i]), ".")
+		value := unquoteFact(strings.TrimSpace(line[i+1:]))
+		if value == "" {
+			continue
+		}
+
+		facts.set(path, convertFact(path, value))
+	}
+
+	return facts, errs.Wrap(s.Err(), "failed to read facts")
+}
+
+func (f Facts) set(path []string, value interface{}) {
+	m := f
+	for _, key := range path[:len(path)-1] {
+		child, ok := m[key].(Facts)
+		if !ok {
+			child = make(Facts)
+			m[key] = child
+		}
+		m = child
+	}
+	m[path[len(path)-1]] = value
+}
+
+func unquoteFact(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		if value[0] == '"' {
+			if unquoted, err := strconv.Unquote(value); err == nil {
+				return unquoted
+			}
+		}
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+// convertFact converts well-known numeric and list facts.
+func convertFact(path []string, value string) interface{} {
+	switch strings.Join(path, ".") {
+	case "cpu.count", "memory.total_kb":
+		if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return i
+		}
+	case "ips":
+		return strings.Fields(value)
+	}
+	return value
+}
+
+// isTrue reports whether the result of a when expression is true. Empty
+// results, "false", "0" and "<no value>" are false.
+func isTrue(result string) bool {
+	switch strings.TrimSpace(result) {
+	case "", "false", "0", "<no value>":
+		return false
+	}
+	return true
+}
+
+// whenTemplate turns a when expression into a template. Expressions without
+// actions are used as a single action, e.g. `eq .Facts.os.id "ubuntu"`.
+func whenTemplate(expr string) string {
+	if strings.Contains(expr, "{{") {
+		return expr
+	}
+	return "{{" + expr + "}}"
+}
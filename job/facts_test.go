@@ -0,0 +1,109 @@
+// Copyright (c) 2016 Niklas Wolber
+// This file is licensed under the MIT license.
+// See the LICENSE file for more information.
+
+package job
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nwolber/xCUTEr/flunc"
+	"github.com/nwolber/xCUTEr/logger"
+)
+
+const factsOutput = `hostname=web1
+kernel.name=Linux
+kernel.release=4.4.0-21-generic
+kernel.machine=x86_64
+os.NAME="Ubuntu"
+os.ID=ubuntu
+os.VERSION_ID="16.04"
+os.PRETTY_NAME='Ubuntu 16.04 LTS'
+cpu.count=4
+memory.total_kb=8167848
+ips=10.0.0.1 192.168.1.1
+os.EMPTY=
+garbage
+`
+
+func TestParseFacts(t *testing.T) {
+	facts, err := parseFacts(strings.NewReader(factsOutput))
+	expect(t, nil, err)
+
+	want := Facts{
+		"hostname": "web1",
+		"kernel": Facts{
+			"name":    "Linux",
+			"release": "4.4.0-21-generic",
+			"machine": "x86_64",
+		},
+		"os": Facts{
+			"name":        "Ubuntu",
+			"id":          "ubuntu",
+			"version_id":  "16.04",
+			"pretty_name": "Ubuntu 16.04 LTS",
+		},
+		"cpu":    Facts{"count": int64(4)},
+		"memory": Facts{"total_kb": int64(8167848)},
+		"ips":    []string{"10.0.0.1", "192.168.1.1"},
+	}
+
+	if !reflect.DeepEqual(want, facts) {
+		t.Errorf("want %#v, got %#v", want, facts)
+	}
+}
+
+func TestGatherFactsLocally(t *testing.T) {
+	facts, err := gatherFacts(context.Background(), nil)
+	expect(t, nil, err)
+
+	if _, ok := facts["kernel"]; !ok {
+		t.Errorf("expected kernel facts, got %#v", facts)
+	}
+}
+
+func TestWhen(t *testing.T) {
+	facts, err := parseFacts(strings.NewReader(factsOutput))
+	expect(t, nil, err)
+
+	ctx := context.WithValue(context.Background(), LoggerKey, logger.New(log.New(ioutil.Discard, "", 0), false))
+	ctx = context.WithValue(ctx, TemplatingKey, &TemplatingEngine{Config: &Config{}, Facts: facts})
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{`eq .Facts.os.id "ubuntu"`, true},
+		{`{{eq .Facts.os.id "debian"}}`, false},
+		{`{{if ge .Facts.cpu.count 4}}big{{end}}`, true},
+		{`.Facts.missing`, false},
+		{`"0"`, false},
+	}
+
+	b := &ExecutionTreeBuilder{}
+	for _, test := range tests {
+		called := false
+		child := flunc.MakeFlunc(func(ctx context.Context) (context.Context, error) {
+			called = true
+			return nil, nil
+		})
+
+		_, err := b.When(test.expr, child).(flunc.Flunc)(ctx)
+		expect(t, nil, err)
+		if called != test.want {
+			t.Errorf("%s: want %t, got %t", test.expr, test.want, called)
+		}
+	}
+
+	_, err = b.When(`eq .Facts.os.id`, flunc.MakeFlunc(func(ctx context.Context) (context.Context, error) {
+		return nil, nil
+	})).(flunc.Flunc)(ctx)
+	if err == nil {
+		t.Error("expected an error for an invalid expression")
+	}
+}
@@ -0,0 +1,291 @@
+// Copyright (c) 2016 Niklas Wolber
+// This file is licensed under the MIT license.
+// See the LICENSE file for more information.
+
+package job
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	errs "github.com/pkg/errors"
+)
+
+// templateFuncs are the functions available in templates, that don't depend
+// on a TemplatingEngine. Functions taking multiple arguments expect the value
+// they operate on last, so they can be used in pipelines, e.g.
+// {{.Host.Name | replace "-" "_" | upper}}.
+var templateFuncs = template.FuncMap{
+	"date": func(t time.Time) string {
+		return fmt.Sprintf("%04d-%02d-%02d", t.Year(), t.Month(), t.Day())
+	},
+	"time": func(t time.Time) string {
+		return fmt.Sprintf("%02d:%02d:%02d", t.Hour(), t.Minute(), t.Second())
+	},
+
+	"upper":      strings.ToUpper,
+	"lower":      strings.ToLower,
+	"trim":       strings.TrimSpace,
+	"replace":    replaceFunc,
+	"split":      splitFunc,
+	"join":       joinFunc,
+	"default":    defaultFunc,
+	"quote":      strconv.Quote,
+	"shellQuote": shellQuote,
+	"toJson":     toJSON,
+	"fromJson":   fromJSON,
+	"env":        envFunc,
+
+	"formatTime":     formatTime,
+	"duration":       time.ParseDuration,
+	"formatDuration": formatDuration,
+	"timeAdd":        timeAdd,
+
+	"sha256":       sha256Func,
+	"base64":       base64Encode,
+	"base64Decode": base64Decode,
+
+	"whereTag":  whereTag,
+	"inGroup":   inGroup,
+	"except":    except,
+	"sortHosts": sortHosts,
+	"addrs":     addrs,
+}
+
+// engineFuncs returns the functions available in templates, that depend on
+// the TemplatingEngine.
+func (t *TemplatingEngine) engineFuncs() template.FuncMap {
+	return template.FuncMap{
+		"now": func() time.Time {
+			return t.now()
+		},
+		"hostsWithTag": t.hostsWithTag,
+	}
+}
+
+// replaceFunc replaces all occurrences of old in s with new.
+func replaceFunc(old, new, s string) string {
+	return strings.Replace(s, old, new, -1)
+}
+
+// splitFunc splits s at every occurrence of sep.
+func splitFunc(sep, s string) []string {
+	return strings.Split(s, sep)
+}
+
+// joinFunc joins all elements of list with sep. The elements are formatted
+// with fmt.Sprint.
+func joinFunc(sep string, list interface{}) (string, error) {
+	if s, ok := list.([]string); ok {
+		return strings.Join(s, sep), nil
+	}
+
+	v := reflect.ValueOf(list)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return "", errs.Errorf("join: expected a list, got %T", list)
+	}
+
+	elems := make([]string, v.Len())
+	for i := range elems {
+		elems[i] = fmt.Sprint(v.Index(i).Interface())
+	}
+	return strings.Join(elems, sep), nil
+}
+
+// defaultFunc returns def, if value is missing or the zero value of its type.
+func defaultFunc(def, value interface{}) interface{} {
+	if value == nil {
+		return def
+	}
+
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Array, reflect.String:
+		if v.Len() == 0 {
+			return def
+		}
+	default:
+		if reflect.DeepEqual(value, reflect.Zero(v.Type()).Interface()) {
+			return def
+		}
+	}
+	return value
+}
+
+// shellQuote quotes s for use as a single argument in a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+func toJSON(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	return string(b), errs.Wrap(err, "toJson")
+}
+
+func fromJSON(s string) (interface{}, error) {
+	var v interface{}
+	err := json.Unmarshal([]byte(s), &v)
+	return v, errs.Wrap(err, "fromJson")
+}
+
+// envFunc returns the value of the environment variable or the first fallback,
+// if it is not set.
+func envFunc(name string, fallback ...string) string {
+	if value, ok := os.LookupEnv(name); ok {
+		return value
+	}
+
+	if len(fallback) > 0 {
+		return fallback[0]
+	}
+	return ""
+}
+
+// formatTime formats t according to the layout, as defined by the time
+// package, e.g. "2006-01-02T15:04:05".
+func formatTime(layout string, t time.Time) string {
+	return t.Format(layout)
+}
+
+// formatDuration formats a duration either given as time.Duration or as a
+// string, e.g. "90m" becomes "1h30m0s".
+func formatDuration(d interface{}) (string, error) {
+	switch d := d.(type) {
+	case time.Duration:
+		return d.String(), nil
+	case string:
+		parsed, err := time.ParseDuration(d)
+		return parsed.String(), errs.Wrap(err, "formatDuration")
+	}
+	return "", errs.Errorf("formatDuration: expected a duration, got %T", d)
+}
+
+// timeAdd adds the duration to t, e.g. {{now | timeAdd "-24h" | date}}.
+func timeAdd(d string, t time.Time) (time.Time, error) {
+	parsed, err := time.ParseDuration(d)
+	if err != nil {
+		return time.Time{}, errs.Wrap(err, "timeAdd")
+	}
+	return t.Add(parsed), nil
+}
+
+// sha256Func returns the hex encoded SHA-256 hash of s.
+func sha256Func(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func base64Encode(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+func base64Decode(s string) (string, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	return string(b), errs.Wrap(err, "base64Decode")
+}
+
+// hostsWithTag returns all hosts of the job that have the tag. If values are
+// given, the tag has to have one of them.
+func (t *TemplatingEngine) hostsWithTag(key string, values ...string) []*Host {
+	var hosts []*Host
+	for _, h := range t.hosts {
+		value, ok := h.tag(key)
+		if !ok {
+			continue
+		}
+
+		if len(values) == 0 {
+			hosts = append(hosts, h)
+			continue
+		}
+
+		for _, v := range values {
+			if v == value {
+				hosts = append(hosts, h)
+				break
+			}
+		}
+	}
+	return hosts
+}
+
+// whereTag returns the hosts whose tag key has the value.
+func whereTag(key, value string, hosts []*Host) []*Host {
+	var selected []*Host
+	for _, h := range hosts {
+		if v, ok := h.tag(key); ok && v == value {
+			selected = append(selected, h)
+		}
+	}
+	return selected
+}
+
+// inGroup returns the hosts that are a member of the group.
+func inGroup(group string, hosts []*Host) []*Host {
+	var selected []*Host
+	for _, h := range hosts {
+		if h.InGroup(group) {
+			selected = append(selected, h)
+		}
+	}
+	return selected
+}
+
+// except returns all hosts but h, e.g. the peers of the current host.
+func except(h *Host, hosts []*Host) []*Host {
+	var selected []*Host
+	for _, host := range hosts {
+		if host != h && (h == nil || host.String() != h.String()) {
+			selected = append(selected, host)
+		}
+	}
+	return selected
+}
+
+// sortHosts returns a copy of hosts sorted by the key, which is one of name,
+// addr, port, user or tags.<name>.
+func sortHosts(key string, hosts []*Host) ([]*Host, error) {
+	var less func(a, b *Host) bool
+	switch {
+	case key == "name":
+		less = func(a, b *Host) bool { return a.String() < b.String() }
+	case key == "addr":
+		less = func(a, b *Host) bool { return a.Addr < b.Addr }
+	case key == "port":
+		less = func(a, b *Host) bool { return a.Port < b.Port }
+	case key == "user":
+		less = func(a, b *Host) bool { return a.User < b.User }
+	case strings.HasPrefix(key, "tags."):
+		tag := strings.TrimPrefix(key, "tags.")
+		less = func(a, b *Host) bool {
+			ta, _ := a.tag(tag)
+			tb, _ := b.tag(tag)
+			return ta < tb
+		}
+	default:
+		return nil, errs.Errorf("sortHosts: unknown key %q", key)
+	}
+
+	sorted := append([]*Host(nil), hosts...)
+	sort.SliceStable(sorted, func(i, j int) bool { return less(sorted[i], sorted[j]) })
+	return sorted, nil
+}
+
+// addrs returns the addresses of the hosts.
+func addrs(hosts []*Host) []string {
+	addrs := make([]string, len(hosts))
+	for i, h := range hosts {
+		addrs[i] = h.Addr
+	}
+	return addrs
+}
@@ -0,0 +1,168 @@
+// Copyright (c) 2016 Niklas Wolber
+// This file is licensed under the MIT license.
+// See the LICENSE file for more information.
+
+package job
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTemplateFuncs(t *testing.T) {
+	os.Setenv("XCUTER_TEST_FUNCS", "set")
+	defer os.Unsetenv("XCUTER_TEST_FUNCS")
+
+	hosts := []*Host{
+		{Name: "db1", Tags: map[string]string{"role": "db"}},
+		{Name: "db2", Tags: map[string]string{"role": "db", "primary": "true"}},
+		{Name: "web1", Tags: map[string]string{"role": "web"}},
+	}
+
+	tt := newTemplatingEngine(&Config{}, &Host{Name: "web-1"}, hosts)
+	tt.now = func() time.Time {
+		return time.Date(2016, 12, 24, 18, 30, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		templ, want string
+	}{
+		{`{{"abc" | upper}}`, "ABC"},
+		{`{{"ABC" | lower}}`, "abc"},
+		{`{{"  abc  " | trim}}`, "abc"},
+		{`{{.Host.Name | replace "-" "_" | upper}}`, "WEB_1"},
+		{`{{"a,b,c" | split "," | join ";"}}`, "a;b;c"},
+		{`{{index (split "," "a,b,c") 1}}`, "b"},
+		{`{{"" | default "fallback"}}`, "fallback"},
+		{`{{"value" | default "fallback"}}`, "value"},
+		{`{{0 | default 42}}`, "42"},
+		{`{{.Env.XCUTER_TEST_UNSET | default "fallback"}}`, "fallback"},
+		{`{{"a \"b\"" | quote}}`, `"a \"b\""`},
+		{`{{"it's; rm -rf /" | shellQuote}}`, `'it'\''s; rm -rf /'`},
+		{`{{"a,b" | split "," | toJson}}`, `["a","b"]`},
+		{`{{(fromJson "{\"a\": [1, 2]}").a | toJson}}`, `[1,2]`},
+		{`{{env "XCUTER_TEST_FUNCS" "fallback"}}`, "set"},
+		{`{{env "XCUTER_TEST_UNSET" "fallback"}}`, "fallback"},
+		{`{{env "XCUTER_TEST_UNSET"}}`, ""},
+		{`{{now | formatTime "2006-01-02T15:04"}}`, "2016-12-24T18:30"},
+		{`{{now | timeAdd "-24h" | date}}`, "2016-12-23"},
+		{`{{"90m" | formatDuration}}`, "1h30m0s"},
+		{`{{duration "1m30s" | formatDuration}}`, "1m30s"},
+		{`{{"abc" | sha256}}`, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{`{{"abc" | base64}}`, "YWJj"},
+		{`{{"YWJj" | base64Decode}}`, "abc"},
+		{`{{range hostsWithTag "role" "db"}}{{.Name}} {{end}}`, "db1 db2 "},
+		{`{{range hostsWithTag "primary"}}{{.Name}} {{end}}`, "db2 "},
+		{`{{range hostsWithTag "role" "web" "db"}}{{.Name}} {{end}}`, "db1 db2 web1 "},
+		{`{{len (hostsWithTag "role" "cache")}}`, "0"},
+	}
+
+	for _, test := range tests {
+		got, err := tt.Interpolate(test.templ)
+		if err != nil {
+			t.Errorf("%s: unexpected error %s", test.templ, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s: want %q, got %q", test.templ, test.want, got)
+		}
+	}
+
+	for _, templ := range []string{
+		`{{fromJson "{"}}`,
+		`{{"!" | base64Decode}}`,
+		`{{now | timeAdd "yesterday"}}`,
+		`{{5 | join ","}}`,
+	} {
+		if _, err := tt.Interpolate(templ); err == nil {
+			t.Errorf("%s: expected an error", templ)
+		}
+	}
+}
+
+func TestCrossHostTemplates(t *testing.T) {
+	db1 := &Host{Name: "db1", Addr: "10.0.0.2", Tags: map[string]string{"role": "db", "rack": "b"}, Groups: []string{"db", "prod"}}
+	db2 := &Host{Name: "db2", Addr: "10.0.0.1", Tags: map[string]string{"role": "db", "rack": "a"}, Groups: []string{"db"}}
+	web1 := &Host{Name: "web1", Addr: "10.0.1.1", Tags: map[string]string{"role": "web"}, Groups: []string{"prod"}}
+	tt := newTemplatingEngine(&Config{}, db1, []*Host{db1, db2, web1})
+
+	tests := []struct {
+		templ, want string
+	}{
+		{`--peers={{range .Hosts}}{{.Addr}},{{end}}`, "--peers=10.0.0.2,10.0.0.1,10.0.1.1,"},
+		{`{{.Hosts | addrs | join ","}}`, "10.0.0.2,10.0.0.1,10.0.1.1"},
+		{`{{.Hosts | except .Host | addrs | join ","}}`, "10.0.0.1,10.0.1.1"},
+		{`{{.Hosts | whereTag "role" "db" | sortHosts "addr" | addrs | join ","}}`, "10.0.0.1,10.0.0.2"},
+		{`{{range .Hosts | sortHosts "tags.rack"}}{{.Name}} {{end}}`, "web1 db2 db1 "},
+		{`{{.Hosts | inGroup "prod" | addrs | join ","}}`, "10.0.0.2,10.0.1.1"},
+		{`{{range .Groups.db}}{{.Name}} {{end}}`, "db1 db2 "},
+		{`{{len .Groups.prod}}`, "2"},
+	}
+
+	for _, test := range tests {
+		got, err := tt.Interpolate(test.templ)
+		if err != nil {
+			t.Errorf("%s: unexpected error %s", test.templ, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s: want %q, got %q", test.templ, test.want, got)
+		}
+	}
+
+	if _, err := tt.Interpolate(`{{.Hosts | sortHosts "color"}}`); err == nil {
+		t.Error("expected an error for an unknown sort key")
+	}
+}
+
+// templatingRecorder records the hosts each Templating node is built with.
+type templatingRecorder struct {
+	*StringBuilder
+	hosts [][]*Host
+}
+
+func (r *templatingRecorder) Templating(c *Config, h *Host, hosts []*Host) interface{} {
+	r.hosts = append(r.hosts, hosts)
+	return r.StringBuilder.Templating(c, h, hosts)
+}
+
+func TestTemplatingHostsPerTree(t *testing.T) {
+	c := &Config{
+		Name:      "Test Job",
+		HostsFile: hostsFileOrArray{{Hosts: []*Host{{Name: "web-2"}, {Name: "web-1"}}}},
+		Command:   &Command{Command: "true"},
+	}
+
+	first := &templatingRecorder{StringBuilder: &StringBuilder{}}
+	if _, err := VisitConfig(first, c); err != nil {
+		t.Fatal(err)
+	}
+
+	// resolving the hosts again doesn't affect the first tree
+	c.HostsFile = hostsFileOrArray{{Hosts: []*Host{{Name: "db-1"}}}}
+	second := &templatingRecorder{StringBuilder: &StringBuilder{}}
+	if _, err := VisitConfig(second, c); err != nil {
+		t.Fatal(err)
+	}
+
+	// job and hosts
+	expect(t, 3, len(first.hosts))
+	for _, hosts := range first.hosts {
+		expect(t, "web-1 web-2", strings.Join(hostNames(hosts), " "))
+	}
+
+	expect(t, 2, len(second.hosts))
+	for _, hosts := range second.hosts {
+		expect(t, "db-1", strings.Join(hostNames(hosts), " "))
+	}
+}
+
+func hostNames(hosts []*Host) []string {
+	var names []string
+	for _, h := range hosts {
+		names = append(names, h.Name)
+	}
+	return names
+}
@@ -0,0 +1,357 @@
+// Copyright (c) 2016 Niklas Wolber
+// This file is licensed under the MIT license.
+// See the LICENSE file for more information.
+
+package job
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	errs "github.com/pkg/errors"
+)
+
+// A library is a file of named commands, that can be included by jobs and
+// other libraries.
+type library struct {
+	Import   []string            `json:"import,omitempty"`
+	Commands map[string]*Command `json:"commands,omitempty"`
+}
+
+// libraryCommand is a command defined by a library.
+type libraryCommand struct {
+	cmd  *Command
+	file string
+}
+
+func (l *libraryCommand) location(name string) string {
+	return fmt.Sprintf("%s: commands.%s", l.file, name)
+}
+
+// paramRegex matches parameter references of the form {{.Params.name}}.
+var paramRegex = regexp.MustCompile(`{{\s*\.Params\.([A-Za-z_][A-Za-z0-9_]*)\s*}}`)
+
+// includeResolver loads libraries and replaces includes with the commands
+// they reference.
+type includeResolver struct {
+	commands map[string]*libraryCommand
+	// Absolute paths of all loaded libraries.
+	loaded map[string]bool
+	files  []string
+}
+
+func newIncludeResolver() *includeResolver {
+	return &includeResolver{
+		commands: make(map[string]*libraryCommand),
+		loaded:   make(map[string]bool),
+	}
+}
+
+// resolveIncludes loads all libraries imported by the job file and replaces
+// includes in the Config's commands. Import paths are relative to the
+// importing file.
+func (c *Config) resolveIncludes(file string) error {
+	r := newIncludeResolver()
+	for _, imp := range c.Import {
+		if err := r.load(importPath(file, imp)); err != nil {
+			return errs.Wrapf(err, "%s: import %q", file, imp)
+		}
+	}
+
+	for _, cmd := range []struct {
+		name string
+		cmd  **Command
+	}{
+		{"pre", &c.Pre},
+		{"command", &c.Command},
+		{"post", &c.Post},
+	} {
+		expanded, err := r.expand(*cmd.cmd, file+": "+cmd.name, nil)
+		if err != nil {
+			return err
+		}
+		*cmd.cmd = expanded
+	}
+
+	c.libraries = r.files
+	return nil
+}
+
+func importPath(file, imp string) string {
+	imp = expandHome(imp)
+	if filepath.IsAbs(imp) {
+		return imp
+	}
+	return filepath.Join(filepath.Dir(file), imp)
+}
+
+// load reads the library and all libraries it imports. Every library is
+// only loaded once, so import cycles are harmless.
+func (r *includeResolver) load(file string) error {
+	path, err := filepath.Abs(file)
+	if err != nil {
+		return errs.Wrapf(err, "invalid library path %s", file)
+	}
+
+	if r.loaded[path] {
+		return nil
+	}
+	r.loaded[path] = true
+	r.files = append(r.files, file)
+
+	lib, err := readLibrary(file)
+	if err != nil {
+		return err
+	}
+
+	for name, cmd := range lib.Commands {
+		if cmd == nil {
+			continue
+		}
+
+		if existing, ok := r.commands[name]; ok {
+			return errs.Errorf("%s: command %q is already defined in %s", file, name, existing.file)
+		}
+		r.commands[name] = &libraryCommand{cmd: cmd, file: file}
+	}
+
+	for _, imp := range lib.Import {
+		if err := r.load(importPath(file, imp)); err != nil {
+			return errs.Wrapf(err, "%s: import %q", file, imp)
+		}
+	}
+	return nil
+}
+
+// readLibrary parses a library file. Syntax errors are reported with their
+// line and column.
+func readLibrary(file string) (*library, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errs.Wrap(err, "failed to read library")
+	}
+
+	// remove comments line by line, so offsets still match the line numbers
+	lines := bytes.Split(b, []byte("\n"))
+	for i, line := range lines {
+		if lines[i], err = ioutil.ReadAll(removeLineComments(bytes.NewReader(line), cLineComments)); err != nil {
+			return nil, errs.Wrap(err, "failed to read library")
+		}
+	}
+	b = bytes.Join(lines, []byte("\n"))
+
+	var lib library
+	if err := json.Unmarshal(b, &lib); err != nil {
+		// offsets point behind the offending byte
+		var offset int64
+		switch err := err.(type) {
+		case *json.SyntaxError:
+			offset = err.Offset
+		case *json.UnmarshalTypeError:
+			offset = err.Offset
+		}
+
+		if offset > 0 {
+			line, col := position(b, offset-1)
+			return nil, errs.Wrapf(err, "%s:%d:%d", file, line, col)
+		}
+		return nil, errs.Wrap(err, file)
+	}
+	return &lib, nil
+}
+
+// position returns line and column of the byte at offset in b.
+func position(b []byte, offset int64) (line, col int) {
+	if offset > int64(len(b)) {
+		offset = int64(len(b))
+	}
+	before := b[:offset]
+	line = bytes.Count(before, []byte("\n")) + 1
+	col = int(offset) - bytes.LastIndexByte(before, '\n')
+	return line, col
+}
+
+// expand replaces all includes in the command and its children. The location
+// describes the command in error messages, stack contains the names of the
+// commands currently being included.
+func (r *includeResolver) expand(cmd *Command, location string, stack []string) (*Command, error) {
+	if cmd == nil {
+		return nil, nil
+	}
+
+	if cmd.Include == "" {
+		if len(cmd.Params) > 0 {
+			return nil, errs.Errorf("%s: params are only allowed with include", location)
+		}
+
+		for i, child := range cmd.Commands {
+			expanded, err := r.expand(child, fmt.Sprintf("%s.commands[%d]", location, i), stack)
+			if err != nil {
+				return nil, err
+			}
+			cmd.Commands[i] = expanded
+		}
+		return cmd, nil
+	}
+
+	name := cmd.Include
+	for i, included := range stack {
+		if included == name {
+			return nil, errs.Errorf("%s: include cycle %s", location, strings.Join(append(stack[i:], name), " -> "))
+		}
+	}
+
+	def, ok := r.commands[name]
+	if !ok {
+		return nil, errs.Errorf("%s: unknown command %q", location, name)
+	}
+
+	if cmd.Command != "" || len(cmd.Commands) > 0 {
+		return nil, errs.Errorf("%s: include can't be combined with command or commands", location)
+	}
+
+	params := make(map[string]string, len(def.cmd.Params)+len(cmd.Params))
+	for param, value := range def.cmd.Params {
+		params[param] = value
+	}
+	for param, value := range cmd.Params {
+		params[param] = value
+	}
+
+	included := copyCommand(def.cmd)
+	included.Params = nil
+	if err := substituteParams(included, params); err != nil {
+		return nil, errs.Wrapf(err, "%s: include %q", location, name)
+	}
+
+	expanded, err := r.expand(included, def.location(name), append(stack, name))
+	if err != nil {
+		return nil, errs.Wrapf(err, "%s: include %q", location, name)
+	}
+
+	overlayCommand(expanded, cmd)
+	return expanded, nil
+}
+
+// overlayCommand overrides the options of the included command with the ones
+// set on the including command.
+func overlayCommand(included, cmd *Command) {
+	if cmd.Name != "" {
+		included.Name = cmd.Name
+	}
+	if cmd.Flow != "" {
+		included.Flow = cmd.Flow
+	}
+	if cmd.Target != "" {
+		included.Target = cmd.Target
+	}
+	if cmd.Retries != 0 {
+		included.Retries = cmd.Retries
+	}
+	if cmd.Timeout != "" {
+		included.Timeout = cmd.Timeout
+	}
+	if cmd.IgnoreError {
+		included.IgnoreError = true
+	}
+	if cmd.Stdout != nil {
+		included.Stdout = cmd.Stdout
+	}
+	if cmd.Stderr != nil {
+		included.Stderr = cmd.Stderr
+	}
+	if cmd.When != "" {
+		included.When = cmd.When
+	}
+}
+
+// copyCommand returns a deep copy of the command.
+func copyCommand(cmd *Command) *Command {
+	c := *cmd
+
+	if cmd.Stdout != nil {
+		stdout := *cmd.Stdout
+		c.Stdout = &stdout
+	}
+	if cmd.Stderr != nil {
+		stderr := *cmd.Stderr
+		c.Stderr = &stderr
+	}
+
+	if cmd.Params != nil {
+		c.Params = make(map[string]string, len(cmd.Params))
+		for param, value := range cmd.Params {
+			c.Params[param] = value
+		}
+	}
+
+	if cmd.Commands != nil {
+		c.Commands = make([]*Command, len(cmd.Commands))
+		for i, child := range cmd.Commands {
+			c.Commands[i] = copyCommand(child)
+		}
+	}
+	return &c
+}
+
+// substituteParams replaces the parameter references in the command and its
+// children with their values. Parameters of nested includes are substituted
+// as well, so parameters can be passed on.
+func substituteParams(cmd *Command, params map[string]string) error {
+	fields := []*string{&cmd.Name, &cmd.Command, &cmd.Timeout, &cmd.When}
+	if cmd.Stdout != nil {
+		fields = append(fields, &cmd.Stdout.File)
+	}
+	if cmd.Stderr != nil {
+		fields = append(fields, &cmd.Stderr.File)
+	}
+
+	for _, field := range fields {
+		s, err := substitute(*field, params)
+		if err != nil {
+			return err
+		}
+		*field = s
+	}
+
+	for param, value := range cmd.Params {
+		s, err := substitute(value, params)
+		if err != nil {
+			return err
+		}
+		cmd.Params[param] = s
+	}
+
+	for _, child := range cmd.Commands {
+		if err := substituteParams(child, params); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func substitute(s string, params map[string]string) (string, error) {
+	var missing error
+	s = paramRegex.ReplaceAllStringFunc(s, func(ref string) string {
+		name := paramRegex.FindStringSubmatch(ref)[1]
+		value, ok := params[name]
+		if !ok && missing == nil {
+			missing = errs.Errorf("parameter %q is not set", name)
+		}
+		return value
+	})
+
+	if missing != nil {
+		return "", missing
+	}
+
+	if strings.Contains(s, ".Params") {
+		return "", errs.Errorf("parameters can only be referenced as {{.Params.name}} in %q", s)
+	}
+	return s, nil
+}
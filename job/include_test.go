@@ -0,0 +1,188 @@
+// Copyright (c) 2016 Niklas Wolber
+// This file is licensed under the MIT license.
+// See the LICENSE file for more information.
+
+package job
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const commonLib = `{
+	// shared commands
+	"import": ["other.lib"],
+	"commands": {
+		"backup": {
+			"params": {"dir": "/var/backup"},
+			"name": "Backup {{.Params.dir}}",
+			"flow": "sequential",
+			"commands": [
+				{"command": "mkdir -p {{.Params.dir}}"},
+				{"include": "archive", "params": {"file": "{{.Params.dir}}/etc.tgz"}}
+			]
+		}
+	}
+}`
+
+const otherLib = `{
+	"import": ["common.lib"],
+	"commands": {
+		"archive": {"command": "tar czf {{ .Params.file }} /etc", "stdout": "{{.Host.Name}}.txt"}
+	}
+}`
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "xCUTEr")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestReadConfigIncludes(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"libs/common.lib": commonLib,
+		"libs/other.lib":  otherLib,
+		"test.job": `{
+			"import": ["libs/common.lib"],
+			"host": {"addr": "localhost"},
+			"pre": {"include": "archive", "params": {"file": "local.tgz"}},
+			"command": {
+				"flow": "parallel",
+				"commands": [
+					{"include": "backup", "ignoreError": true},
+					{"include": "backup", "name": "Backup data", "params": {"dir": "/data/{{.Host.Name}}"}}
+				]
+			}
+		}`,
+	})
+	defer os.RemoveAll(dir)
+
+	c, err := ReadConfig(filepath.Join(dir, "test.job"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect(t, "tar czf local.tgz /etc", c.Pre.Command)
+	expect(t, "{{.Host.Name}}.txt", c.Pre.Stdout.File)
+
+	first := c.Command.Commands[0]
+	expect(t, "Backup /var/backup", first.Name)
+	expect(t, true, first.IgnoreError)
+	expect(t, "", first.Include)
+	expect(t, 0, len(first.Params))
+	expect(t, "mkdir -p /var/backup", first.Commands[0].Command)
+	expect(t, "tar czf /var/backup/etc.tgz /etc", first.Commands[1].Command)
+
+	second := c.Command.Commands[1]
+	expect(t, "Backup data", second.Name)
+	expect(t, false, second.IgnoreError)
+	expect(t, "mkdir -p /data/{{.Host.Name}}", second.Commands[0].Command)
+	expect(t, "tar czf /data/{{.Host.Name}}/etc.tgz /etc", second.Commands[1].Command)
+
+	deps := c.Dependencies()
+	expect(t, 2, len(deps))
+	expect(t, filepath.Join(dir, "libs/common.lib"), deps[0])
+	expect(t, filepath.Join(dir, "libs/other.lib"), deps[1])
+}
+
+func TestReadConfigIncludeErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{
+			name: "unknown command",
+			files: map[string]string{
+				"test.job": `{"command": {"commands": [{"command": "true"}, {"include": "missing"}]}}`,
+			},
+			want: `test.job: command.commands[1]: unknown command "missing"`,
+		},
+		{
+			name: "missing parameter",
+			files: map[string]string{
+				"a.lib":    `{"commands": {"a": {"command": "echo {{.Params.value}}"}}}`,
+				"test.job": `{"import": ["a.lib"], "command": {"include": "a"}}`,
+			},
+			want: `test.job: command: include "a": parameter "value" is not set`,
+		},
+		{
+			name: "unsupported parameter reference",
+			files: map[string]string{
+				"a.lib":    `{"commands": {"a": {"command": "echo {{.Params.value | upper}}"}}}`,
+				"test.job": `{"import": ["a.lib"], "command": {"include": "a", "params": {"value": "x"}}}`,
+			},
+			want: "parameters can only be referenced as {{.Params.name}}",
+		},
+		{
+			name: "cycle",
+			files: map[string]string{
+				"a.lib":    `{"import": ["b.lib"], "commands": {"a": {"commands": [{"include": "b"}]}}}`,
+				"b.lib":    `{"import": ["a.lib"], "commands": {"b": {"include": "a"}}}`,
+				"test.job": `{"import": ["a.lib"], "command": {"include": "a"}}`,
+			},
+			want: "include cycle a -> b -> a",
+		},
+		{
+			name: "duplicate command",
+			files: map[string]string{
+				"a.lib":    `{"commands": {"a": {"command": "true"}}}`,
+				"b.lib":    `{"commands": {"a": {"command": "false"}}}`,
+				"test.job": `{"import": ["a.lib", "b.lib"], "command": {"include": "a"}}`,
+			},
+			want: `b.lib: command "a" is already defined in`,
+		},
+		{
+			name: "include with command",
+			files: map[string]string{
+				"a.lib":    `{"commands": {"a": {"command": "true"}}}`,
+				"test.job": `{"import": ["a.lib"], "command": {"include": "a", "command": "false"}}`,
+			},
+			want: "include can't be combined with command or commands",
+		},
+		{
+			name: "syntax error",
+			files: map[string]string{
+				"a.lib":    "{\n\t// comment\n\t\"commands\": {\n\t\t\"a\": {\"command\": \"true\",}\n\t}\n}",
+				"test.job": `{"import": ["a.lib"], "command": {"include": "a"}}`,
+			},
+			want: "a.lib:4:27",
+		},
+		{
+			name: "missing library",
+			files: map[string]string{
+				"test.job": `{"import": ["missing.lib"], "command": {"command": "true"}}`,
+			},
+			want: `test.job: import "missing.lib"`,
+		},
+	}
+
+	for _, test := range tests {
+		dir := writeFiles(t, test.files)
+		_, err := ReadConfig(filepath.Join(dir, "test.job"))
+		os.RemoveAll(dir)
+
+		if err == nil {
+			t.Errorf("%s: expected an error", test.name)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: want error containing %q, got %q", test.name, test.want, err)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+// Copyright (c) 2016 Niklas Wolber
+// This file is licensed under the MIT license.
+// See the LICENSE file for more information.
+
+package job
+
+import (
+	"encoding/json"
+	"sort"
+
+	errs "github.com/pkg/errors"
+)
+
+// defaultPort is used for hosts and jump hosts of an inventory, that neither
+// they nor their groups set a port for.
+const defaultPort = 22
+
+// inventory is a hosts file that organizes hosts in groups.
+type inventory struct {
+	Groups map[string]*hostGroup `json:"groups,omitempty"`
+	Hosts  hostConfig            `json:"hosts,omitempty"`
+}
+
+// hostGroup holds defaults that are inherited by all hosts and child groups
+// of the group. Hosts and child groups may override the defaults.
+type hostGroup struct {
+	User       string                `json:"user,omitempty"`
+	Port       uint                  `json:"port,omitempty"`
+	PrivateKey string                `json:"privateKey,omitempty"`
+	Tags       map[string]string     `json:"tags,omitempty"`
+	Jump       *Host                 `json:"jump,omitempty"`
+	Hosts      hostConfig            `json:"hosts,omitempty"`
+	Children   map[string]*hostGroup `json:"children,omitempty"`
+}
+
+// isInventory reports whether the raw hosts file uses the inventory format.
+// That is the case if it has a "groups" property, that is an object of group
+// objects, and no properties besides "groups" and "hosts". A host named
+// "groups" in a flat hosts file has properties, that aren't objects, such as
+// its address.
+func isInventory(raw map[string]json.RawMessage) bool {
+	if _, ok := raw["groups"]; !ok {
+		return false
+	}
+
+	for key := range raw {
+		if key != "groups" && key != "hosts" {
+			return false
+		}
+	}
+
+	var groups map[string]json.RawMessage
+	if err := json.Unmarshal(raw["groups"], &groups); err != nil {
+		return false
+	}
+
+	for _, group := range groups {
+		var properties map[string]json.RawMessage
+		if err := json.Unmarshal(group, &properties); err != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// decodeHosts decodes either a flat hosts file or an inventory.
+func decodeHosts(b []byte) (hostConfig, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, err
+	}
+
+	if !isInventory(raw) {
+		var hosts hostConfig
+		if err := json.Unmarshal(b, &hosts); err != nil {
+			return nil, err
+		}
+		return hosts, nil
+	}
+
+	var inv inventory
+	if err := json.Unmarshal(b, &inv); err != nil {
+		return nil, errs.Wrap(err, "failed to decode inventory")
+	}
+
+	return inv.flatten(), nil
+}
+
+// flatten resolves the group hierarchy into a flat hostConfig. Every host
+// knows the names of all groups it is a member of, including the groups
+// its own groups are children of.
+func (inv *inventory) flatten() hostConfig {
+	hosts := make(hostConfig)
+	for name, host := range inv.Hosts {
+		addHost(hosts, name, host)
+	}
+
+	root := &hostGroup{}
+	for _, name := range sortedGroupNames(inv.Groups) {
+		inv.Groups[name].flatten(hosts, name, root, nil)
+	}
+
+	for _, host := range hosts {
+		setDefaultPort(host)
+	}
+
+	return hosts
+}
+
+// setDefaultPort sets the default port for the host and all jump hosts in
+// its chain, if they don't have one. Jump hosts are shared by all hosts of a
+// group, thus the jump hosts are copied instead of modified.
+func setDefaultPort(h *Host) {
+	if h.Port == 0 {
+		h.Port = defaultPort
+	}
+
+	for ; h.Jump != nil; h = h.Jump {
+		jump := *h.Jump
+		if jump.Port == 0 {
+			jump.Port = defaultPort
+		}
+		h.Jump = &jump
+	}
+}
+
+func (g *hostGroup) flatten(hosts hostConfig, name string, parent *hostGroup, path []string) {
+	g.inherit(parent)
+	path = append(path[:len(path):len(path)], name)
+
+	for hostName, host := range g.Hosts {
+		h := *host
+		h.Groups = append(append([]string{}, path...), host.Groups...)
+		g.apply(&h)
+		addHost(hosts, hostName, &h)
+	}
+
+	for _, childName := range sortedGroupNames(g.Children) {
+		g.Children[childName].flatten(hosts, childName, g, path)
+	}
+}
+
+// sortedGroupNames returns the group names in lexical order, so hosts that
+// are defined in multiple groups are merged deterministically.
+func sortedGroupNames(groups map[string]*hostGroup) []string {
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// inherit applies the parent's defaults to all unset properties of the group.
+func (g *hostGroup) inherit(parent *hostGroup) {
+	if g.User == "" {
+		g.User = parent.User
+	}
+
+	if g.Port == 0 {
+		g.Port = parent.Port
+	}
+
+	if g.PrivateKey == "" {
+		g.PrivateKey = parent.PrivateKey
+	}
+
+	if g.Jump == nil {
+		g.Jump = parent.Jump
+	}
+
+	g.Tags = mergeTags(parent.Tags, g.Tags)
+}
+
+// apply applies the group's defaults to all unset properties of the host.
+func (g *hostGroup) apply(h *Host) {
+	if h.User == "" {
+		h.User = g.User
+	}
+
+	if h.Port == 0 {
+		h.Port = g.Port
+	}
+
+	if h.PrivateKey == "" {
+		h.PrivateKey = g.PrivateKey
+	}
+
+	if h.Jump == nil {
+		h.Jump = g.Jump
+	}
+
+	h.Tags = mergeTags(g.Tags, h.Tags)
+}
+
+// addHost adds the host to hosts. If a host with the same name is already
+// present, the group memberships and tags are merged into the existing host
+// and unset properties of the existing host are taken from h.
+func addHost(hosts hostConfig, name string, h *Host) {
+	existing, ok := hosts[name]
+	if !ok {
+		hosts[name] = h
+		return
+	}
+
+	(&hostGroup{
+		User:       h.User,
+		Port:       h.Port,
+		PrivateKey: h.PrivateKey,
+		Jump:       h.Jump,
+	}).apply(existing)
+
+	for _, group := range h.Groups {
+		if !existing.InGroup(group) {
+			existing.Groups = append(existing.Groups, group)
+		}
+	}
+	existing.Tags = mergeTags(h.Tags, existing.Tags)
+}
+
+// mergeTags returns a new map containing all tags from defaults and tags.
+// Values from tags take precedence.
+func mergeTags(defaults, tags map[string]string) map[string]string {
+	if len(defaults) == 0 {
+		return tags
+	}
+
+	merged := make(map[string]string, len(defaults)+len(tags))
+	for key, value := range defaults {
+		merged[key] = value
+	}
+
+	for key, value := range tags {
+		merged[key] = value
+	}
+
+	return merged
+}
+
+// InGroup returns true if the host is a member of the group.
+func (h *Host) InGroup(group string) bool {
+	for _, g := range h.Groups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
+
+// selectGroups returns a new hostConfig that only contains hosts that are a
+// member of at least one of the groups.
+func selectGroups(hosts hostConfig, groups []string) hostConfig {
+	if len(groups) == 0 {
+		return hosts
+	}
+
+	selected := make(hostConfig)
+	for name, host := range hosts {
+		for _, group := range groups {
+			if host.InGroup(group) {
+				selected[name] = host
+				break
+			}
+		}
+	}
+	return selected
+}
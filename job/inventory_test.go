@@ -0,0 +1,189 @@
+package job
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+const testInventory = `{
+	"groups": {
+		"eu": {
+			"user": "admin",
+			"port": 22,
+			"privateKey": "eu.key",
+			"tags": {"region": "eu", "env": "prod"},
+			"jump": {"addr": "bastion.eu.example.com", "port": 22, "user": "jump"},
+			"children": {
+				"eu-web": {
+					"port": 2222,
+					"tags": {"role": "web"},
+					"hosts": {
+						"web-1": {"addr": "web-1.eu.example.com"},
+						"web-2": {"addr": "web-2.eu.example.com", "user": "deploy", "tags": {"env": "staging"}}
+					}
+				},
+				"eu-db": {
+					"tags": {"role": "db"},
+					"hosts": {
+						"db-1": {"addr": "db-1.eu.example.com", "privateKey": "db.key"}
+					}
+				}
+			}
+		},
+		"monitoring": {
+			"hosts": {
+				"web-1": {"addr": "web-1.eu.example.com"}
+			}
+		}
+	},
+	"hosts": {
+		"standalone": {"addr": "standalone.example.com", "port": 22, "user": "root"}
+	}
+}`
+
+func TestParseInventory(t *testing.T) {
+	hosts, err := parseHostsFile(bytes.NewBufferString(testInventory))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect(t, 4, len(hosts))
+
+	web1 := hosts["web-1"]
+	expect(t, "admin", web1.User)
+	expect(t, uint(2222), web1.Port)
+	expect(t, "eu.key", web1.PrivateKey)
+	expect(t, "bastion.eu.example.com", web1.Jump.Addr)
+	expect(t, "web", web1.Tags["role"])
+	expect(t, "prod", web1.Tags["env"])
+	expect(t, true, web1.InGroup("eu"))
+	expect(t, true, web1.InGroup("eu-web"))
+	expect(t, true, web1.InGroup("monitoring"))
+
+	web2 := hosts["web-2"]
+	expect(t, "deploy", web2.User)
+	expect(t, "staging", web2.Tags["env"])
+	expect(t, false, web2.InGroup("monitoring"))
+
+	db1 := hosts["db-1"]
+	expect(t, uint(22), db1.Port)
+	expect(t, "db.key", db1.PrivateKey)
+	expect(t, "db", db1.Tags["role"])
+
+	standalone := hosts["standalone"]
+	expect(t, 0, len(standalone.Groups))
+	expect(t, (*Host)(nil), standalone.Jump)
+}
+
+func TestParseInventoryDefaultPort(t *testing.T) {
+	hosts, err := parseHostsFile(bytes.NewBufferString(`{
+	"groups": {
+		"dc": {
+			"jump": {"addr": "bastion.example.com"},
+			"hosts": {
+				"app-1": {"addr": "app-1.example.com"},
+				"app-2": {"addr": "app-2.example.com", "port": 2222, "jump": {"addr": "other.example.com", "port": 2200}},
+				"app-3": {"addr": "app-3.example.com", "jump": {"addr": "inner.example.com", "port": 2200, "jump": {"addr": "outer.example.com"}}}
+			}
+		}
+	},
+	"hosts": {
+		"standalone": {"addr": "standalone.example.com"}
+	}
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app1 := hosts["app-1"]
+	expect(t, uint(defaultPort), app1.Port)
+	expect(t, uint(defaultPort), app1.Jump.Port)
+
+	app2 := hosts["app-2"]
+	expect(t, uint(2222), app2.Port)
+	expect(t, uint(2200), app2.Jump.Port)
+
+	app3 := hosts["app-3"]
+	expect(t, uint(2200), app3.Jump.Port)
+	expect(t, uint(defaultPort), app3.Jump.Jump.Port)
+
+	expect(t, uint(defaultPort), hosts["standalone"].Port)
+}
+
+func TestParseFlatHostsFile(t *testing.T) {
+	tests := []struct {
+		input string
+		want  int
+	}{
+		{`{
+		"groups": {"addr": "groups.example.com", "port": 22},
+		"other": {"addr": "other.example.com", "port": 22}
+	}`, 2},
+		// looks like an inventory by its properties only
+		{`{
+		"groups": {"addr": "groups.example.com", "port": 22},
+		"hosts": {"addr": "hosts.example.com", "port": 22}
+	}`, 2},
+		{`{
+		"groups": {"addr": "groups.example.com", "port": 22}
+	}`, 1},
+	}
+
+	for _, test := range tests {
+		hosts, err := parseHostsFile(bytes.NewBufferString(test.input))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expect(t, test.want, len(hosts))
+		expect(t, "groups.example.com", hosts["groups"].Addr)
+	}
+}
+
+func TestSelectGroups(t *testing.T) {
+	hosts, err := parseHostsFile(bytes.NewBufferString(testInventory))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		groups []string
+		want   []string
+	}{
+		{
+			name: "no groups",
+			want: []string{"db-1", "standalone", "web-1", "web-2"},
+		},
+		{
+			name:   "parent group",
+			groups: []string{"eu"},
+			want:   []string{"db-1", "web-1", "web-2"},
+		},
+		{
+			name:   "child group",
+			groups: []string{"eu-web"},
+			want:   []string{"web-1", "web-2"},
+		},
+		{
+			name:   "multiple groups",
+			groups: []string{"eu-db", "monitoring"},
+			want:   []string{"db-1", "web-1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for name := range selectGroups(hosts, tt.groups) {
+				got = append(got, name)
+			}
+			sort.Strings(got)
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("selectGroups() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,213 @@
+// Copyright (c) 2016 Niklas Wolber
+// This file is licensed under the MIT license.
+// See the LICENSE file for more information.
+
+package job
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"regexp"
+	"sync"
+
+	errs "github.com/pkg/errors"
+)
+
+// redactPatterns are regular expressions matching sensitive values, that
+// are redacted from all job output.
+type redactPatterns []*regexp.Regexp
+
+func (p redactPatterns) MarshalJSON() ([]byte, error) {
+	patterns := make([]string, len(p))
+	for i, pattern := range p {
+		patterns[i] = pattern.String()
+	}
+	return json.Marshal(patterns)
+}
+
+func (p *redactPatterns) UnmarshalJSON(b []byte) error {
+	var patterns []string
+	if err := json.Unmarshal(b, &patterns); err != nil {
+		return errs.Wrap(err, "failed to unmarshal redact patterns")
+	}
+
+	compiled := make(redactPatterns, len(patterns))
+	for i, pattern := range patterns {
+		var err error
+		if compiled[i], err = regexp.Compile(pattern); err != nil {
+			return errs.Wrapf(err, "invalid redact pattern %q", pattern)
+		}
+	}
+
+	*p = compiled
+	return nil
+}
+
+// A Redactor replaces known secret values and values matching the redact
+// patterns of a job with a placeholder. Known secret values are the values
+// of the secrets file and all secrets resolved through the Redactor. A
+// Redactor lives as long as a single run, so resolved values are forgotten
+// once the run ends. A nil Redactor only replaces the values of the secrets
+// file.
+type Redactor struct {
+	patterns redactPatterns
+
+	m        sync.Mutex
+	resolved map[string]bool
+}
+
+// Redactor returns a Redactor for a run of the job.
+func (c *Config) Redactor() *Redactor {
+	return &Redactor{patterns: c.Redact}
+}
+
+// Redact returns s with all sensitive values replaced.
+func (r *Redactor) Redact(s string) string {
+	return string(r.redactPatterns(redact([]byte(s), r.secretValues())))
+}
+
+// remember adds the value to the known secret values, so it is redacted
+// from the output of the run.
+func (r *Redactor) remember(value string) {
+	if r == nil || len(value) < minRedactLength {
+		return
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+	if r.resolved == nil {
+		r.resolved = make(map[string]bool)
+	}
+	r.resolved[value] = true
+}
+
+// resolve resolves the secret and remembers its value.
+func (r *Redactor) resolve(s *Secret) (string, error) {
+	value, err := s.Resolve()
+	if err != nil {
+		return "", err
+	}
+
+	r.remember(value)
+	return value, nil
+}
+
+// secretValues returns the known secret values, longest first.
+func (r *Redactor) secretValues() [][]byte {
+	if r == nil {
+		return knownSecretValues(nil)
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+	return knownSecretValues(r.resolved)
+}
+
+func (r *Redactor) redactPatterns(b []byte) []byte {
+	if r == nil {
+		return b
+	}
+
+	for _, pattern := range r.patterns {
+		b = pattern.ReplaceAllLiteral(b, []byte(redacted))
+	}
+	return b
+}
+
+// Writer returns a RedactWriter, that writes to w.
+func (r *Redactor) Writer(w io.Writer) *RedactWriter {
+	return &RedactWriter{r: r, w: w}
+}
+
+// A RedactWriter redacts sensitive values before passing the data on to the
+// underlying writer. Data that might be the beginning of a secret spanning
+// multiple writes is held back until it is either completed or ruled out,
+// or the writer is flushed. Redact patterns are applied line by line, so an
+// incomplete last line is held back as well, if there are patterns.
+type RedactWriter struct {
+	m   sync.Mutex
+	r   *Redactor
+	w   io.Writer
+	buf []byte
+}
+
+func (w *RedactWriter) Write(p []byte) (int, error) {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	secrets := w.r.secretValues()
+	w.buf = append(w.buf, p...)
+	w.buf = redact(w.buf, secrets)
+
+	end := len(w.buf) - partialSecret(w.buf, secrets)
+	if w.r != nil && len(w.r.patterns) > 0 {
+		end = bytes.LastIndexByte(w.buf[:end], '\n') + 1
+	}
+
+	if end > 0 {
+		if _, err := w.w.Write(w.r.redactPatterns(w.buf[:end])); err != nil {
+			return 0, err
+		}
+	}
+
+	w.buf = append(w.buf[:0], w.buf[end:]...)
+	return len(p), nil
+}
+
+// Flush writes data that has been held back.
+func (w *RedactWriter) Flush() error {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	if len(w.buf) == 0 {
+		return nil
+	}
+
+	_, err := w.w.Write(w.r.redactPatterns(w.buf))
+	w.buf = w.buf[:0]
+	return err
+}
+
+// Close flushes the writer and closes the underlying writer, if it is an
+// io.Closer.
+func (w *RedactWriter) Close() error {
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if c, ok := w.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// redact replaces all occurrences of the secrets in b.
+func redact(b []byte, secrets [][]byte) []byte {
+	for _, secret := range secrets {
+		if bytes.Contains(b, secret) {
+			b = bytes.Replace(b, secret, []byte(redacted), -1)
+		}
+	}
+	return b
+}
+
+// partialSecret returns the length of the longest suffix of b that is the
+// beginning of one of the secrets.
+func partialSecret(b []byte, secrets [][]byte) int {
+	longest := 0
+	for _, secret := range secrets {
+		n := len(secret) - 1
+		if n > len(b) {
+			n = len(b)
+		}
+
+		for ; n > longest; n-- {
+			if bytes.HasSuffix(b, secret[:n]) {
+				longest = n
+				break
+			}
+		}
+	}
+	return longest
+}
@@ -0,0 +1,326 @@
+// Copyright (c) 2016 Niklas Wolber
+// This file is licensed under the MIT license.
+// See the LICENSE file for more information.
+
+package job
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"io/ioutil"
+	"log"
+	"os"
+	"time"
+
+	sched "github.com/nwolber/cron"
+	errs "github.com/pkg/errors"
+)
+
+// Business day modifiers decide what happens to occurrences of a schedule,
+// that are not on a business day, i.e. on weekends and holidays.
+const (
+	// BusinessDaysOnly skips those occurrences.
+	BusinessDaysOnly = "only"
+	// BusinessDaysNext moves them to the next business day.
+	BusinessDaysNext = "next"
+	// BusinessDaysPrevious moves them to the previous business day.
+	BusinessDaysPrevious = "previous"
+)
+
+const (
+	dateLayout = "2006-01-02"
+	// maxScheduleSteps limits the occurrences that are examined to find the
+	// next one, that is neither blacked out nor skipped.
+	maxScheduleSteps = 100000
+)
+
+// A Window is a period of time. Times are given in the time zone of the job
+// in one of the forms 2006-01-02, 2006-01-02T15:04 or 2006-01-02T15:04:05.
+// From is inclusive. To is exclusive, unless it is a date, in which case the
+// whole day is part of the window.
+type Window struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// A Calendar contains holidays and blackout windows, during which jobs don't
+// run.
+type Calendar struct {
+	// Holidays in the form 2006-01-02.
+	Holidays  []string  `json:"holidays,omitempty"`
+	Blackouts []*Window `json:"blackouts,omitempty"`
+}
+
+func readCalendar(file string) (*Calendar, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, errs.Wrap(err, "failed to open calendar")
+	}
+	defer f.Close()
+
+	r := removeLineComments(f, cLineComments)
+	defer r.Close()
+
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errs.Wrap(err, "failed to read calendar")
+	}
+
+	var c Calendar
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, errs.Wrapf(err, "failed to decode calendar %s", file)
+	}
+	return &c, nil
+}
+
+type blackout struct {
+	from, to time.Time
+	reason   string
+}
+
+func parseWindowTime(s string, loc *time.Location, end bool) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02T15:04"} {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
+		}
+	}
+
+	t, err := time.ParseInLocation(dateLayout, s, loc)
+	if err != nil {
+		return time.Time{}, errs.Errorf("invalid time %q", s)
+	}
+
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+func (w *Window) parse(loc *time.Location) (*blackout, error) {
+	from, err := parseWindowTime(w.From, loc, false)
+	if err != nil {
+		return nil, errs.Wrap(err, "invalid blackout start")
+	}
+
+	to, err := parseWindowTime(w.To, loc, true)
+	if err != nil {
+		return nil, errs.Wrap(err, "invalid blackout end")
+	}
+
+	if !to.After(from) {
+		return nil, errs.Errorf("blackout from %s to %s is empty", w.From, w.To)
+	}
+	return &blackout{from: from, to: to, reason: w.Reason}, nil
+}
+
+// A Schedule computes when a job runs. It applies the time zone, blackout
+// windows, holidays and business day modifier of the job to its cron
+// schedule.
+type Schedule struct {
+	cron         sched.Schedule
+	location     *time.Location
+	holidays     map[string]bool
+	blackouts    []*blackout
+	businessDays string
+}
+
+// ParseSchedule returns the Schedule of the job. It reads the calendar file,
+// if there is one.
+func (c *Config) ParseSchedule() (*Schedule, error) {
+	cron, err := sched.Parse(c.Schedule)
+	if err != nil {
+		return nil, errs.Wrapf(err, "failed to parse schedule %q", c.Schedule)
+	}
+
+	s := &Schedule{
+		cron:         cron,
+		location:     time.Local,
+		holidays:     make(map[string]bool),
+		businessDays: c.BusinessDays,
+	}
+
+	switch c.BusinessDays {
+	case "", BusinessDaysOnly, BusinessDaysNext, BusinessDaysPrevious:
+	default:
+		return nil, errs.Errorf("unknown business day modifier %q", c.BusinessDays)
+	}
+
+	if c.Timezone != "" {
+		if s.location, err = time.LoadLocation(c.Timezone); err != nil {
+			return nil, errs.Wrapf(err, "unknown time zone %q", c.Timezone)
+		}
+	}
+
+	calendar := &Calendar{Blackouts: c.Blackouts}
+	if c.Calendar != "" {
+		file, err := readCalendar(c.Calendar)
+		if err != nil {
+			return nil, err
+		}
+		calendar.Holidays = append(calendar.Holidays, file.Holidays...)
+		calendar.Blackouts = append(calendar.Blackouts, file.Blackouts...)
+	}
+
+	for _, holiday := range calendar.Holidays {
+		if _, err := time.Parse(dateLayout, holiday); err != nil {
+			return nil, errs.Errorf("invalid holiday %q", holiday)
+		}
+		s.holidays[holiday] = true
+	}
+
+	for _, w := range calendar.Blackouts {
+		b, err := w.parse(s.location)
+		if err != nil {
+			return nil, err
+		}
+		s.blackouts = append(s.blackouts, b)
+	}
+
+	return s, nil
+}
+
+// Location returns the time zone of the Schedule.
+func (s *Schedule) Location() *time.Location {
+	return s.location
+}
+
+// Next returns the next time the job runs after t. It returns the zero time,
+// if there is none.
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.In(s.location)
+	after := t
+
+	every, constantDelay := s.cron.(sched.ConstantDelaySchedule)
+
+	// skipTo returns the time to continue with, so that the next occurrence
+	// is the first one at or after end.
+	skipTo := func(end time.Time) time.Time {
+		if !end.After(after) {
+			return after
+		}
+		if !constantDelay {
+			return end.Add(-time.Second)
+		}
+
+		// occurrences of schedules with a constant delay depend on the
+		// previous occurrence, so skip all occurrences before end at once
+		steps := (end.Sub(after) + every.Delay - 1) / every.Delay
+		return after.Add((steps - 1) * every.Delay)
+	}
+
+	for i := 0; i < maxScheduleSteps; i++ {
+		next := s.cron.Next(after)
+		if next.IsZero() {
+			return next
+		}
+		after = next
+
+		if !s.businessDay(next) {
+			switch s.businessDays {
+			case BusinessDaysOnly:
+				// continue with the next day
+				after = skipTo(startOfDay(next).AddDate(0, 0, 1))
+				continue
+			case BusinessDaysNext:
+				next = s.shift(next, 1)
+			case BusinessDaysPrevious:
+				next = s.shift(next, -1)
+			}
+		}
+
+		if b := s.blackout(next); b != nil {
+			// continue with the end of the blackout
+			after = skipTo(b.to)
+			continue
+		}
+
+		if next.After(t) {
+			return next
+		}
+	}
+
+	log.Println("no occurrence found after", t, "within", maxScheduleSteps, "steps")
+	return time.Time{}
+}
+
+// NextN returns the next n times the job runs after t.
+func (s *Schedule) NextN(t time.Time, n int) []time.Time {
+	var times []time.Time
+	for i := 0; i < n; i++ {
+		t = s.Next(t)
+		if t.IsZero() {
+			break
+		}
+		times = append(times, t)
+	}
+	return times
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+func (s *Schedule) businessDay(t time.Time) bool {
+	switch t.Weekday() {
+	case time.Saturday, time.Sunday:
+		return false
+	}
+	return !s.holidays[t.Format(dateLayout)]
+}
+
+// shift moves t by days until it is on a business day.
+func (s *Schedule) shift(t time.Time, days int) time.Time {
+	for i := 0; i < 366 && !s.businessDay(t); i++ {
+		t = t.AddDate(0, 0, days)
+	}
+	return t
+}
+
+func (s *Schedule) blackout(t time.Time) *blackout {
+	for _, b := range s.blackouts {
+		if !t.Before(b.from) && t.Before(b.to) {
+			return b
+		}
+	}
+	return nil
+}
+
+// Delay returns how long a scheduled run of the job waits before it starts.
+// It is the splay of the job, a fixed offset derived from the job's name,
+// plus a random jitter. Random returns a random number in [0,n).
+func (c *Config) Delay(random func(n int64) int64) (time.Duration, error) {
+	var delay time.Duration
+
+	if c.Splay != "" {
+		splay, err := time.ParseDuration(c.Splay)
+		if err != nil {
+			return 0, errs.Wrapf(err, "failed to parse splay %s", c.Splay)
+		}
+		if splay < 0 {
+			return 0, errs.Errorf("negative splay %s", c.Splay)
+		}
+
+		if splay > 0 {
+			h := fnv.New64a()
+			h.Write([]byte(c.Name))
+			delay += time.Duration(h.Sum64() % uint64(splay))
+		}
+	}
+
+	if c.Jitter != "" {
+		jitter, err := time.ParseDuration(c.Jitter)
+		if err != nil {
+			return 0, errs.Wrapf(err, "failed to parse jitter %s", c.Jitter)
+		}
+		if jitter < 0 {
+			return 0, errs.Errorf("negative jitter %s", c.Jitter)
+		}
+
+		if jitter > 0 {
+			delay += time.Duration(random(int64(jitter)))
+		}
+	}
+
+	return delay, nil
+}
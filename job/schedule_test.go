@@ -0,0 +1,167 @@
+// Copyright (c) 2016 Niklas Wolber
+// This file is licensed under the MIT license.
+// See the LICENSE file for more information.
+
+package job
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"freeze.cal": `{
+			// no changes over christmas
+			"holidays": ["2016-12-26"],
+			"blackouts": [{"from": "2016-12-21", "to": "2016-12-22", "reason": "change freeze"}]
+		}`,
+	})
+	defer os.RemoveAll(dir)
+
+	// Friday, December 16th, 2016
+	start := time.Date(2016, 12, 16, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		c    *Config
+		want []string
+	}{
+		{
+			name: "time zone",
+			c:    &Config{Schedule: "0 0 9 * * *", Timezone: "America/New_York"},
+			want: []string{"2016-12-16 09:00 EST", "2016-12-17 09:00 EST"},
+		},
+		{
+			name: "business days only",
+			c:    &Config{Schedule: "0 0 9 * * *", Timezone: "UTC", BusinessDays: BusinessDaysOnly},
+			want: []string{"2016-12-19 09:00 UTC", "2016-12-20 09:00 UTC", "2016-12-21 09:00 UTC"},
+		},
+		{
+			name: "next business day",
+			c:    &Config{Schedule: "0 0 9 * * SAT", Timezone: "UTC", BusinessDays: BusinessDaysNext},
+			want: []string{"2016-12-19 09:00 UTC", "2016-12-26 09:00 UTC"},
+		},
+		{
+			name: "previous business day",
+			c:    &Config{Schedule: "0 0 9 * * SUN", Timezone: "UTC", BusinessDays: BusinessDaysPrevious},
+			want: []string{"2016-12-23 09:00 UTC", "2016-12-30 09:00 UTC"},
+		},
+		{
+			name: "calendar",
+			c: &Config{
+				Schedule:     "0 0 9 * * *",
+				Timezone:     "UTC",
+				Calendar:     filepath.Join(dir, "freeze.cal"),
+				BusinessDays: BusinessDaysOnly,
+			},
+			want: []string{"2016-12-19 09:00 UTC", "2016-12-20 09:00 UTC", "2016-12-23 09:00 UTC", "2016-12-27 09:00 UTC"},
+		},
+		{
+			name: "inline blackout",
+			c: &Config{
+				Schedule:  "@every 1h",
+				Timezone:  "UTC",
+				Blackouts: []*Window{{From: "2016-12-16T13:30", To: "2016-12-16T16:00"}},
+			},
+			want: []string{"2016-12-16 13:00 UTC", "2016-12-16 16:00 UTC", "2016-12-16 17:00 UTC"},
+		},
+		{
+			name: "constant delay over long blackout",
+			c: &Config{
+				Schedule:  "@every 1s",
+				Timezone:  "UTC",
+				Blackouts: []*Window{{From: "2016-12-16", To: "2016-12-19"}},
+			},
+			want: []string{"2016-12-20 00:00 UTC"},
+		},
+		{
+			name: "constant delay business days only",
+			c: &Config{
+				Schedule:     "@every 10m",
+				Timezone:     "UTC",
+				BusinessDays: BusinessDaysOnly,
+				Blackouts:    []*Window{{From: "2016-12-16T12:30", To: "2016-12-16"}},
+			},
+			want: []string{"2016-12-16 12:10 UTC", "2016-12-16 12:20 UTC", "2016-12-19 00:00 UTC"},
+		},
+	}
+
+	for _, test := range tests {
+		s, err := test.c.ParseSchedule()
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+
+		var got []string
+		for _, next := range s.NextN(start, len(test.want)) {
+			got = append(got, next.Format("2006-01-02 15:04 MST"))
+		}
+		expect(t, strings.Join(test.want, ", "), strings.Join(got, ", "))
+	}
+}
+
+func TestParseScheduleErrors(t *testing.T) {
+	tests := []struct {
+		c    *Config
+		want string
+	}{
+		{&Config{Schedule: "every now and then"}, "failed to parse schedule"},
+		{&Config{Schedule: "@daily", Timezone: "Mars/Olympus_Mons"}, "unknown time zone"},
+		{&Config{Schedule: "@daily", BusinessDays: "sometimes"}, "unknown business day modifier"},
+		{&Config{Schedule: "@daily", Blackouts: []*Window{{From: "2016-12-24", To: "tomorrow"}}}, "invalid blackout end"},
+		{&Config{Schedule: "@daily", Blackouts: []*Window{{From: "2016-12-24T10:00", To: "2016-12-24T09:00"}}}, "is empty"},
+		{&Config{Schedule: "@daily", Calendar: "missing.cal"}, "failed to open calendar"},
+	}
+
+	for _, test := range tests {
+		_, err := test.c.ParseSchedule()
+		if err == nil {
+			t.Errorf("%+v: expected an error", test.c)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.want) {
+			t.Errorf("want error containing %q, got %q", test.want, err)
+		}
+	}
+}
+
+func TestDelay(t *testing.T) {
+	random := func(n int64) int64 { return n / 2 }
+
+	tests := []struct {
+		c    *Config
+		want time.Duration
+	}{
+		{&Config{Name: "a"}, 0},
+		{&Config{Name: "a", Jitter: "10s"}, 5 * time.Second},
+		{&Config{Name: "a", Splay: "0s"}, 0},
+		{&Config{Name: "a", Splay: "1m"}, 20555641996},
+		{&Config{Name: "b", Splay: "1m"}, 19090526629},
+		{&Config{Name: "a", Splay: "1m", Jitter: "10s"}, 25555641996},
+	}
+
+	for _, test := range tests {
+		got, err := test.c.Delay(random)
+		if err != nil {
+			t.Errorf("%+v: %s", test.c, err)
+			continue
+		}
+		expect(t, test.want, got)
+	}
+
+	for _, c := range []*Config{
+		{Jitter: "sometimes"},
+		{Jitter: "-1s"},
+		{Splay: "a while"},
+		{Splay: "-1s"},
+	} {
+		if _, err := c.Delay(random); err == nil {
+			t.Errorf("%+v: expected an error", c)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+// Copyright (c) 2016 Niklas Wolber
+// This file is licensed under the MIT license.
+// See the LICENSE file for more information.
+
+package job
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	shellwords "github.com/mattn/go-shellwords"
+	errs "github.com/pkg/errors"
+)
+
+const (
+	redacted = "<redacted>"
+
+	secretExecTimeout = 30 * time.Second
+
+	// minRedactLength is the minimum length of a secret value to be redacted
+	// from job output. Shorter values would garble unrelated output.
+	minRedactLength = 4
+)
+
+// A SecretProvider looks up the secret value identified by name.
+type SecretProvider func(name string) (string, error)
+
+// secretProviders contains all known providers by their prefix in a secret
+// reference.
+var secretProviders = map[string]SecretProvider{
+	"env":     envSecret,
+	"file":    fileSecret,
+	"exec":    execSecret,
+	"secrets": secretsFileSecret,
+}
+
+var (
+	secretsMutex sync.RWMutex
+	// secretsFile contains the decrypted values of the secrets file.
+	secretsFile map[string]string
+)
+
+// UseSecrets makes the decrypted values of a secrets file available to
+// templates as {{.Secrets.name}} and to secret references of the form
+// secrets:name. The values are redacted from all job output.
+func UseSecrets(values map[string]string) {
+	secretsMutex.Lock()
+	defer secretsMutex.Unlock()
+	secretsFile = values
+}
+
+// secrets returns the decrypted values of the secrets file.
+func secrets() map[string]string {
+	secretsMutex.RLock()
+	defer secretsMutex.RUnlock()
+	return secretsFile
+}
+
+// knownSecretValues returns the values of the secrets file and the resolved
+// values, longest first, so that a secret containing another secret is
+// redacted as a whole. Values shorter than minRedactLength are ignored.
+func knownSecretValues(resolved map[string]bool) [][]byte {
+	secretsMutex.RLock()
+	defer secretsMutex.RUnlock()
+
+	known := make([][]byte, 0, len(secretsFile)+len(resolved))
+	for value := range resolved {
+		known = append(known, []byte(value))
+	}
+
+	for _, value := range secretsFile {
+		if len(value) >= minRedactLength && !resolved[value] {
+			known = append(known, []byte(value))
+		}
+	}
+
+	sort.Slice(known, func(i, j int) bool { return len(known[i]) > len(known[j]) })
+	return known
+}
+
+// A Secret is a sensitive value, such as a password. It is either given in
+// clear text or as a reference of the form provider:name, which is resolved
+// only when the value is needed. Secrets are never printed.
+type Secret struct {
+	// Value is the clear text value.
+	Value string
+	// Ref is a reference to a secret provider, e.g. env:DB_PASS.
+	Ref string
+}
+
+// MarshalJSON marshals a secret reference as {"secret": "provider:name"}.
+// Clear text values are redacted.
+func (s Secret) MarshalJSON() ([]byte, error) {
+	if s.Ref != "" {
+		return json.Marshal(map[string]string{"secret": s.Ref})
+	}
+
+	if s.Value == "" {
+		return json.Marshal("")
+	}
+
+	return json.Marshal(redacted)
+}
+
+// UnmarshalJSON unmarshals a Secret either from a JSON string containing the
+// clear text value or from a JSON object containing a secret reference.
+func (s *Secret) UnmarshalJSON(b []byte) error {
+	if err := json.Unmarshal(b, &s.Value); err == nil {
+		return nil
+	}
+
+	var obj struct {
+		Secret string `json:"secret"`
+	}
+	if err := json.Unmarshal(b, &obj); err != nil {
+		return errs.Wrap(err, "failed to unmarshal secret")
+	}
+
+	if _, _, err := parseSecretRef(obj.Secret); err != nil {
+		return err
+	}
+
+	s.Value, s.Ref = "", obj.Secret
+	return nil
+}
+
+func (s Secret) String() string {
+	if s.Ref != "" {
+		return "secret(" + s.Ref + ")"
+	}
+	return redacted
+}
+
+// GoString prevents the clear text value from being printed with %#v.
+func (s Secret) GoString() string {
+	return s.String()
+}
+
+// IsRef returns true if the Secret is a reference to a secret provider.
+func (s *Secret) IsRef() bool {
+	return s != nil && s.Ref != ""
+}
+
+// Resolve returns the secret value. References are looked up with the
+// respective provider. A nil Secret resolves to an empty string.
+func (s *Secret) Resolve() (string, error) {
+	if s == nil {
+		return "", nil
+	}
+
+	if s.Ref == "" {
+		return s.Value, nil
+	}
+
+	provider, name, err := parseSecretRef(s.Ref)
+	if err != nil {
+		return "", err
+	}
+
+	value, err := provider(name)
+	if err != nil {
+		return "", errs.Wrapf(err, "failed to resolve secret %s", s.Ref)
+	}
+
+	return value, nil
+}
+
+// resolveSecrets resolves all secrets in the map and remembers their values
+// with the Redactor.
+func resolveSecrets(r *Redactor, secrets map[string]Secret) (map[string]string, error) {
+	if secrets == nil {
+		return nil, nil
+	}
+
+	values := make(map[string]string, len(secrets))
+	for key, secret := range secrets {
+		value, err := r.resolve(&secret)
+		if err != nil {
+			return nil, err
+		}
+		values[key] = value
+	}
+	return values, nil
+}
+
+func parseSecretRef(ref string) (SecretProvider, string, error) {
+	i := strings.Index(ref, ":")
+	if i == -1 {
+		return nil, "", errs.Errorf("invalid secret reference %q, expected provider:name", ref)
+	}
+
+	provider, ok := secretProviders[ref[:i]]
+	if !ok {
+		return nil, "", errs.Errorf("unknown secret provider %q", ref[:i])
+	}
+
+	return provider, ref[i+1:], nil
+}
+
+func envSecret(name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", errs.Errorf("environment variable %s is not set", name)
+	}
+	return value, nil
+}
+
+func fileSecret(name string) (string, error) {
+	b, err := ioutil.ReadFile(expandHome(name))
+	if err != nil {
+		return "", errs.WithStack(err)
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+func secretsFileSecret(name string) (string, error) {
+	value, ok := secrets()[name]
+	if !ok {
+		return "", errs.Errorf("secret %s not found in secrets file", name)
+	}
+	return value, nil
+}
+
+func execSecret(name string) (string, error) {
+	parts, err := shellwords.Parse(name)
+	if err != nil {
+		return "", errs.Wrap(err, "error parsing secret command line")
+	}
+
+	if len(parts) == 0 {
+		return "", errs.New("secret command is empty")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), secretExecTimeout)
+	defer cancel()
+
+	var stdout bytes.Buffer
+	cmd := exec.CommandContext(ctx, parts[0], parts[1:]...)
+	cmd.Stdout = &stdout
+
+	if err := cmd.Run(); err != nil {
+		return "", errs.Wrap(err, "secret command failed")
+	}
+
+	return strings.TrimRight(stdout.String(), "\r\n"), nil
+}
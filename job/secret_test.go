@@ -0,0 +1,127 @@
+package job
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSecretUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    Secret
+		wantErr bool
+	}{
+		{
+			name:  "clear text",
+			input: `"secret"`,
+			want:  Secret{Value: "secret"},
+		},
+		{
+			name:  "reference",
+			input: `{"secret": "env:DB_PASS"}`,
+			want:  Secret{Ref: "env:DB_PASS"},
+		},
+		{
+			name:    "unknown provider",
+			input:   `{"secret": "vault:DB_PASS"}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid reference",
+			input:   `{"secret": "DB_PASS"}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Secret
+			err := json.Unmarshal([]byte(tt.input), &got)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Secret.UnmarshalJSON() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("Secret.UnmarshalJSON() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSecretResolve(t *testing.T) {
+	os.Setenv("XCUTER_TEST_SECRET", "from env")
+	defer os.Unsetenv("XCUTER_TEST_SECRET")
+
+	f, err := ioutil.TempFile("", "xCUTEr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	fmt.Fprintln(f, "from file")
+	f.Close()
+
+	tests := []struct {
+		name    string
+		secret  *Secret
+		want    string
+		wantErr bool
+	}{
+		{name: "nil", secret: nil, want: ""},
+		{name: "clear text", secret: &Secret{Value: "clear"}, want: "clear"},
+		{name: "env", secret: &Secret{Ref: "env:XCUTER_TEST_SECRET"}, want: "from env"},
+		{name: "unset env", secret: &Secret{Ref: "env:XCUTER_TEST_UNSET"}, wantErr: true},
+		{name: "file", secret: &Secret{Ref: "file:" + f.Name()}, want: "from file"},
+		{name: "exec", secret: &Secret{Ref: "exec:echo from exec"}, want: "from exec"},
+		{name: "failing exec", secret: &Secret{Ref: "exec:false"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.secret.Resolve()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Secret.Resolve() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("Secret.Resolve() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSecretRedaction(t *testing.T) {
+	h := &Host{
+		Name:     "host",
+		Password: &Secret{Value: "clear text password"},
+		KeyboardInteractive: map[string]Secret{
+			"Password: ": {Value: "clear text answer"},
+			"Token: ":    {Ref: "env:TOKEN"},
+		},
+	}
+
+	c := &Config{
+		Name:    "redaction",
+		Host:    h,
+		Command: &Command{Command: "echo {{.Host.Password}}"},
+		SCP:     &ScpData{Key: &Secret{Value: "id_rsa"}},
+	}
+
+	outputs := map[string]string{
+		"JSON":     c.JSON(),
+		"String":   c.String(),
+		"GoString": fmt.Sprintf("%#v %#v", h.KeyboardInteractive, *h.Password),
+	}
+
+	for name, output := range outputs {
+		if strings.Contains(output, "clear text") {
+			t.Errorf("%s contains clear text secret: %s", name, output)
+		}
+	}
+
+	if !strings.Contains(outputs["JSON"], `"secret": "env:TOKEN"`) {
+		t.Errorf("JSON lacks secret reference: %s", outputs["JSON"])
+	}
+}
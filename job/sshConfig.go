@@ -0,0 +1,396 @@
+// Copyright (c) 2016 Niklas Wolber
+// This file is licensed under the MIT license.
+// See the LICENSE file for more information.
+
+package job
+
+import (
+	"bufio"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	shellwords "github.com/mattn/go-shellwords"
+	errs "github.com/pkg/errors"
+)
+
+const (
+	// maxIncludeDepth limits nested Include directives, like OpenSSH does.
+	maxIncludeDepth = 16
+	// maxJumpDepth limits nested ProxyJump directives.
+	maxJumpDepth = 16
+	// systemSSHDir contains the system wide OpenSSH client config.
+	systemSSHDir = "/etc/ssh"
+)
+
+type sshOption struct {
+	key  string
+	args []string
+}
+
+// sshConfigBlock is a Host block of an OpenSSH client config. Options that
+// appear before the first Host block belong to a block matching all hosts.
+type sshConfigBlock struct {
+	patterns []string
+	// match is true for Match blocks, which are not supported and never apply.
+	match   bool
+	options []sshOption
+}
+
+// matches reports whether the block applies to the host alias.
+func (b *sshConfigBlock) matches(alias string) bool {
+	if b.match {
+		return false
+	}
+
+	matched := false
+	for _, pattern := range b.patterns {
+		negated := strings.HasPrefix(pattern, "!")
+		pattern = strings.TrimPrefix(pattern, "!")
+
+		if ok, _ := path.Match(pattern, alias); ok {
+			if negated {
+				return false
+			}
+			matched = true
+		}
+	}
+	return matched
+}
+
+type sshConfig struct {
+	blocks []*sshConfigBlock
+	// files that have been read, including the included ones
+	files []string
+	// directory relative Include paths are resolved against
+	includeDir string
+}
+
+// readSSHConfig reads an OpenSSH client config including all files referenced
+// by Include directives.
+func readSSHConfig(file string) (*sshConfig, error) {
+	file = expandHome(file)
+	c := &sshConfig{
+		blocks:     []*sshConfigBlock{{patterns: []string{"*"}}},
+		includeDir: includeDir(file),
+	}
+
+	if err := c.read(file, 0); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *sshConfig) read(file string, depth int) error {
+	if depth > maxIncludeDepth {
+		return errs.Errorf("too many nested includes in %s", file)
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return errs.Wrapf(err, "failed to open ssh config %s", file)
+	}
+	defer f.Close()
+	c.files = append(c.files, file)
+
+	s := bufio.NewScanner(f)
+	for lineNo := 1; s.Scan(); lineNo++ {
+		key, args, err := parseSSHConfigLine(s.Text())
+		if err != nil {
+			return errs.Wrapf(err, "%s:%d", file, lineNo)
+		}
+
+		switch key {
+		case "":
+		case "host":
+			c.blocks = append(c.blocks, &sshConfigBlock{patterns: args})
+		case "match":
+			c.blocks = append(c.blocks, &sshConfigBlock{match: true})
+		case "include":
+			block := c.blocks[len(c.blocks)-1]
+			for _, arg := range args {
+				if err := c.include(arg, depth); err != nil {
+					return errs.Wrapf(err, "%s:%d", file, lineNo)
+				}
+			}
+
+			// like OpenSSH, options after the Include belong to the
+			// block containing it, even if the included files start
+			// new blocks
+			if c.blocks[len(c.blocks)-1] != block {
+				c.blocks = append(c.blocks, &sshConfigBlock{
+					patterns: block.patterns,
+					match:    block.match,
+				})
+			}
+		default:
+			block := c.blocks[len(c.blocks)-1]
+			block.options = append(block.options, sshOption{key: key, args: args})
+		}
+	}
+
+	return errs.Wrapf(s.Err(), "failed to read ssh config %s", file)
+}
+
+// includeDir returns the directory relative Include paths of the config are
+// resolved against. Like OpenSSH, that is /etc/ssh for the system config and
+// ~/.ssh for every other config, no matter where the config is located.
+func includeDir(file string) string {
+	if abs, err := filepath.Abs(file); err == nil && filepath.Dir(abs) == systemSSHDir {
+		return systemSSHDir
+	}
+	return expandHome("~/.ssh")
+}
+
+// include reads all files matching the glob pattern. Relative patterns are
+// resolved against the include directory of the config.
+func (c *sshConfig) include(pattern string, depth int) error {
+	pattern = expandHome(pattern)
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(c.includeDir, pattern)
+	}
+
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		return errs.Wrapf(err, "invalid include pattern %s", pattern)
+	}
+
+	for _, file := range files {
+		if err := c.read(file, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseSSHConfigLine splits a line into the lower-case keyword and its
+// arguments. Keyword and arguments may be separated by whitespace or an
+// equal sign.
+func parseSSHConfigLine(line string) (string, []string, error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", nil, nil
+	}
+
+	end := strings.IndexAny(line, " \t=")
+	if end == -1 {
+		return strings.ToLower(line), nil, nil
+	}
+
+	key := strings.ToLower(line[:end])
+	rest := strings.TrimSpace(line[end:])
+	rest = strings.TrimSpace(strings.TrimPrefix(rest, "="))
+
+	args, err := shellwords.Parse(rest)
+	if err != nil {
+		return "", nil, errs.Wrapf(err, "failed to parse arguments of %s", key)
+	}
+
+	return key, args, nil
+}
+
+// aliases returns all host aliases that are not patterns.
+func (c *sshConfig) aliases() []string {
+	var aliases []string
+	seen := make(map[string]bool)
+	for _, block := range c.blocks {
+		for _, pattern := range block.patterns {
+			if strings.ContainsAny(pattern, "*?!") || seen[pattern] {
+				continue
+			}
+			seen[pattern] = true
+			aliases = append(aliases, pattern)
+		}
+	}
+	return aliases
+}
+
+// cumulativeOptions are options whose values are accumulated from all
+// matching blocks instead of using the first obtained value.
+var cumulativeOptions = map[string]bool{
+	"identityfile": true,
+	"tag":          true,
+}
+
+// options returns the options for the host alias. As with OpenSSH the first
+// obtained value for each option is used.
+func (c *sshConfig) options(alias string) map[string][]string {
+	options := make(map[string][]string)
+	for _, block := range c.blocks {
+		if !block.matches(alias) {
+			continue
+		}
+
+		for _, option := range block.options {
+			if cumulativeOptions[option.key] {
+				options[option.key] = append(options[option.key], option.args...)
+			} else if _, ok := options[option.key]; !ok {
+				options[option.key] = option.args
+			}
+		}
+	}
+	return options
+}
+
+// host turns the options for the alias into a Host.
+func (c *sshConfig) host(alias string, depth int) (*Host, error) {
+	if depth > maxJumpDepth {
+		return nil, errs.Errorf("too many nested jump hosts for %s", alias)
+	}
+
+	options := c.options(alias)
+	first := func(key string) string {
+		if args := options[key]; len(args) > 0 {
+			return args[0]
+		}
+		return ""
+	}
+
+	h := &Host{
+		Name: alias,
+		Addr: alias,
+		Port: 22,
+		User: currentUser(),
+	}
+
+	if hostName := first("hostname"); hostName != "" {
+		h.Addr = strings.Replace(hostName, "%h", alias, -1)
+	}
+
+	if port := first("port"); port != "" {
+		p, err := strconv.ParseUint(port, 10, 16)
+		if err != nil {
+			return nil, errs.Wrapf(err, "invalid port %q for host %s", port, alias)
+		}
+		h.Port = uint(p)
+	}
+
+	if login := first("user"); login != "" {
+		h.User = login
+	}
+
+	if identityFile := first("identityfile"); identityFile != "" && identityFile != "none" {
+		h.PrivateKey = expandHome(identityFile)
+	}
+
+	for _, tag := range options["tag"] {
+		if h.Tags == nil {
+			h.Tags = make(map[string]string)
+		}
+
+		if i := strings.Index(tag, "="); i >= 0 {
+			h.Tags[tag[:i]] = tag[i+1:]
+		} else {
+			h.Tags[tag] = "true"
+		}
+	}
+
+	if proxyJump := first("proxyjump"); proxyJump != "" && proxyJump != "none" {
+		// connections are made through the jumps from left to right
+		for _, jump := range strings.Split(proxyJump, ",") {
+			j, err := c.jumpHost(jump, depth+1)
+			if err != nil {
+				return nil, errs.Wrapf(err, "invalid jump host %q for host %s", jump, alias)
+			}
+			if h.Jump != nil {
+				j.Jump = h.Jump
+			}
+			h.Jump = j
+		}
+	}
+
+	return h, nil
+}
+
+// jumpHost turns a ProxyJump destination of the form [user@]host[:port] into
+// a Host. If host is an alias of the config, its options are used.
+func (c *sshConfig) jumpHost(dest string, depth int) (*Host, error) {
+	var login string
+	if i := strings.LastIndex(dest, "@"); i >= 0 {
+		login, dest = dest[:i], dest[i+1:]
+	}
+
+	var port string
+	if i := strings.LastIndex(dest, ":"); i >= 0 {
+		dest, port = dest[:i], dest[i+1:]
+	}
+
+	h, err := c.host(dest, depth)
+	if err != nil {
+		return nil, err
+	}
+
+	if login != "" {
+		h.User = login
+	}
+
+	if port != "" {
+		p, err := strconv.ParseUint(port, 10, 16)
+		if err != nil {
+			return nil, errs.Wrapf(err, "invalid port %q", port)
+		}
+		h.Port = uint(p)
+	}
+
+	return h, nil
+}
+
+// hosts returns a Host for every alias in the config.
+func (c *sshConfig) hosts() (hostConfig, error) {
+	hosts := make(hostConfig)
+	for _, alias := range c.aliases() {
+		h, err := c.host(alias, 0)
+		if err != nil {
+			return nil, err
+		}
+		hosts[alias] = h
+	}
+	return hosts, nil
+}
+
+// readSSHConfigHosts reads the OpenSSH client config and returns a Host for
+// every host alias.
+func readSSHConfigHosts(file string) (hostConfig, error) {
+	c, err := readSSHConfig(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.hosts()
+}
+
+// sshConfigFiles returns the OpenSSH client config and all files it
+// includes. If the config can't be read, only the config itself is returned.
+func sshConfigFiles(file string) []string {
+	c, err := readSSHConfig(file)
+	if err != nil {
+		return []string{expandHome(file)}
+	}
+	return c.files
+}
+
+func currentUser() string {
+	u, err := user.Current()
+	if err != nil {
+		return os.Getenv("USER")
+	}
+	return u.Username
+}
+
+// expandHome replaces a leading ~ with the home directory of the current user.
+func expandHome(file string) string {
+	if file != "~" && !strings.HasPrefix(file, "~/") {
+		return file
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return file
+	}
+
+	return filepath.Join(home, file[1:])
+}
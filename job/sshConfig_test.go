@@ -0,0 +1,185 @@
+package job
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// useHome sets the home directory to a new temporary directory, that
+// contains an empty .ssh directory. It returns the .ssh directory and a
+// function to restore the home directory.
+func useHome(t *testing.T) (string, func()) {
+	home, err := ioutil.TempDir("", "xCUTEr")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Join(home, ".ssh")
+	if err := os.Mkdir(dir, 0700); err != nil {
+		os.RemoveAll(home)
+		t.Fatal(err)
+	}
+
+	old, ok := os.LookupEnv("HOME")
+	os.Setenv("HOME", home)
+	return dir, func() {
+		if ok {
+			os.Setenv("HOME", old)
+		} else {
+			os.Unsetenv("HOME")
+		}
+		os.RemoveAll(home)
+	}
+}
+
+func TestReadSSHConfigHosts(t *testing.T) {
+	dir, restore := useHome(t)
+	defer restore()
+
+	config := `
+# defaults for all database servers
+Host db-*
+    User postgres
+    IdentityFile /keys/db
+    Tag role=db
+
+Host db-1 db-2
+    HostName %h.example.com
+    Tag env=prod
+
+Host db-3
+    HostName=10.0.0.3
+    Port 2222
+    User admin
+    ProxyJump bastion
+
+Host web
+    HostName web.example.com
+    ProxyJump jump@first.example.com:2200,bastion
+
+Include conf.d/*
+
+Host *
+    User nobody
+`
+	included := `
+Host bastion
+    HostName bastion.example.com
+    User jump
+`
+
+	if err := os.Mkdir(filepath.Join(dir, "conf.d"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "config"), []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "conf.d", "bastion"), []byte(included), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	hosts, err := readSSHConfigHosts(filepath.Join(dir, "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect(t, 5, len(hosts))
+
+	db1 := hosts["db-1"]
+	expect(t, "db-1", db1.Name)
+	expect(t, "db-1.example.com", db1.Addr)
+	expect(t, uint(22), db1.Port)
+	expect(t, "postgres", db1.User)
+	expect(t, "/keys/db", db1.PrivateKey)
+	expect(t, "db", db1.Tags["role"])
+	expect(t, "prod", db1.Tags["env"])
+
+	db3 := hosts["db-3"]
+	expect(t, "10.0.0.3", db3.Addr)
+	expect(t, uint(2222), db3.Port)
+	expect(t, "postgres", db3.User)
+	expect(t, "bastion.example.com", db3.Jump.Addr)
+	expect(t, "jump", db3.Jump.User)
+
+	web := hosts["web"]
+	expect(t, "nobody", web.User)
+	expect(t, "bastion.example.com", web.Jump.Addr)
+	expect(t, "first.example.com", web.Jump.Jump.Addr)
+	expect(t, uint(2200), web.Jump.Jump.Port)
+	expect(t, "jump", web.Jump.Jump.User)
+
+	selected, err := (&hostsFile{Pattern: "db-.*", Tags: map[string]string{"env": "prod"}}).filter(hosts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, 2, len(selected))
+}
+
+func TestParseSSHConfigLine(t *testing.T) {
+	tests := []struct {
+		line     string
+		wantKey  string
+		wantArgs int
+	}{
+		{line: "", wantKey: ""},
+		{line: "  # comment", wantKey: ""},
+		{line: "Host a b c", wantKey: "host", wantArgs: 3},
+		{line: "HostName=example.com", wantKey: "hostname", wantArgs: 1},
+		{line: "IdentityFile = \"/path with/spaces\"", wantKey: "identityfile", wantArgs: 1},
+	}
+	for _, tt := range tests {
+		key, args, err := parseSSHConfigLine(tt.line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expect(t, tt.wantKey, key)
+		expect(t, tt.wantArgs, len(args))
+	}
+}
+
+func TestSSHConfigIncludeInHostBlock(t *testing.T) {
+	dir, restore := useHome(t)
+	defer restore()
+
+	config := `
+Host web
+    HostName web.example.com
+    Include bastion
+    User deploy
+`
+	included := `
+Host bastion
+    HostName bastion.example.com
+`
+
+	// like OpenSSH, relative includes are resolved against ~/.ssh, even if
+	// the config is located somewhere else
+	file := filepath.Join(filepath.Dir(dir), "config")
+	if err := ioutil.WriteFile(file, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "bastion"), []byte(included), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	hosts, err := readSSHConfigHosts(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect(t, 2, len(hosts))
+	expect(t, "deploy", hosts["web"].User)
+	expect(t, "bastion.example.com", hosts["bastion"].Addr)
+	expect(t, currentUser(), hosts["bastion"].User)
+
+	c := &Config{HostsFile: hostsFileOrArray{{SSHConfig: file}}}
+	deps := c.Dependencies()
+	expect(t, 2, len(deps))
+	expect(t, file, deps[0])
+	expect(t, filepath.Join(dir, "bastion"), deps[1])
+}
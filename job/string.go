@@ -7,6 +7,7 @@ package job
 import (
 	"fmt"
 	"log"
+	"strings"
 	"time"
 )
 
@@ -165,15 +166,39 @@ func (s *StringBuilder) Retry(child interface{}, retries uint) interface{} {
 	}
 }
 
-func (s *StringBuilder) Templating(c *Config, h *Host) interface{} {
+func (s *StringBuilder) When(expr string, child interface{}) interface{} {
+	str, ok := child.(Stringer)
+	if !ok {
+		log.Panicf("not a Stringer %T", child)
+	}
+
+	// strip the actions, so the expression itself is printed
+	expr = strings.NewReplacer("{{", "", "}}", "").Replace(expr)
+	return &SimpleBranch{
+		Root: Leaf("When " + strings.TrimSpace(expr)),
+		Leafs: []Stringer{
+			str,
+		},
+	}
+}
+
+func (s *StringBuilder) Templating(c *Config, h *Host, hosts []*Host) interface{} {
 	if s.Full {
 		return Leaf("Create templating engine")
 	}
 	return nil
 }
 
-func (*StringBuilder) SSHClient(host, user, keyFile, password string, keyboardInteractive map[string]string) interface{} {
-	return Leaf(fmt.Sprintf("Open SSH connection to %s@%s", user, host))
+func (*StringBuilder) SSHClient(h *Host) interface{} {
+	str := fmt.Sprintf("Open SSH connection to %s@%s:%d", h.User, h.Addr, h.Port)
+	for jump := h.Jump; jump != nil; jump = jump.Jump {
+		str += fmt.Sprintf(" via %s@%s:%d", jump.User, jump.Addr, jump.Port)
+	}
+	return Leaf(str)
+}
+
+func (*StringBuilder) Facts(h *Host) interface{} {
+	return Leaf("Gather facts")
 }
 
 func (*StringBuilder) Forwarding(f *Forwarding) interface{} {
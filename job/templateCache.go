@@ -0,0 +1,213 @@
+// Copyright (c) 2016 Niklas Wolber
+// This file is licensed under the MIT license.
+// See the LICENSE file for more information.
+
+package job
+
+import (
+	"sync"
+	"text/template"
+	"text/template/parse"
+
+	errs "github.com/pkg/errors"
+)
+
+// maxCachedTemplates limits the size of the template cache. If it is exceeded,
+// the cache is cleared.
+const maxCachedTemplates = 4096
+
+// A compiledTemplate is a parsed template, that can be executed by any
+// TemplatingEngine.
+type compiledTemplate struct {
+	t *template.Template
+	// engineBound is true, if the template calls functions that depend on
+	// the TemplatingEngine. Those are bound before every execution.
+	engineBound bool
+}
+
+var (
+	templateCacheMutex sync.RWMutex
+	templateCache      = make(map[string]*compiledTemplate)
+
+	// allFuncs contains all template functions, the ones depending on a
+	// TemplatingEngine are only used for parsing.
+	allFuncs = func() template.FuncMap {
+		funcs := (&TemplatingEngine{}).engineFuncs()
+		for name, f := range templateFuncs {
+			funcs[name] = f
+		}
+		return funcs
+	}()
+)
+
+// compileTemplate returns the parsed template for the text. Templates are
+// parsed only once and then served from a cache.
+func compileTemplate(text string) (*compiledTemplate, error) {
+	templateCacheMutex.RLock()
+	c, ok := templateCache[text]
+	templateCacheMutex.RUnlock()
+	if ok {
+		return c, nil
+	}
+
+	t, err := template.New("").Funcs(allFuncs).Parse(text)
+	if err != nil {
+		return nil, errs.Wrap(err, "failed to parse template")
+	}
+
+	c = &compiledTemplate{
+		t:           t,
+		engineBound: callsAny(t.Tree.Root, (&TemplatingEngine{}).engineFuncs()),
+	}
+
+	templateCacheMutex.Lock()
+	defer templateCacheMutex.Unlock()
+	if len(templateCache) >= maxCachedTemplates {
+		templateCache = make(map[string]*compiledTemplate)
+	}
+	templateCache[text] = c
+
+	return c, nil
+}
+
+// engineCache holds the data of a TemplatingEngine, that doesn't change
+// between calls to Interpolate. Copies of an engine, e.g. with facts added,
+// share the cache, as the data doesn't depend on the facts.
+type engineCache struct {
+	vars   map[string]interface{}
+	groups map[string][]*Host
+	funcs  template.FuncMap
+
+	// templates bound to funcs
+	bound  map[*compiledTemplate]*template.Template
+	mBound sync.Mutex
+}
+
+func newEngineCache(t *TemplatingEngine) *engineCache {
+	c := &engineCache{
+		groups: groupHosts(t.hosts),
+		funcs:  t.engineFuncs(),
+		bound:  make(map[*compiledTemplate]*template.Template),
+	}
+
+	if t.Config != nil {
+		// required variables are checked when visiting the config
+		c.vars, _ = t.Config.varValues(t.Host)
+	}
+	return c
+}
+
+// bind returns a template, that can be executed with the TemplatingEngine of
+// the cache. Templates are bound only once per engine.
+func (e *engineCache) bind(c *compiledTemplate) (*template.Template, error) {
+	if !c.engineBound {
+		return c.t, nil
+	}
+
+	e.mBound.Lock()
+	defer e.mBound.Unlock()
+	if bound, ok := e.bound[c]; ok {
+		return bound, nil
+	}
+
+	bound, err := c.t.Clone()
+	if err != nil {
+		return nil, errs.Wrap(err, "failed to clone template")
+	}
+	bound.Funcs(e.funcs)
+	e.bound[c] = bound
+	return bound, nil
+}
+
+// callsAny reports whether any of the functions is called within the node.
+func callsAny(node parse.Node, funcs template.FuncMap) bool {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return false
+		}
+		for _, child := range n.Nodes {
+			if callsAny(child, funcs) {
+				return true
+			}
+		}
+	case *parse.ActionNode:
+		return callsAny(n.Pipe, funcs)
+	case *parse.PipeNode:
+		if n == nil {
+			return false
+		}
+		for _, cmd := range n.Cmds {
+			if callsAny(cmd, funcs) {
+				return true
+			}
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			if callsAny(arg, funcs) {
+				return true
+			}
+		}
+	case *parse.IdentifierNode:
+		_, ok := funcs[n.Ident]
+		return ok
+	case *parse.IfNode:
+		return callsAny(&n.BranchNode, funcs)
+	case *parse.RangeNode:
+		return callsAny(&n.BranchNode, funcs)
+	case *parse.WithNode:
+		return callsAny(&n.BranchNode, funcs)
+	case *parse.BranchNode:
+		return callsAny(n.Pipe, funcs) || callsAny(n.List, funcs) || callsAny(n.ElseList, funcs)
+	case *parse.TemplateNode:
+		return callsAny(n.Pipe, funcs)
+	}
+	return false
+}
+
+// templates returns all template strings of the command and its children.
+func (cmd *Command) templates() []string {
+	var templates []string
+	for _, s := range []string{cmd.Command, cmd.When} {
+		if s != "" {
+			templates = append(templates, s)
+		}
+	}
+
+	if cmd.When != "" {
+		templates[len(templates)-1] = whenTemplate(cmd.When)
+	}
+
+	for _, o := range []*Output{cmd.Stdout, cmd.Stderr} {
+		if o != nil && o.File != "" {
+			templates = append(templates, o.File)
+		}
+	}
+
+	for _, child := range cmd.Commands {
+		templates = append(templates, child.templates()...)
+	}
+	return templates
+}
+
+// compileTemplates compiles all template strings of the Config, so templates
+// are parsed only once and parse errors are reported before the job runs.
+func (c *Config) compileTemplates() error {
+	var templates []string
+	if c.Output != nil && c.Output.File != "" {
+		templates = append(templates, c.Output.File)
+	}
+
+	for _, cmd := range []*Command{c.Pre, c.Command, c.Post} {
+		if cmd != nil {
+			templates = append(templates, cmd.templates()...)
+		}
+	}
+
+	for _, text := range templates {
+		if _, err := compileTemplate(text); err != nil {
+			return errs.Wrapf(err, "invalid template %q", text)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+// Copyright (c) 2016 Niklas Wolber
+// This file is licensed under the MIT license.
+// See the LICENSE file for more information.
+
+package job
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompileTemplateCache(t *testing.T) {
+	const text = `{{.Host.Name | upper}} {{"test cache" | lower}}`
+
+	first, err := compileTemplate(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := compileTemplate(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect(t, true, first == second)
+	expect(t, false, first.engineBound)
+}
+
+func TestCompileTemplateEngineBound(t *testing.T) {
+	tests := []struct {
+		templ string
+		want  bool
+	}{
+		{`{{.Host.Name}}`, false},
+		{`{{now | date}}`, true},
+		{`{{if true}}{{else}}{{range hostsWithTag "role"}}{{end}}{{end}}`, true},
+		{`{{with .Host}}{{.Name | printf "%s-%s" (now | date)}}{{end}}`, true},
+		{`{{.Vars.now}}`, false},
+	}
+
+	for _, test := range tests {
+		c, err := compileTemplate(test.templ)
+		if err != nil {
+			t.Fatalf("%s: %s", test.templ, err)
+		}
+		if c.engineBound != test.want {
+			t.Errorf("%s: want engineBound %t, got %t", test.templ, test.want, c.engineBound)
+		}
+	}
+}
+
+func TestInterpolateBindsEngine(t *testing.T) {
+	const text = `{{now | date}}`
+
+	engine := func(year int) *TemplatingEngine {
+		tt := newTemplatingEngine(&Config{}, nil, nil)
+		tt.now = func() time.Time {
+			return time.Date(year, 1, 2, 0, 0, 0, 0, time.UTC)
+		}
+		return tt
+	}
+
+	got, err := engine(2016).Interpolate(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "2016-01-02", got)
+
+	got, err = engine(2017).Interpolate(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "2017-01-02", got)
+}
+
+func TestVisitConfigCompilesTemplates(t *testing.T) {
+	tests := []struct {
+		c    *Config
+		want string
+	}{
+		{
+			c: &Config{
+				Host:    &Host{},
+				Command: &Command{Command: "echo {{.Host.Name"},
+			},
+			want: "echo {{.Host.Name",
+		},
+		{
+			c: &Config{
+				Host: &Host{},
+				Command: &Command{
+					Flow: sequentialFlow,
+					Commands: []*Command{
+						{Command: "true", Stdout: &Output{File: "{{unknownFunc}}.txt"}},
+					},
+				},
+			},
+			want: "{{unknownFunc}}.txt",
+		},
+		{
+			c: &Config{
+				Host:    &Host{},
+				Command: &Command{Command: "true", When: "eq .Host.Name"},
+				Post:    &Command{Command: "true", When: "{{end}}"},
+			},
+			want: "{{end}}",
+		},
+		{
+			c: &Config{
+				Host:    &Host{},
+				Output:  &Output{File: "{{.Host.Name}"},
+				Command: &Command{Command: "true"},
+			},
+			want: "{{.Host.Name}",
+		},
+	}
+
+	for _, test := range tests {
+		_, err := VisitConfig(&StringBuilder{}, test.c)
+		if err == nil {
+			t.Errorf("%q: expected an error", test.want)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%q: unexpected error %s", test.want, err)
+		}
+	}
+}
+
+func TestEngineCache(t *testing.T) {
+	c := &Config{Vars: jobVars{"version": {Default: "1.0"}}}
+	hosts := []*Host{{Name: "db1", Groups: []string{"db"}}}
+	tt := newTemplatingEngine(c, hosts[0], hosts)
+
+	compiled, err := compileTemplate(`{{now | date}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := tt.cache.bind(compiled)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := tt.cache.bind(compiled)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, true, first == second)
+
+	got, err := tt.Interpolate(`{{.Vars.version}} {{range .Groups.db}}{{.Name}}{{end}}`)
+	expect(t, nil, err)
+	expect(t, "1.0 db1", got)
+
+	// a copy with facts uses the same cache
+	withFacts := *tt
+	withFacts.Facts = Facts{"os": "linux"}
+	got, err = withFacts.Interpolate(`{{.Facts.os}} {{.Vars.version}}`)
+	expect(t, nil, err)
+	expect(t, "linux 1.0", got)
+}
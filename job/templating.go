@@ -6,23 +6,31 @@ package job
 
 import (
 	"bytes"
-	"fmt"
 	"os"
 	"strings"
-	"text/template"
 	"time"
 
 	errs "github.com/pkg/errors"
 )
 
 // A TemplatingEngine can treat templating strings as defined by the Go
-// text/template package. It uses information from the Config, Host, environment
-// variables and the current time to replace place holders in the string.
+// text/template package. It uses information from the Config, all hosts of the
+// job, the current Host and its facts, environment variables, job variables,
+// the secrets file and the current time to replace place holders in the
+// string.
 type TemplatingEngine struct {
-	Config *Config
-	Host   *Host
-	Env    map[string]string
-	now    func() time.Time
+	Config  *Config
+	Host    *Host
+	Env     map[string]string
+	Secrets map[string]string
+	// Facts of the host, if they have been gathered.
+	Facts Facts
+	now   func() time.Time
+	// hosts of the run in lexical order
+	hosts []*Host
+	// data computed once per engine, nil for engines not created by
+	// newTemplatingEngine
+	cache *engineCache
 }
 
 func getEnv() map[string]string {
@@ -36,13 +44,17 @@ func getEnv() map[string]string {
 	return env
 }
 
-func newTemplatingEngine(c *Config, h *Host) *TemplatingEngine {
-	return &TemplatingEngine{
-		Config: c,
-		Host:   h,
-		Env:    getEnv(),
-		now:    time.Now,
+func newTemplatingEngine(c *Config, h *Host, hosts []*Host) *TemplatingEngine {
+	t := &TemplatingEngine{
+		Config:  c,
+		Host:    h,
+		hosts:   hosts,
+		Env:     getEnv(),
+		Secrets: secrets(),
+		now:     time.Now,
 	}
+	t.cache = newEngineCache(t)
+	return t
 }
 
 // Interpolate tries to replace all place holders present in templ with
@@ -50,35 +62,41 @@ func newTemplatingEngine(c *Config, h *Host) *TemplatingEngine {
 func (t *TemplatingEngine) Interpolate(templ string) (string, error) {
 	var buf bytes.Buffer
 
-	funcMap := template.FuncMap{
-		"date": func(t time.Time) string {
-			return fmt.Sprintf("%04d-%02d-%02d", t.Year(), t.Month(), t.Day())
-		},
-		"time": func(t time.Time) string {
-			return fmt.Sprintf("%02d:%02d:%02d", t.Hour(), t.Minute(), t.Second())
-		},
-		"now": func() time.Time {
-			return t.now()
-		},
+	c, err := compileTemplate(templ)
+	if err != nil {
+		return "", err
 	}
 
-	tt := template.New("").Funcs(funcMap)
+	cache := t.cache
+	if cache == nil {
+		cache = newEngineCache(t)
+	}
 
-	tt, err := tt.Parse(templ)
+	tt, err := cache.bind(c)
 	if err != nil {
-		return "", errs.Wrap(err, "failed to parse template")
+		return "", err
 	}
 
 	data := struct {
-		Config *Config
-		Host   *Host
-		Env    map[string]string
-		Now    time.Time
+		Config  *Config
+		Host    *Host
+		Hosts   []*Host
+		Groups  map[string][]*Host
+		Env     map[string]string
+		Vars    map[string]interface{}
+		Secrets map[string]string
+		Facts   Facts
+		Now     time.Time
 	}{
-		Config: t.Config,
-		Host:   t.Host,
-		Env:    t.Env,
-		Now:    time.Now(),
+		Config:  t.Config,
+		Host:    t.Host,
+		Hosts:   t.hosts,
+		Groups:  cache.groups,
+		Env:     t.Env,
+		Vars:    cache.vars,
+		Secrets: t.Secrets,
+		Facts:   t.Facts,
+		Now:     time.Now(),
 	}
 
 	err = tt.Execute(&buf, data)
@@ -88,3 +106,15 @@ func (t *TemplatingEngine) Interpolate(templ string) (string, error) {
 
 	return buf.String(), nil
 }
+
+// groupHosts returns the hosts by the names of the groups they are a member
+// of. The hosts of each group retain their order.
+func groupHosts(hosts []*Host) map[string][]*Host {
+	groups := make(map[string][]*Host)
+	for _, h := range hosts {
+		for _, group := range h.Groups {
+			groups[group] = append(groups[group], h)
+		}
+	}
+	return groups
+}
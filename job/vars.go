@@ -0,0 +1,266 @@
+// Copyright (c) 2016 Niklas Wolber
+// This file is licensed under the MIT license.
+// See the LICENSE file for more information.
+
+package job
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	errs "github.com/pkg/errors"
+)
+
+const (
+	stringVar = "string"
+	intVar    = "int"
+	floatVar  = "float"
+	boolVar   = "bool"
+)
+
+// A Var is a job variable, accessible as {{.Vars.name}}. Its value is taken
+// from the first of the following sources that is present: the value
+// supplied at run time, a host tag with the same name, the default.
+type Var struct {
+	// Type is one of string, int, float or bool. Default is string.
+	Type        string      `json:"type,omitempty"`
+	Default     interface{} `json:"default,omitempty"`
+	Required    bool        `json:"required,omitempty"`
+	Description string      `json:"description,omitempty"`
+
+	// value supplied at run time
+	value interface{}
+}
+
+// jobVars contains all variables of a job by name.
+type jobVars map[string]*Var
+
+// MarshalJSON marshals variables that only have a default value in the short
+// form.
+func (v *Var) MarshalJSON() ([]byte, error) {
+	if !v.Required && v.Description == "" && v.Default != nil && v.Type == inferVarType(v.Default) {
+		return json.Marshal(v.Default)
+	}
+
+	type plain Var
+	return json.Marshal((*plain)(v))
+}
+
+// UnmarshalJSON unmarshals a Var either from its default value, which also
+// determines the type, or from an object.
+func (v *Var) UnmarshalJSON(b []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(b, &value); err != nil {
+		return errs.Wrap(err, "failed to unmarshal variable")
+	}
+
+	if _, ok := value.(map[string]interface{}); !ok {
+		*v = Var{Type: inferVarType(value), Default: value}
+		return v.validate()
+	}
+
+	type plain Var
+	var p plain
+	if err := json.Unmarshal(b, &p); err != nil {
+		return errs.Wrap(err, "failed to unmarshal variable")
+	}
+
+	*v = Var(p)
+	if v.Type == "" {
+		v.Type = stringVar
+	}
+	return v.validate()
+}
+
+func inferVarType(value interface{}) string {
+	switch value := value.(type) {
+	case bool:
+		return boolVar
+	case float64:
+		if value == math.Trunc(value) {
+			return intVar
+		}
+		return floatVar
+	case int64:
+		return intVar
+	default:
+		return stringVar
+	}
+}
+
+// validate checks the type and converts the default value to it.
+func (v *Var) validate() error {
+	switch v.Type {
+	case stringVar, intVar, floatVar, boolVar:
+	default:
+		return errs.Errorf("unknown variable type %q", v.Type)
+	}
+
+	if v.Default == nil {
+		return nil
+	}
+
+	value, err := convertVar(v.Type, v.Default)
+	if err != nil {
+		return errs.Wrap(err, "invalid default value")
+	}
+	v.Default = value
+	return nil
+}
+
+// convertVar converts the value to the type. Strings are parsed, so values
+// from the command line or host tags can be used for any type.
+func convertVar(typ string, value interface{}) (interface{}, error) {
+	s, isString := value.(string)
+
+	switch typ {
+	case stringVar:
+		if isString {
+			return s, nil
+		}
+		b, err := json.Marshal(value)
+		return string(b), err
+	case intVar:
+		switch value := value.(type) {
+		case int64:
+			return value, nil
+		case float64:
+			if value != math.Trunc(value) {
+				return nil, errs.Errorf("%v is not an integer", value)
+			}
+			return int64(value), nil
+		}
+		if isString {
+			i, err := strconv.ParseInt(s, 10, 64)
+			return i, errs.Wrapf(err, "%q is not an integer", s)
+		}
+	case floatVar:
+		if f, ok := value.(float64); ok {
+			return f, nil
+		}
+		if isString {
+			f, err := strconv.ParseFloat(s, 64)
+			return f, errs.Wrapf(err, "%q is not a number", s)
+		}
+	case boolVar:
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+		if isString {
+			b, err := strconv.ParseBool(s)
+			return b, errs.Wrapf(err, "%q is not a boolean", s)
+		}
+	}
+
+	return nil, errs.Errorf("%v is not a %s", value, typ)
+}
+
+// SetVars supplies run-time values for the job's variables. It fails for
+// values of variables the job doesn't declare, so mistyped names don't go
+// unnoticed. Use DeclaredVars, if values are meant for multiple jobs.
+func (c *Config) SetVars(values map[string]string) error {
+	var undeclared []string
+	for name := range values {
+		if _, ok := c.Vars[name]; !ok {
+			undeclared = append(undeclared, name)
+		}
+	}
+	if len(undeclared) > 0 {
+		sort.Strings(undeclared)
+		return errs.Errorf("job %s doesn't declare the variables %s", c.Name, strings.Join(undeclared, ", "))
+	}
+
+	for name, value := range values {
+		v := c.Vars[name]
+		converted, err := convertVar(v.Type, value)
+		if err != nil {
+			return errs.Wrapf(err, "invalid value for variable %s", name)
+		}
+		v.value = converted
+	}
+	return nil
+}
+
+// DeclaredVars returns only the values of the variables the job declares.
+func (c *Config) DeclaredVars(values map[string]string) map[string]string {
+	declared := make(map[string]string)
+	for name, value := range values {
+		if _, ok := c.Vars[name]; ok {
+			declared[name] = value
+		}
+	}
+	return declared
+}
+
+// varValues returns the values of all variables for the host, which may be
+// nil. Variables without a value are omitted. An error is returned if a
+// required variable has no value.
+func (c *Config) varValues(h *Host) (map[string]interface{}, error) {
+	values := make(map[string]interface{}, len(c.Vars))
+	var missing []string
+	for name, v := range c.Vars {
+		value := v.value
+
+		if tag, ok := h.tag(name); ok && value == nil {
+			converted, err := convertVar(v.Type, tag)
+			if err != nil {
+				return nil, errs.Wrapf(err, "invalid value for variable %s in tag of host %s", name, h)
+			}
+			value = converted
+		}
+
+		if value == nil && !v.Required {
+			value = v.Default
+		}
+
+		if value == nil {
+			if v.Required {
+				missing = append(missing, name)
+			}
+			continue
+		}
+		values[name] = value
+	}
+
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return values, errs.Errorf("no value for required variables %s", strings.Join(missing, ", "))
+	}
+	return values, nil
+}
+
+func (h *Host) tag(name string) (string, bool) {
+	if h == nil {
+		return "", false
+	}
+
+	value, ok := h.Tags[name]
+	return value, ok
+}
+
+// VarValues are run-time values for job variables. It implements flag.Value,
+// so it can be used with repeated command line flags of the form name=value.
+type VarValues map[string]string
+
+func (v VarValues) String() string {
+	pairs := make([]string, 0, len(v))
+	for name, value := range v {
+		pairs = append(pairs, name+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, " ")
+}
+
+// Set adds a value of the form name=value.
+func (v VarValues) Set(pair string) error {
+	i := strings.Index(pair, "=")
+	if i <= 0 {
+		return errs.Errorf("invalid variable %q, expected name=value", pair)
+	}
+
+	v[pair[:i]] = pair[i+1:]
+	return nil
+}
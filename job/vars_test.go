@@ -0,0 +1,119 @@
+// Copyright (c) 2016 Niklas Wolber
+// This file is licensed under the MIT license.
+// See the LICENSE file for more information.
+
+package job
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const varsConfig = `{
+	"vars": {
+		"region": "eu",
+		"replicas": 3,
+		"ratio": {"type": "float", "default": 0.5},
+		"debug": false,
+		"version": {"type": "string", "required": true, "description": "release to deploy"}
+	}
+}`
+
+func TestVarsUnmarshal(t *testing.T) {
+	c, err := parseConfig(strings.NewReader(varsConfig))
+	expect(t, nil, err)
+
+	tests := []struct {
+		name, typ string
+		def       interface{}
+	}{
+		{"region", stringVar, "eu"},
+		{"replicas", intVar, int64(3)},
+		{"ratio", floatVar, 0.5},
+		{"debug", boolVar, false},
+		{"version", stringVar, nil},
+	}
+
+	for _, test := range tests {
+		v := c.Vars[test.name]
+		expect(t, test.typ, v.Type)
+		expect(t, test.def, v.Default)
+	}
+
+	b, err := json.Marshal(c.Vars["replicas"])
+	expect(t, nil, err)
+	expect(t, "3", string(b))
+
+	for _, invalid := range []string{
+		`{"vars": {"a": {"type": "list"}}}`,
+		`{"vars": {"a": {"type": "int", "default": "three"}}}`,
+		`{"vars": {"a": {"type": "int", "default": 1.5}}}`,
+	} {
+		if _, err := parseConfig(strings.NewReader(invalid)); err == nil {
+			t.Errorf("expected an error for %s", invalid)
+		}
+	}
+}
+
+func TestVarValues(t *testing.T) {
+	c, err := parseConfig(strings.NewReader(varsConfig))
+	expect(t, nil, err)
+
+	_, err = c.varValues(nil)
+	if err == nil {
+		t.Fatal("expected an error for the missing required variable")
+	}
+
+	if err := c.SetVars(map[string]string{"replicas": "many"}); err == nil {
+		t.Error("expected an error for an invalid integer")
+	}
+
+	vars := make(VarValues)
+	expect(t, nil, vars.Set("version=1.2.3"))
+	expect(t, nil, vars.Set("replicas=5"))
+	expect(t, nil, vars.Set("verison=1.2.4"))
+	if err := vars.Set("invalid"); err == nil {
+		t.Error("expected an error for a value without name")
+	}
+	if err := c.SetVars(vars); err == nil || !strings.Contains(err.Error(), "verison") {
+		t.Errorf("expected an error for the undeclared variable, got %v", err)
+	}
+	expect(t, 2, len(c.DeclaredVars(vars)))
+	expect(t, nil, c.SetVars(c.DeclaredVars(vars)))
+
+	h := &Host{Tags: map[string]string{"region": "us", "replicas": "7", "ratio": "0.25"}}
+	values, err := c.varValues(h)
+	expect(t, nil, err)
+
+	tests := []struct {
+		name string
+		want interface{}
+	}{
+		{"version", "1.2.3"},
+		// run-time values take precedence over host tags
+		{"replicas", int64(5)},
+		{"region", "us"},
+		{"ratio", 0.25},
+		{"debug", false},
+	}
+
+	for _, test := range tests {
+		expect(t, test.want, values[test.name])
+	}
+
+	h.Tags["debug"] = "maybe"
+	if _, err := c.varValues(h); err == nil {
+		t.Error("expected an error for an invalid tag value")
+	}
+}
+
+func TestTemplatingVars(t *testing.T) {
+	c, err := parseConfig(strings.NewReader(varsConfig))
+	expect(t, nil, err)
+	expect(t, nil, c.SetVars(map[string]string{"version": "1.2.3"}))
+
+	got, err := newTemplatingEngine(c, &Host{Tags: map[string]string{"region": "us"}}, nil).Interpolate("deploy {{.Vars.version}} to {{.Vars.region}} x{{.Vars.replicas}}")
+	expect(t, nil, err)
+	expect(t, "deploy 1.2.3 to us x3", got)
+}
@@ -0,0 +1,99 @@
+// Copyright (c) 2016 Niklas Wolber
+// This file is licensed under the MIT license.
+// See the LICENSE file for more information.
+
+package xCUTEr
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// limits restricts the runs of all jobs, that may run at the same time.
+type limits struct {
+	// Slots for running jobs, nil if unlimited.
+	jobs chan struct{}
+
+	// Named locks by name, created on first use.
+	locks map[string]chan struct{}
+	m     sync.Mutex
+}
+
+// newLimits returns limits that allow at most maxJobs running jobs. Zero
+// means unlimited.
+func newLimits(maxJobs int) *limits {
+	l := &limits{
+		locks: make(map[string]chan struct{}),
+	}
+	if maxJobs > 0 {
+		l.jobs = make(chan struct{}, maxJobs)
+	}
+	return l
+}
+
+func (l *limits) lock(name string) chan struct{} {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	lock, ok := l.locks[name]
+	if !ok {
+		lock = make(chan struct{}, 1)
+		l.locks[name] = lock
+	}
+	return lock
+}
+
+// acquire waits until all named locks and a slot for a running job are
+// available. Locks are acquired in lexical order before the slot, so runs
+// waiting for each other's locks don't deadlock and waiting runs don't
+// occupy slots. Wait is called once, if the run has to wait. The returned
+// function releases everything acquired. If the context is done first,
+// nothing is acquired.
+func (l *limits) acquire(ctx context.Context, locks []string, wait func()) (func(), error) {
+	names := append([]string(nil), locks...)
+	sort.Strings(names)
+
+	var acquired []chan struct{}
+	release := func() {
+		for i := len(acquired) - 1; i >= 0; i-- {
+			<-acquired[i]
+		}
+	}
+
+	var sems []chan struct{}
+	for i, name := range names {
+		if i > 0 && name == names[i-1] {
+			continue
+		}
+		sems = append(sems, l.lock(name))
+	}
+	if l.jobs != nil {
+		sems = append(sems, l.jobs)
+	}
+
+	waited := false
+	for _, sem := range sems {
+		select {
+		case sem <- struct{}{}:
+			acquired = append(acquired, sem)
+			continue
+		default:
+		}
+
+		if !waited {
+			waited = true
+			wait()
+		}
+
+		select {
+		case sem <- struct{}{}:
+			acquired = append(acquired, sem)
+		case <-ctx.Done():
+			release()
+			return nil, ctx.Err()
+		}
+	}
+
+	return release, nil
+}
@@ -0,0 +1,41 @@
+// Copyright (c) 2016 Niklas Wolber
+// This file is licensed under the MIT license.
+// See the LICENSE file for more information.
+
+package xCUTEr
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLimitsCancelWhileWaiting(t *testing.T) {
+	l := newLimits(1)
+
+	release, err := l.acquire(context.Background(), []string{"db"}, func() {
+		t.Error("expected the first run not to wait")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// waits for the job slot and has to release its lock when cancelled
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	waited := 0
+	if _, err := l.acquire(ctx, []string{"web"}, func() { waited++ }); err != context.DeadlineExceeded {
+		t.Errorf("want %v, got %v", context.DeadlineExceeded, err)
+	}
+	expect(t, "waited", waited, 1)
+
+	release()
+
+	release, err = l.acquire(context.Background(), []string{"web", "db", "web"}, func() {
+		t.Error("expected all locks to be released")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+}
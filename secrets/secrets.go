@@ -0,0 +1,336 @@
+// Copyright (c) 2016 Niklas Wolber
+// This file is licensed under the MIT license.
+// See the LICENSE file for more information.
+
+// Package secrets implements an encrypted secrets file, that can be versioned
+// alongside job files. Entry names are stored in clear text, while each value
+// is encrypted separately with AES-256-GCM. The key is either read from a key
+// file or derived from a passphrase.
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	errs "github.com/pkg/errors"
+)
+
+const (
+	version = 1
+	// KeySize is the size of the AES key in bytes.
+	KeySize    = 32
+	saltSize   = 16
+	iterations = 100000
+	// minIterations and maxIterations bound the PBKDF2 iterations of a
+	// secrets file. Fewer iterations make brute forcing the passphrase cheap,
+	// more iterations take forever to derive the key.
+	minIterations = 10000
+	maxIterations = 10000000
+	// checkName is the additional data used for the check value.
+	checkName = "xCUTEr secrets check"
+
+	// PassphraseEnv is the environment variable holding the passphrase, if no
+	// key file is used.
+	PassphraseEnv = "XCUTER_SECRETS_PASSPHRASE"
+)
+
+// A File is an encrypted secrets file.
+type File struct {
+	Version    int    `json:"version"`
+	Salt       []byte `json:"salt"`
+	Iterations int    `json:"iterations"`
+	// Check is an encrypted known value, used to verify the key before
+	// decrypting any entries.
+	Check   []byte            `json:"check,omitempty"`
+	Entries map[string][]byte `json:"entries"`
+}
+
+// New creates a new, empty secrets file.
+func New() (*File, error) {
+	f := &File{
+		Version:    version,
+		Iterations: iterations,
+		Entries:    make(map[string][]byte),
+	}
+
+	if err := f.NewSalt(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// Read reads the secrets file.
+func Read(file string) (*File, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errs.Wrapf(err, "failed to read secrets file %s", file)
+	}
+
+	var f File
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, errs.Wrapf(err, "failed to decode secrets file %s", file)
+	}
+
+	if f.Version != version {
+		return nil, errs.Errorf("unsupported secrets file version %d", f.Version)
+	}
+
+	if f.Iterations < minIterations || f.Iterations > maxIterations {
+		return nil, errs.Errorf("invalid number of iterations %d in secrets file %s, expected %d to %d", f.Iterations, file, minIterations, maxIterations)
+	}
+
+	if f.Entries == nil {
+		f.Entries = make(map[string][]byte)
+	}
+
+	return &f, nil
+}
+
+// Write writes the secrets file. Only the owner may read the file. The file
+// is written to a temporary file first, which then replaces the secrets file,
+// so a failed write doesn't lose the existing secrets.
+func (f *File) Write(file string) error {
+	b, err := json.MarshalIndent(f, "", "\t")
+	if err != nil {
+		return errs.Wrap(err, "failed to encode secrets file")
+	}
+
+	// temporary files are only accessible by the owner
+	tmp, err := ioutil.TempFile(filepath.Dir(file), filepath.Base(file))
+	if err != nil {
+		return errs.Wrapf(err, "failed to write secrets file %s", file)
+	}
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return errs.Wrapf(err, "failed to write secrets file %s", file)
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return errs.Wrapf(err, "failed to write secrets file %s", file)
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return errs.Wrapf(err, "failed to write secrets file %s", file)
+	}
+
+	return errs.Wrapf(os.Rename(tmp.Name(), file), "failed to write secrets file %s", file)
+}
+
+// NewSalt replaces the salt used to derive keys from passphrases. All entries
+// have to be encrypted again afterwards.
+func (f *File) NewSalt() error {
+	f.Salt = make([]byte, saltSize)
+	_, err := io.ReadFull(rand.Reader, f.Salt)
+	return errs.Wrap(err, "failed to generate salt")
+}
+
+// PassphraseKey derives a key from the passphrase.
+func (f *File) PassphraseKey(passphrase string) []byte {
+	return pbkdf2([]byte(passphrase), f.Salt, f.Iterations, KeySize)
+}
+
+// Names returns the names of all entries in lexical order.
+func (f *File) Names() []string {
+	names := make([]string, 0, len(f.Entries))
+	for name := range f.Entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Decrypt decrypts all entries.
+func (f *File) Decrypt(key []byte) (map[string]string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if f.Check != nil {
+		if _, err := open(gcm, f.Check, checkName); err != nil {
+			return nil, errs.New("wrong key or passphrase")
+		}
+	}
+
+	values := make(map[string]string, len(f.Entries))
+	for name, entry := range f.Entries {
+		value, err := open(gcm, entry, name)
+		if err != nil {
+			return nil, errs.Wrapf(err, "failed to decrypt %s", name)
+		}
+		values[name] = value
+	}
+	return values, nil
+}
+
+// Encrypt replaces all entries with the encrypted values.
+func (f *File) Encrypt(values map[string]string, key []byte) error {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+
+	check, err := seal(gcm, checkName, checkName)
+	if err != nil {
+		return err
+	}
+
+	entries := make(map[string][]byte, len(values))
+	for name, value := range values {
+		if entries[name], err = seal(gcm, value, name); err != nil {
+			return errs.Wrapf(err, "failed to encrypt %s", name)
+		}
+	}
+
+	f.Check, f.Entries = check, entries
+	return nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, errs.Errorf("invalid key size %d, want %d", len(key), KeySize)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errs.Wrap(err, "failed to create cipher")
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	return gcm, errs.Wrap(err, "failed to create GCM")
+}
+
+// seal encrypts the value. The name is used as additional data, so entries
+// cannot be swapped. The nonce is prepended to the cipher text.
+func seal(gcm cipher.AEAD, value, name string) ([]byte, error) {
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, errs.Wrap(err, "failed to generate nonce")
+	}
+
+	return gcm.Seal(nonce, nonce, []byte(value), []byte(name)), nil
+}
+
+func open(gcm cipher.AEAD, entry []byte, name string) (string, error) {
+	if len(entry) < gcm.NonceSize() {
+		return "", errs.New("entry too short")
+	}
+
+	nonce, cipherText := entry[:gcm.NonceSize()], entry[gcm.NonceSize():]
+	b, err := gcm.Open(nil, nonce, cipherText, []byte(name))
+	if err != nil {
+		return "", errs.Wrap(err, "failed to decrypt")
+	}
+	return string(b), nil
+}
+
+// GenerateKeyFile writes a new random key to the key file. An existing file
+// is not overwritten.
+func GenerateKeyFile(file string) error {
+	key := make([]byte, KeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return errs.Wrap(err, "failed to generate key")
+	}
+
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return errs.Wrapf(err, "failed to create key file %s", file)
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(base64.StdEncoding.EncodeToString(key) + "\n")
+	return errs.Wrapf(err, "failed to write key file %s", file)
+}
+
+// ReadKeyFile reads a key written by GenerateKeyFile.
+func ReadKeyFile(file string) ([]byte, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errs.Wrapf(err, "failed to read key file %s", file)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(b)))
+	if err != nil {
+		return nil, errs.Wrapf(err, "failed to decode key file %s", file)
+	}
+	return key, nil
+}
+
+// Key returns the key for the secrets file. It is read from the key file,
+// if one is given. Otherwise it is derived from the passphrase in the
+// environment variable PassphraseEnv.
+func (f *File) Key(keyFile string) ([]byte, error) {
+	if keyFile != "" {
+		return ReadKeyFile(keyFile)
+	}
+
+	passphrase, ok := os.LookupEnv(PassphraseEnv)
+	if !ok {
+		return nil, errs.Errorf("neither a key file nor %s is given", PassphraseEnv)
+	}
+	return f.PassphraseKey(passphrase), nil
+}
+
+// Load reads and decrypts the secrets file.
+func Load(file, keyFile string) (map[string]string, error) {
+	f, err := Read(file)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := f.Key(keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return f.Decrypt(key)
+}
+
+// pbkdf2 implements PBKDF2 with HMAC-SHA256 as defined in RFC 8018.
+func pbkdf2(password, salt []byte, iter, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	hashLen := prf.Size()
+	numBlocks := (keyLen + hashLen - 1) / hashLen
+
+	var buf [4]byte
+	dk := make([]byte, 0, numBlocks*hashLen)
+	u := make([]byte, hashLen)
+	for block := 1; block <= numBlocks; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(buf[:], uint32(block))
+		prf.Write(buf[:])
+		dk = prf.Sum(dk)
+		t := dk[len(dk)-hashLen:]
+		copy(u, t)
+
+		for n := 2; n <= iter; n++ {
+			prf.Reset()
+			prf.Write(u)
+			u = u[:0]
+			u = prf.Sum(u)
+			for i := range u {
+				t[i] ^= u[i]
+			}
+		}
+	}
+	return dk[:keyLen]
+}
@@ -0,0 +1,173 @@
+// Copyright (c) 2016 Niklas Wolber
+// This file is licensed under the MIT license.
+// See the LICENSE file for more information.
+
+package secrets
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	f, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Iterations = 1
+
+	values := map[string]string{
+		"db":  "s3cr3t",
+		"api": "token",
+	}
+
+	key := f.PassphraseKey("passphrase")
+	if err := f.Encrypt(values, key); err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := []string{"api", "db"}, f.Names(); !reflect.DeepEqual(want, got) {
+		t.Errorf("want names %v, got %v", want, got)
+	}
+
+	got, err := f.Decrypt(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(values, got) {
+		t.Errorf("want %v, got %v", values, got)
+	}
+
+	if _, err := f.Decrypt(f.PassphraseKey("wrong")); err == nil {
+		t.Error("expected an error for the wrong passphrase")
+	}
+
+	// entries must not be interchangeable
+	f.Entries["db"], f.Entries["api"] = f.Entries["api"], f.Entries["db"]
+	if _, err := f.Decrypt(key); err == nil {
+		t.Error("expected an error for swapped entries")
+	}
+}
+
+func TestReadWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	keyFile := filepath.Join(dir, "key")
+	if err := GenerateKeyFile(keyFile); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := GenerateKeyFile(keyFile); err == nil {
+		t.Error("expected an existing key file not to be overwritten")
+	}
+
+	key, err := ReadKeyFile(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values := map[string]string{"db": "s3cr3t"}
+	if err := f.Encrypt(values, key); err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(dir, "secrets.json")
+	if err := f.Write(file); err != nil {
+		t.Fatal(err)
+	}
+
+	// overwrite the existing file
+	if err := f.Write(file); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("want mode %o, got %o", 0600, mode)
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Errorf("want only the key and the secrets file, got %d files", len(files))
+	}
+
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "s3cr3t") {
+		t.Error("secrets file contains a clear text value")
+	}
+
+	got, err := Load(file, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(values, got) {
+		t.Errorf("want %v, got %v", values, got)
+	}
+}
+
+func TestReadIterations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "secrets.json")
+	for _, iterations := range []int{0, minIterations - 1, maxIterations + 1} {
+		f, err := New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Iterations = iterations
+
+		if err := f.Write(file); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := Read(file); err == nil {
+			t.Errorf("expected an error for %d iterations", iterations)
+		}
+	}
+}
+
+func TestPBKDF2(t *testing.T) {
+	// test vectors from RFC 7914, section 11
+	tests := []struct {
+		password, salt string
+		iter           int
+		want           string
+	}{
+		{"passwd", "salt", 1, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"},
+		{"Password", "NaCl", 80000, "4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56a1d425a1225833549adb841b51c9b3176a272bdebba1d078478f62b397f33c8d"},
+	}
+
+	for _, test := range tests {
+		got := hex.EncodeToString(pbkdf2([]byte(test.password), []byte(test.salt), test.iter, 64))
+		if got != test.want {
+			t.Errorf("pbkdf2(%q, %q, %d): want %s, got %s", test.password, test.salt, test.iter, test.want, got)
+		}
+	}
+}
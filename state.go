@@ -0,0 +1,160 @@
+// Copyright (c) 2016 Niklas Wolber
+// This file is licensed under the MIT license.
+// See the LICENSE file for more information.
+
+package xCUTEr
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	errs "github.com/pkg/errors"
+)
+
+// state is persisted between restarts of xCUTEr. Jobs are identified by the
+// absolute path of their job file.
+type state struct {
+	// File the state is persisted in. If empty, the state is only kept in
+	// memory.
+	file string
+	m    sync.Mutex
+
+	Jobs map[string]*jobState `json:"jobs"`
+}
+
+// jobState is the persisted state of a single job.
+type jobState struct {
+	// Start of the latest run.
+	LastRun time.Time `json:"lastRun"`
+	// Whether the job has been activated or deactivated. Nil, if neither
+	// happened.
+	Active *bool `json:"active,omitempty"`
+	// Whether runs of the job are paused.
+	Paused bool `json:"paused,omitempty"`
+}
+
+// inactive returns whether the job waits for activation. Jobs that have
+// never been activated or deactivated only wait, if jobs need to be activated
+// manually.
+func (j jobState) inactive(manual bool) bool {
+	if j.Active == nil {
+		return manual
+	}
+	return !*j.Active
+}
+
+// loadState reads the state from the file. A missing file results in an
+// empty state.
+func loadState(file string) (*state, error) {
+	s := &state{
+		file: file,
+		Jobs: make(map[string]*jobState),
+	}
+
+	if file == "" {
+		return s, nil
+	}
+
+	b, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, errs.Wrap(err, "failed to read state")
+	}
+
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, errs.Wrapf(err, "failed to decode state %s", file)
+	}
+	if s.Jobs == nil {
+		s.Jobs = make(map[string]*jobState)
+	}
+	return s, nil
+}
+
+// save writes the state to a temporary file first, so a crash doesn't leave
+// a truncated state behind.
+func (s *state) save() error {
+	if s.file == "" {
+		return nil
+	}
+
+	b, err := json.MarshalIndent(s, "", "\t")
+	if err != nil {
+		return errs.Wrap(err, "failed to encode state")
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.file), filepath.Base(s.file))
+	if err != nil {
+		return errs.Wrap(err, "failed to write state")
+	}
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return errs.Wrap(err, "failed to write state")
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return errs.Wrap(err, "failed to write state")
+	}
+
+	return errs.Wrap(os.Rename(tmp.Name(), s.file), "failed to write state")
+}
+
+func stateKey(file string) string {
+	if path, err := filepath.Abs(file); err == nil {
+		return path
+	}
+	return file
+}
+
+// job returns the state of the job file. It has to be called with s.m held.
+func (s *state) job(file string) *jobState {
+	key := stateKey(file)
+	j, ok := s.Jobs[key]
+	if !ok {
+		j = &jobState{}
+		s.Jobs[key] = j
+	}
+	return j
+}
+
+// get returns a copy of the state of the job file.
+func (s *state) get(file string) jobState {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if j, ok := s.Jobs[stateKey(file)]; ok {
+		return *j
+	}
+	return jobState{}
+}
+
+// update changes the state of the job file and persists it.
+func (s *state) update(file string, f func(j *jobState)) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	f(s.job(file))
+	if err := s.save(); err != nil {
+		log.Println(err)
+	}
+}
+
+// lastRun returns the start of the latest run of the job file or the zero
+// time, if it never ran.
+func (s *state) lastRun(file string) time.Time {
+	return s.get(file).LastRun
+}
+
+// setLastRun records the start of a run of the job file.
+func (s *state) setLastRun(file string, t time.Time) {
+	s.update(file, func(j *jobState) { j.LastRun = t })
+}
@@ -0,0 +1,227 @@
+// Copyright (c) 2016 Niklas Wolber
+// This file is licensed under the MIT license.
+// See the LICENSE file for more information.
+
+package xCUTEr
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nwolber/xCUTEr/job"
+)
+
+func TestStatePersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xCUTEr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "state.json")
+	s, err := loadState(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !s.lastRun("test.job").IsZero() {
+		t.Error("expected job without state to never have run")
+	}
+
+	want := time.Date(2016, 12, 24, 18, 30, 0, 0, time.UTC)
+	s.setLastRun("test.job", want)
+
+	s, err = loadState(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := s.lastRun("test.job"); !got.Equal(want) {
+		t.Errorf("want last run %s, got %s", want, got)
+	}
+}
+
+func TestCatchUp(t *testing.T) {
+	e, _ := newExecutor(context.TODO(), "")
+	e.schedule = func(c *job.Config, f func()) (string, error) {
+		return "TEST-ID", nil
+	}
+	e.manualActive = true
+	e.remove = func(string) {}
+	e.state.setLastRun("test.job", time.Now().Truncate(time.Hour).Add(-90*time.Minute))
+
+	var catchUp job.CatchUp
+	if err := json.Unmarshal([]byte(`"all"`), &catchUp); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan time.Time)
+	j := &jobInfo{
+		file: "test.job",
+		c: &job.Config{
+			Name:     "Test Job",
+			Schedule: "@hourly",
+			CatchUp:  &catchUp,
+		},
+	}
+	e.run = func(info *runInfo) {
+		done <- info.CatchUp()
+	}
+
+	// only jobs loaded on startup catch up
+	if err := e.Add(j); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Activate(j.file); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Reload(j); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case missed := <-done:
+		t.Fatalf("expected added, activated and reloaded jobs not to catch up, got a run at %s", missed)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	e.Remove(j.file)
+	if err := e.Load(j); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case missed := <-done:
+			if missed.IsZero() || missed.Minute() != 0 {
+				t.Errorf("expected run to catch up on a full hour, got %s", missed)
+			}
+		case <-time.After(gracePeriod):
+			t.Fatal("expected missed runs to be caught up")
+		}
+	}
+
+	select {
+	case missed := <-done:
+		t.Errorf("expected only two missed runs, got another one at %s", missed)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestManualActivationPersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xCUTEr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	start := func() *executor {
+		e, _ := newExecutor(context.TODO(), "")
+		e.manualActive = true
+		e.schedule = func(c *job.Config, f func()) (string, error) {
+			return "TEST-ID", nil
+		}
+		e.remove = func(string) {}
+		if e.state, err = loadState(filepath.Join(dir, "state.json")); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, name := range []string{"a", "b"} {
+			e.Add(&jobInfo{
+				file: name + ".job",
+				c: &job.Config{
+					Name:     name,
+					Schedule: "@hourly",
+				},
+			})
+		}
+		return e
+	}
+
+	e := start()
+	expectExecutor(t, e, "new jobs", 2, 0, 0, 0)
+
+	if err := e.Activate("a.job"); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Pause("a.job"); err != nil {
+		t.Fatal(err)
+	}
+	expectExecutor(t, e, "activated", 1, 1, 0, 0)
+
+	e = start()
+	expectExecutor(t, e, "after restart", 1, 1, 0, 0)
+	if e.isScheduled("a.job") == nil {
+		t.Error("expected a.job to stay active")
+	}
+	if !e.state.get("a.job").Paused {
+		t.Error("expected a.job to stay paused")
+	}
+
+	if err := e.Deactivate("a.job"); err != nil {
+		t.Fatal(err)
+	}
+
+	e = start()
+	expectExecutor(t, e, "after deactivation", 2, 0, 0, 0)
+}
+
+func TestDeactivationPersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xCUTEr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	j := &jobInfo{
+		file: "test.job",
+		c: &job.Config{
+			Name:     "Test Job",
+			Schedule: "@hourly",
+		},
+	}
+
+	start := func() *executor {
+		e, _ := newExecutor(context.TODO(), "")
+		e.schedule = func(c *job.Config, f func()) (string, error) {
+			return "TEST-ID", nil
+		}
+		e.remove = func(string) {}
+		if e.state, err = loadState(filepath.Join(dir, "state.json")); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := e.Add(j); err != nil {
+			t.Fatal(err)
+		}
+		return e
+	}
+
+	e := start()
+	// runs don't deactivate jobs, that don't need to be activated manually
+	e.state.setLastRun(j.file, time.Now())
+	expectExecutor(t, e, "new job", 0, 1, 0, 0)
+
+	if err := e.Deactivate(j.file); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := e.Reload(j); err != nil {
+		t.Fatal(err)
+	}
+	expectExecutor(t, e, "after reload", 1, 0, 0, 0)
+
+	e = start()
+	expectExecutor(t, e, "after restart", 1, 0, 0, 0)
+
+	if err := e.Activate(j.file); err != nil {
+		t.Fatal(err)
+	}
+
+	e = start()
+	expectExecutor(t, e, "after activation", 0, 1, 0, 0)
+}
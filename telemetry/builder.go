@@ -5,6 +5,7 @@
 package telemetry
 
 import (
+	"context"
 	"time"
 
 	"github.com/nwolber/xCUTEr/flunc"
@@ -35,7 +36,10 @@ type telemetryBuilder struct {
 func Instrument(c *job.Config) (flunc.Flunc, *EventStore, error) {
 	builder, events := NewBuilder()
 	f, err := job.VisitConfig(builder, c)
-	return f.(flunc.Flunc), events, err
+	if err != nil {
+		return nil, nil, err
+	}
+	return f.(flunc.Flunc), events, nil
 }
 
 // NewBuilder returns a ConfigBuilder that instruments the
@@ -105,6 +109,7 @@ func (t *telemetryBuilder) Hosts(nodeName string) job.Group {
 }
 
 func (t *telemetryBuilder) Host(nodeName string, c *job.Config, h *job.Host) job.Group {
+	t.events.storeHost(nodeName, h)
 	return &nodeGroup{
 		events: t.events,
 		name:   nodeName,
@@ -124,12 +129,38 @@ func (t *telemetryBuilder) Retry(nodeName string, child interface{}, retries uin
 	return instrument(nodeName, t.exec.Retry(child, retries).(flunc.Flunc), t.events)
 }
 
-func (t *telemetryBuilder) Templating(nodeName string, c *job.Config, h *job.Host) interface{} {
-	return instrument(nodeName, t.exec.Templating(c, h).(flunc.Flunc), t.events)
+func (t *telemetryBuilder) When(nodeName string, expr string, child interface{}) interface{} {
+	return instrument(nodeName, t.exec.When(expr, child).(flunc.Flunc), t.events)
+}
+
+func (t *telemetryBuilder) Templating(nodeName string, c *job.Config, h *job.Host, hosts []*job.Host) interface{} {
+	return instrument(nodeName, t.exec.Templating(c, h, hosts).(flunc.Flunc), t.events)
 }
 
-func (t *telemetryBuilder) SSHClient(nodeName string, host, user, keyFile, password string, keyboardInteractive map[string]string) interface{} {
-	return instrument(nodeName, t.exec.SSHClient(host, user, keyFile, password, keyboardInteractive).(flunc.Flunc), t.events)
+func (t *telemetryBuilder) SSHClient(nodeName string, h *job.Host) interface{} {
+	return instrument(nodeName, t.exec.SSHClient(h).(flunc.Flunc), t.events)
+}
+
+func (t *telemetryBuilder) Facts(nodeName string, h *job.Host) interface{} {
+	t.events.storeFacts(nodeName, h)
+	f := t.exec.Facts(h).(flunc.Flunc)
+
+	return instrument(nodeName, flunc.MakeFlunc(func(ctx context.Context) (context.Context, error) {
+		ctx, err := f(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		if tt, ok := ctx.Value(job.TemplatingKey).(*job.TemplatingEngine); ok {
+			t.events.store(Event{
+				Timestamp: time.Now(),
+				Type:      EventFacts,
+				Name:      nodeName,
+				Facts:     &tt.Facts,
+			})
+		}
+		return ctx, nil
+	}), t.events)
 }
 
 func (t *telemetryBuilder) Forwarding(nodeName string, f *job.Forwarding) interface{} {
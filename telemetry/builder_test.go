@@ -24,6 +24,86 @@ func TestEventStore(t *testing.T) {
 	expect(t, "store", 0, len(s.events))
 }
 
+func TestEventStoreTiming(t *testing.T) {
+	host := &job.Host{Name: "box", Addr: "localhost", Port: 22}
+	c := &job.Config{
+		Name:    "Test Job",
+		Host:    host,
+		Command: &job.Command{Command: "true"},
+	}
+
+	_, events, err := Instrument(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the hosts of the config change after the tree has been built
+	c.Host = &job.Host{Name: "other", Addr: "localhost", Port: 22}
+
+	timing := events.Timing()
+	expect(t, "hosts", 1, len(timing.Hosts))
+
+	var nodeName string
+	for name, h := range events.hosts {
+		expect(t, "host", host, h)
+		nodeName = name
+	}
+
+	start := time.Now()
+	timing.ApplyStore([]Event{
+		{Type: EventStart, Name: nodeName, Timestamp: start},
+		{Type: EventEnd, Name: nodeName, Timestamp: start.Add(time.Second)},
+	})
+	expect(t, "runtime", time.Second, timing.Hosts[host].Runtime)
+}
+
+func TestNewTiming(t *testing.T) {
+	host := &job.Host{Name: "box", Addr: "localhost", Port: 22}
+	timing, err := NewTiming(&job.Config{
+		Name:    "Test Job",
+		Host:    host,
+		Command: &job.Command{Command: "true"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect(t, "hosts", 1, len(timing.Hosts))
+	if _, ok := timing.Hosts[host]; !ok {
+		t.Error("expected a node for the host")
+	}
+}
+
+func TestFactsTiming(t *testing.T) {
+	host := &job.Host{Name: "box", Addr: "localhost", Port: 22}
+	c := &job.Config{
+		Name:  "Test Job",
+		Host:  host,
+		Facts: true,
+		Command: &job.Command{
+			Command: "true",
+			Target:  "local",
+		},
+	}
+
+	f, events, err := Instrument(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	timing := events.Timing()
+	timing.ApplyStore(events.Get())
+
+	facts := timing.Hosts[host].Facts
+	if _, ok := facts["kernel"]; !ok {
+		t.Errorf("expected kernel facts, got %#v", facts)
+	}
+}
+
 func TestBuilder(t *testing.T) {
 	noopFlunc := flunc.MakeFlunc(func(ctx context.Context) (context.Context, error) { return nil, nil })
 
@@ -42,8 +122,10 @@ func TestBuilder(t *testing.T) {
 	_ = builder.ErrorSafeguard(noopFlunc).(flunc.Flunc)
 	_ = builder.ContextBounds(noopFlunc).(flunc.Flunc)
 	_ = builder.Retry(noopFlunc, 42).(flunc.Flunc)
-	_ = builder.Templating(&job.Config{}, &job.Host{}).(flunc.Flunc)
-	_ = builder.SSHClient("", "", "", "", nil).(flunc.Flunc)
+	_ = builder.When("true", noopFlunc).(flunc.Flunc)
+	_ = builder.Templating(&job.Config{}, &job.Host{}, nil).(flunc.Flunc)
+	_ = builder.SSHClient(&job.Host{}).(flunc.Flunc)
+	_ = builder.Facts(&job.Host{}).(flunc.Flunc)
 	_ = builder.Forwarding(&job.Forwarding{}).(flunc.Flunc)
 	_ = builder.Tunnel(&job.Forwarding{}).(flunc.Flunc)
 	_ = builder.Commands(&job.Command{}).(*nodeGroup)
@@ -7,6 +7,8 @@ package telemetry
 import (
 	"sync"
 	"time"
+
+	"github.com/nwolber/xCUTEr/job"
 )
 
 type EventType uint
@@ -16,6 +18,9 @@ const (
 	EventLog
 	EventEnd
 	EventFailed
+	EventCancelled
+	EventTimeout
+	EventFacts
 )
 
 func (e EventType) String() string {
@@ -28,22 +33,63 @@ func (e EventType) String() string {
 		return "End"
 	case EventFailed:
 		return "Failed"
+	case EventCancelled:
+		return "Cancelled"
+	case EventTimeout:
+		return "Timeout"
+	case EventFacts:
+		return "Facts"
 	}
 	return "Unknown"
 }
 
-// An Event is created, when a flunc starts, ends or generates a log message.
+// An Event is created, when a flunc starts, ends, generates a log message or
+// gathered the facts of a host.
 type Event struct {
 	Type      EventType
 	Timestamp time.Time
 	Name      string
 	Info      LogInfo
+	// Facts gathered, if the Type is EventFacts. A pointer keeps Events
+	// comparable.
+	Facts *job.Facts
 }
 
 // An EventStore stores Events.
 type EventStore struct {
 	m      sync.Mutex
 	events []Event
+	// hosts of the instrumented execution tree by node name
+	hosts map[string]*job.Host
+	// hosts, whose facts are gathered, by the name of the facts node
+	facts map[string]*job.Host
+}
+
+func (e *EventStore) storeHost(nodeName string, host *job.Host) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	if e.hosts == nil {
+		e.hosts = make(map[string]*job.Host)
+	}
+	e.hosts[nodeName] = host
+}
+
+func (e *EventStore) storeFacts(nodeName string, host *job.Host) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	if e.facts == nil {
+		e.facts = make(map[string]*job.Host)
+	}
+	e.facts[nodeName] = host
+}
+
+// Timing returns a new Timing for the hosts of the execution tree, the
+// EventStore has been created for. Use it instead of visiting the config
+// again, which may resolve a different set of hosts.
+func (e *EventStore) Timing() *Timing {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return newTiming(e.hosts, e.facts)
 }
 
 func (e *EventStore) store(event Event) {
@@ -12,6 +12,7 @@ import (
 	"runtime"
 	"time"
 
+	"github.com/nwolber/xCUTEr/job"
 	"github.com/nwolber/xCUTEr/logger"
 )
 
@@ -21,9 +22,10 @@ type LogInfo struct {
 }
 
 type telemetryLogger struct {
-	orig   logger.Logger
-	name   string
-	events *EventStore
+	orig     logger.Logger
+	name     string
+	events   *EventStore
+	redactor *job.Redactor
 }
 
 var (
@@ -42,6 +44,8 @@ func (l *telemetryLogger) Log(t time.Time, message string) {
 		message = message[:l-1]
 	}
 
+	message = l.redactor.Redact(message)
+
 	l.events.store(Event{
 		Timestamp: t,
 		Type:      EventLog,
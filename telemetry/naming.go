@@ -41,8 +41,10 @@ type NamedConfigBuilder interface {
 	ErrorSafeguard(nodeName string, child interface{}) interface{}
 	ContextBounds(nodeName string, child interface{}) interface{}
 	Retry(nodeName string, child interface{}, retries uint) interface{}
-	Templating(nodeName string, c *job.Config, h *job.Host) interface{}
-	SSHClient(nodeName string, host, user, keyFile, password string, keyboardInteractive map[string]string) interface{}
+	When(nodeName string, expr string, child interface{}) interface{}
+	Templating(nodeName string, c *job.Config, h *job.Host, hosts []*job.Host) interface{}
+	SSHClient(nodeName string, h *job.Host) interface{}
+	Facts(nodeName string, h *job.Host) interface{}
 	Forwarding(nodeName string, f *job.Forwarding) interface{}
 	Tunnel(nodeName string, f *job.Forwarding) interface{}
 	Commands(nodeName string, cmd *job.Command) job.Group
@@ -117,12 +119,20 @@ func (t *NamingBuilder) Retry(child interface{}, retries uint) interface{} {
 	return t.NamedConfigBuilder.Retry("Retry"+t.nextName(), child, retries)
 }
 
-func (t *NamingBuilder) Templating(c *job.Config, h *job.Host) interface{} {
-	return t.NamedConfigBuilder.Templating("Templating"+t.nextName(), c, h)
+func (t *NamingBuilder) When(expr string, child interface{}) interface{} {
+	return t.NamedConfigBuilder.When("When"+t.nextName(), expr, child)
 }
 
-func (t *NamingBuilder) SSHClient(host, user, keyFile, password string, keyboardInteractive map[string]string) interface{} {
-	return t.NamedConfigBuilder.SSHClient("SSHClient"+t.nextName(), host, user, keyFile, password, keyboardInteractive)
+func (t *NamingBuilder) Templating(c *job.Config, h *job.Host, hosts []*job.Host) interface{} {
+	return t.NamedConfigBuilder.Templating("Templating"+t.nextName(), c, h, hosts)
+}
+
+func (t *NamingBuilder) SSHClient(h *job.Host) interface{} {
+	return t.NamedConfigBuilder.SSHClient("SSHClient"+t.nextName(), h)
+}
+
+func (t *NamingBuilder) Facts(h *job.Host) interface{} {
+	return t.NamedConfigBuilder.Facts("Facts"+t.nextName(), h)
 }
 
 func (t *NamingBuilder) Forwarding(f *job.Forwarding) interface{} {
@@ -28,10 +28,12 @@ func instrument(name string, f flunc.Flunc, events *EventStore) flunc.Flunc {
 	}
 
 	return flunc.MakeFlunc(func(ctx context.Context) (context.Context, error) {
+		redactor, _ := ctx.Value(job.RedactorKey).(*job.Redactor)
 		logger := telemetryLogger{
-			name:   name,
-			events: events,
-			orig:   findOriginalLogger(ctx),
+			name:     name,
+			events:   events,
+			orig:     findOriginalLogger(ctx),
+			redactor: redactor,
 		}
 
 		telemetryContext := context.WithValue(ctx, job.LoggerKey, &logger)
@@ -45,24 +47,31 @@ func instrument(name string, f flunc.Flunc, events *EventStore) flunc.Flunc {
 		newCtx, err := f(telemetryContext)
 		stop := time.Now()
 
-		if err != nil {
-			events.store(Event{
-				Timestamp: stop,
-				Type:      EventFailed,
-				Name:      name,
-			})
-		} else {
-			events.store(Event{
-				Timestamp: stop,
-				Type:      EventEnd,
-				Name:      name,
-			})
-		}
+		events.store(Event{
+			Timestamp: stop,
+			Type:      endEvent(err),
+			Name:      name,
+		})
 
 		return newCtx, err
 	})
 }
 
+// endEvent returns the type of the Event, that records a flunc ending with
+// err.
+func endEvent(err error) EventType {
+	switch {
+	case err == nil:
+		return EventEnd
+	case flunc.IsTimeout(err):
+		return EventTimeout
+	case flunc.IsCancelled(err):
+		return EventCancelled
+	default:
+		return EventFailed
+	}
+}
+
 func findOriginalLogger(ctx context.Context) logger.Logger {
 	origLogger, ok := ctx.Value(job.LoggerKey).(logger.Logger)
 	for ok {
@@ -14,6 +14,7 @@ import (
 	"github.com/nwolber/xCUTEr/flunc"
 	"github.com/nwolber/xCUTEr/job"
 	"github.com/nwolber/xCUTEr/logger"
+	errs "github.com/pkg/errors"
 )
 
 func expect(t *testing.T, name string, want, got interface{}) bool {
@@ -75,6 +76,16 @@ func TestInstrument(t *testing.T) {
 			return nil, errFuncFailed
 		})
 
+		errCancelled = errs.Wrap(flunc.ErrCancelled, "cancellingFlunc")
+
+		cancellingFlunc = flunc.MakeFlunc(func(ctx context.Context) (context.Context, error) {
+			return nil, errCancelled
+		})
+
+		timingOutFlunc = flunc.MakeFlunc(func(ctx context.Context) (context.Context, error) {
+			return nil, flunc.ErrTimeout
+		})
+
 		loggingFlunc = flunc.MakeFlunc(func(ctx context.Context) (context.Context, error) {
 			logger := ctx.Value(job.LoggerKey).(logger.Logger)
 
@@ -107,6 +118,24 @@ func TestInstrument(t *testing.T) {
 			},
 			err: errFuncFailed,
 		},
+		{
+			name: "cancelled",
+			f:    cancellingFlunc,
+			want: []Event{
+				{Name: "cancelled", Type: EventStart},
+				{Name: "cancelled", Type: EventCancelled},
+			},
+			err: errCancelled,
+		},
+		{
+			name: "timeout",
+			f:    timingOutFlunc,
+			want: []Event{
+				{Name: "timeout", Type: EventStart},
+				{Name: "timeout", Type: EventTimeout},
+			},
+			err: flunc.ErrTimeout,
+		},
 		{
 			name: "logging",
 			f:    loggingFlunc,
@@ -132,6 +161,42 @@ func TestInstrument(t *testing.T) {
 	}
 }
 
+func TestInstrumentCombinators(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	timedOut, cancel := context.WithDeadline(context.Background(), time.Now())
+	defer cancel()
+
+	noopFlunc := flunc.MakeFlunc(func(ctx context.Context) (context.Context, error) {
+		return nil, nil
+	})
+
+	tests := []struct {
+		name string
+		f    flunc.Flunc
+		ctx  context.Context
+		want EventType
+	}{
+		{"sequential", flunc.Sequential(noopFlunc), context.Background(), EventEnd},
+		{"sequential cancelled", flunc.Sequential(noopFlunc), cancelled, EventCancelled},
+		{"sequential timeout", flunc.Sequential(noopFlunc), timedOut, EventTimeout},
+		{"parallel", flunc.Parallel(noopFlunc), context.Background(), EventEnd},
+		{"parallel cancelled", flunc.Parallel(noopFlunc), cancelled, EventCancelled},
+		{"parallel timeout", flunc.Parallel(noopFlunc), timedOut, EventTimeout},
+	}
+
+	for _, test := range tests {
+		events := &EventStore{}
+		instrument(test.name, test.f, events)(test.ctx)
+
+		expectEvents(t, test.name, []Event{
+			{Name: test.name, Type: EventStart},
+			{Name: test.name, Type: test.want},
+		}, events.events)
+	}
+}
+
 func TestInstrumentWithAlteredContext(t *testing.T) {
 	// Fluncs may return a new context to store new values.
 	// Instrument has to make sure, that this new context is
@@ -167,3 +232,15 @@ func TestFindOriginalLogger(t *testing.T) {
 
 	expect(t, "", l, got)
 }
+
+func TestLoggerRedacts(t *testing.T) {
+	job.UseSecrets(map[string]string{"token": "s3cr3t-token"})
+	defer job.UseSecrets(nil)
+
+	events := &EventStore{}
+	l := &telemetryLogger{name: "bla", events: events}
+	l.Println("token is s3cr3t-token")
+
+	expect(t, "events", 1, len(events.events))
+	expect(t, "message", "token is <redacted>", events.events[0].Info.Message)
+}
@@ -13,23 +13,47 @@ import (
 type Timing struct {
 	start time.Time
 	nodes map[string]*timingNode
+	// host nodes by the name of their facts node
+	facts map[string]*timingNode
 
 	JobRuntime time.Duration
 	Hosts      map[*job.Host]*timingNode
 }
 
 // NewTiming generates a new Timing from the given config.
+//
+// Deprecated: The hosts of a config may change between two runs, so the
+// Timing may not match the hosts of a run. Use the Timing method of the
+// EventStore returned by Instrument instead.
 func NewTiming(c *job.Config) (*Timing, error) {
-	builder := newTimingBuilder()
-	_, err := job.VisitConfig(builder, c)
+	_, events, err := Instrument(c)
 	if err != nil {
 		return nil, err
 	}
+	return events.Timing(), nil
+}
+
+// newTiming generates a new Timing for the host nodes and facts nodes of an
+// execution tree.
+func newTiming(hosts, facts map[string]*job.Host) *Timing {
+	t := &Timing{
+		nodes: make(map[string]*timingNode),
+		facts: make(map[string]*timingNode),
+		Hosts: make(map[*job.Host]*timingNode),
+	}
+
+	for nodeName, host := range hosts {
+		node := &timingNode{}
+		t.nodes[nodeName] = node
+		t.Hosts[host] = node
+	}
 
-	return &Timing{
-		nodes: builder.(*NamingBuilder).NamedConfigBuilder.(*timingBuilder).nodes,
-		Hosts: builder.(*NamingBuilder).NamedConfigBuilder.(*timingBuilder).hosts,
-	}, nil
+	for nodeName, host := range facts {
+		if node, ok := t.Hosts[host]; ok {
+			t.facts[nodeName] = node
+		}
+	}
+	return t
 }
 
 // ApplyChan progressivly applies the job events sent
@@ -53,6 +77,13 @@ func (v *Timing) Apply(event Event) {
 		v.start = event.Timestamp
 	}
 
+	if event.Type == EventFacts {
+		if node, ok := v.facts[event.Name]; ok && event.Facts != nil {
+			node.Facts = *event.Facts
+		}
+		return
+	}
+
 	node, ok := v.nodes[event.Name]
 	if !ok {
 		return
@@ -64,6 +95,10 @@ func (v *Timing) Apply(event Event) {
 	case EventEnd:
 		fallthrough
 	case EventFailed:
+		fallthrough
+	case EventCancelled:
+		fallthrough
+	case EventTimeout:
 		node.Runtime = event.Timestamp.Sub(node.start)
 
 		if (v.start != time.Time{}) {
@@ -72,121 +107,9 @@ func (v *Timing) Apply(event Event) {
 	}
 }
 
-type noopGroup struct{}
-
-func (g *noopGroup) Append(children ...interface{}) {}
-func (g *noopGroup) Wrap() interface{}              { return nil }
-
 type timingNode struct {
 	start   time.Time
 	Runtime time.Duration
-}
-
-type timingBuilder struct {
-	nodes map[string]*timingNode
-	hosts map[*job.Host]*timingNode
-}
-
-func (t *timingBuilder) storeNode(nodeName string, host *job.Host) {
-	node := &timingNode{}
-	t.nodes[nodeName] = node
-	t.hosts[host] = node
-}
-
-func newTimingBuilder() job.ConfigBuilder {
-	return &NamingBuilder{
-		NamedConfigBuilder: &timingBuilder{
-			nodes: make(map[string]*timingNode),
-			hosts: make(map[*job.Host]*timingNode),
-		},
-	}
-}
-
-func (t *timingBuilder) Sequential(nodeName string) job.Group {
-	return &noopGroup{}
-}
-
-func (t *timingBuilder) Parallel(nodeName string) job.Group {
-	return &noopGroup{}
-}
-
-func (t *timingBuilder) Job(nodeName string, name string) job.Group {
-	return &noopGroup{}
-}
-
-func (t *timingBuilder) Output(nodeName string, o *job.Output) interface{} {
-	return nil
-}
-
-func (t *timingBuilder) JobLogger(nodeName string, jobName string) interface{} {
-	return nil
-}
-
-func (t *timingBuilder) HostLogger(nodeName string, jobName string, h *job.Host) interface{} {
-	return nil
-}
-
-func (t *timingBuilder) Timeout(nodeName string, timeout time.Duration) interface{} {
-	return nil
-}
-
-func (t *timingBuilder) SCP(nodeName string, scp *job.ScpData) interface{} {
-	return nil
-}
-
-func (t *timingBuilder) Hosts(nodeName string) job.Group {
-	return &noopGroup{}
-}
-
-func (t *timingBuilder) Host(nodeName string, c *job.Config, h *job.Host) job.Group {
-	t.storeNode(nodeName, h)
-	return &noopGroup{}
-}
-
-func (t *timingBuilder) ErrorSafeguard(nodeName string, child interface{}) interface{} {
-	return nil
-}
-
-func (t *timingBuilder) ContextBounds(nodeName string, child interface{}) interface{} {
-	return nil
-}
-
-func (t *timingBuilder) Retry(nodeName string, child interface{}, retries uint) interface{} {
-	return nil
-}
-
-func (t *timingBuilder) Templating(nodeName string, c *job.Config, h *job.Host) interface{} {
-	return nil
-}
-
-func (t *timingBuilder) SSHClient(nodeName string, host, user, keyFile, password string, keyboardInteractive map[string]string) interface{} {
-	return nil
-}
-
-func (t *timingBuilder) Forwarding(nodeName string, f *job.Forwarding) interface{} {
-	return nil
-}
-
-func (t *timingBuilder) Tunnel(nodeName string, f *job.Forwarding) interface{} {
-	return nil
-}
-
-func (t *timingBuilder) Commands(nodeName string, cmd *job.Command) job.Group {
-	return &noopGroup{}
-}
-
-func (t *timingBuilder) Command(nodeName string, cmd *job.Command) interface{} {
-	return nil
-}
-
-func (t *timingBuilder) LocalCommand(nodeName string, cmd *job.Command) interface{} {
-	return nil
-}
-
-func (t *timingBuilder) Stdout(nodeName string, o *job.Output) interface{} {
-	return nil
-}
-
-func (t *timingBuilder) Stderr(nodeName string, o *job.Output) interface{} {
-	return nil
+	// Facts of the host, if they have been gathered.
+	Facts job.Facts
 }
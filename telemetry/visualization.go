@@ -65,6 +65,10 @@ func (v *Visualization) Apply(event Event) {
 		node.Status = StateCompleted
 	case EventFailed:
 		node.Status = StateFailed
+	case EventCancelled:
+		node.Status = StateCancelled
+	case EventTimeout:
+		node.Status = StateTimeout
 	case EventLog:
 		info := event.Info
 		node.Append(job.Leaf(fmt.Sprintf("%s %s:%d: %s", event.Timestamp, info.File, info.Line, info.Message)))
@@ -91,6 +95,10 @@ const (
 	StateCompleted
 	// Execution failed.
 	StateFailed
+	// Execution has been cancelled.
+	StateCancelled
+	// Execution timed out.
+	StateTimeout
 )
 
 type visualizationNode struct {
@@ -124,6 +132,12 @@ func formatString(str string, status NodeStatus) string {
 	case StateFailed:
 		str = "✘ " + str
 		color = red
+	case StateCancelled:
+		str = "⊘ " + str
+		color = red
+	case StateTimeout:
+		str = "⧗ " + str
+		color = red
 	}
 
 	if color != nil {
@@ -240,15 +254,29 @@ func (t *stringBuilder) Retry(nodeName string, child interface{}, retries uint)
 	return nil
 }
 
-func (t *stringBuilder) Templating(nodeName string, c *job.Config, h *job.Host) interface{} {
-	if root := t.str.Templating(c, h); root != nil {
+func (t *stringBuilder) When(nodeName string, expr string, child interface{}) interface{} {
+	if root := t.str.When(expr, child); root != nil {
+		return t.storeNode(nodeName, &visualizationNode{Branch: root.(job.Branch)})
+	}
+	return nil
+}
+
+func (t *stringBuilder) Templating(nodeName string, c *job.Config, h *job.Host, hosts []*job.Host) interface{} {
+	if root := t.str.Templating(c, h, hosts); root != nil {
+		return t.storeNode(nodeName, &visualizationNode{Branch: &job.SimpleBranch{Root: root.(job.Leaf)}})
+	}
+	return nil
+}
+
+func (t *stringBuilder) SSHClient(nodeName string, h *job.Host) interface{} {
+	if root := t.str.SSHClient(h); root != nil {
 		return t.storeNode(nodeName, &visualizationNode{Branch: &job.SimpleBranch{Root: root.(job.Leaf)}})
 	}
 	return nil
 }
 
-func (t *stringBuilder) SSHClient(nodeName string, host, user, keyFile, password string, keyboardInteractive map[string]string) interface{} {
-	if root := t.str.SSHClient(host, user, keyFile, password, keyboardInteractive); root != nil {
+func (t *stringBuilder) Facts(nodeName string, h *job.Host) interface{} {
+	if root := t.str.Facts(h); root != nil {
 		return t.storeNode(nodeName, &visualizationNode{Branch: &job.SimpleBranch{Root: root.(job.Leaf)}})
 	}
 	return nil
@@ -30,8 +30,10 @@ func TestStringBuilder(t *testing.T) {
 	_ = builder.ErrorSafeguard(stringer).(*visualizationNode)
 	_ = builder.ContextBounds(stringer).(*visualizationNode)
 	_ = builder.Retry(stringer, 42).(*visualizationNode)
-	_ = builder.Templating(&job.Config{}, &job.Host{}).(*visualizationNode)
-	_ = builder.SSHClient("", "", "", "", nil).(*visualizationNode)
+	_ = builder.When("true", stringer).(*visualizationNode)
+	_ = builder.Templating(&job.Config{}, &job.Host{}, nil).(*visualizationNode)
+	_ = builder.SSHClient(&job.Host{}).(*visualizationNode)
+	_ = builder.Facts(&job.Host{}).(*visualizationNode)
 	_ = builder.Forwarding(&job.Forwarding{}).(*visualizationNode)
 	_ = builder.Tunnel(&job.Forwarding{}).(*visualizationNode)
 	_ = builder.Commands(&job.Command{}).(*visualizationNode)
@@ -73,6 +75,24 @@ func TestTimeout(t *testing.T) {
 	expect(t, "TestTimeout", want, got)
 }
 
+func TestTimeoutStatus(t *testing.T) {
+	tests := []struct {
+		status NodeStatus
+		want   string
+	}{
+		{StateFailed, red("✘ Timeout: 1m0s")},
+		{StateCancelled, red("⊘ Timeout: 1m0s")},
+		{StateTimeout, red("⧗ Timeout: 1m0s")},
+	}
+
+	builder := newStringBuilder()
+	for _, test := range tests {
+		node := builder.Timeout(time.Minute).(*visualizationNode)
+		node.Status = test.status
+		expect(t, "TestTimeoutStatus", test.want, node.String(&job.Vars{}))
+	}
+}
+
 func TestTree(t *testing.T) {
 	want :=
 		green("✔ Sequential") + "\n" +
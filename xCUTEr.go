@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net/http"
 	"os"
 	"sync/atomic"
 	"time"
@@ -22,21 +23,69 @@ type XCUTEr struct {
 	Start, Stop, Cancel func()
 	Done                <-chan struct{}
 	Inactive, Scheduled func() []*schedInfo
-	Running, Completed  func() []*runInfo
+	Queued, Running     func() []*runInfo
+	Completed           func() []*runInfo
 	MaxCompleted        func() uint32
 	SetMaxCompleted     func(uint32)
+	DAG                 func() (*job.DAG, error)
+	Jobs                func() []*JobStatus
+	// Lookup returns the job file of a job given by its job file, the base
+	// name of its job file or its name.
+	Lookup                              func(job string) (string, error)
+	Activate, Deactivate, Pause, Resume func(file string) error
+	// API is the HTTP API to control xCUTEr.
+	API http.Handler
+	// Drain stops starting new runs and waits up to grace for running runs,
+	// before cancelling them. It returns false, if runs had to be cancelled.
+	Drain func(grace time.Duration) bool
+	// Reload re-reads all job files. Running runs are not affected.
+	Reload func()
 }
 
 const (
 	outputKey = "output"
 )
 
-// New creates a new xCUTEr with the given config options.
-func New(jobDir string, sshTTL, sshKeepAlive time.Duration, file, logFile, telemetryEndpoint string, once, quiet bool) (*XCUTEr, error) {
+// Options configure an XCUTEr.
+type Options struct {
+	// JobDir is the directory to watch for job files.
+	JobDir string
+	// File is a single job file to execute instead of watching JobDir.
+	File string
+	// Once runs File only once, regardless of its schedule.
+	Once bool
+
+	// SSHTTL is the time until an unused SSH connection is closed,
+	// SSHKeepAlive the time between SSH keep-alive requests.
+	SSHTTL, SSHKeepAlive time.Duration
+
+	LogFile           string
+	Quiet             bool
+	TelemetryEndpoint string
+
+	// StateFile persists the state of jobs, e.g. the time of their last run,
+	// between restarts.
+	StateFile string
+	// If Manual is true, jobs picked up from JobDir are only scheduled after
+	// they have been activated.
+	Manual bool
+
+	// MaxJobs limits the number of jobs running at the same time, MaxSessions
+	// the number of concurrent sessions per host. Zero means unlimited.
+	MaxJobs, MaxSessions int
+
+	// Vars supplies run-time values for the variables of all jobs. With File,
+	// the job has to declare all of them. Otherwise each job only gets the
+	// values of the variables it declares.
+	Vars map[string]string
+}
+
+// New creates a new xCUTEr with the given options.
+func New(o Options) (*XCUTEr, error) {
 	log.SetFlags(log.Flags() | log.Lshortfile)
 
-	if logFile != "" && !quiet {
-		f, err := os.OpenFile(logFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if o.LogFile != "" && !o.Quiet {
+		f, err := os.OpenFile(o.LogFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
 		if err != nil {
 			log.Fatalln(err)
 		}
@@ -47,69 +96,203 @@ func New(jobDir string, sshTTL, sshKeepAlive time.Duration, file, logFile, telem
 
 	mainCtx, mainCancel := context.WithCancel(context.Background())
 
-	if quiet {
+	if o.Quiet {
 		log.SetOutput(ioutil.Discard)
 		mainCtx = context.WithValue(mainCtx, outputKey, ioutil.Discard)
 	}
 
-	job.InitializeSSHClientStore(sshTTL)
-	job.KeepAliveInterval = sshKeepAlive
+	job.InitializeSSHClientStore(o.SSHTTL)
+	job.KeepAliveInterval = o.SSHKeepAlive
+	job.MaxSessionsPerHost = o.MaxSessions
 
-	e, err := newExecutor(mainCtx, telemetryEndpoint)
+	e, err := newExecutor(mainCtx, o.TelemetryEndpoint)
 	if err != nil {
 		mainCancel()
 		return nil, err
 	}
+	e.vars = o.Vars
+	e.strictVars = o.File != ""
+	e.manualActive = o.Manual && o.File == ""
+	e.limits = newLimits(o.MaxJobs)
+
+	if e.state, err = loadState(o.StateFile); err != nil {
+		mainCancel()
+		return nil, err
+	}
 
 	e.Start()
 
+	reload := func() {}
+
 	// do we run only a single job file?
-	if file != "" {
-		j, err := e.parse(file)
+	if o.File != "" {
+		j, err := e.parse(o.File)
 		if err != nil {
-			err = fmt.Errorf("error parsing %s: %s", file, err)
+			err = fmt.Errorf("error parsing %s: %s", o.File, err)
 			mainCancel()
 			return nil, err
 		}
 		go func() {
-			e.Run(j, once)
-			if j.c.Schedule == "once" || once {
+			e.Run(j, o.Once)
+			if j.c.Schedule == "once" || o.Once {
 				defer mainCancel()
 			}
 		}()
+
+		if j.c.Schedule != "once" && !o.Once {
+			reload = func() {
+				j, err := e.parse(o.File)
+				if err != nil {
+					log.Println("error parsing", o.File, err)
+					return
+				}
+				if err := e.Reload(j); err != nil {
+					log.Println("error reloading", o.File, err)
+				}
+			}
+		}
 	} else {
 		fsEvents := make(chan fsnotify.Event)
 		w := &watcher{
-			path: jobDir,
+			path: o.JobDir,
 		}
 		go w.watch(mainCtx, fsEvents)
 
+		deps, err := newDependencyWatcher()
+		if err != nil {
+			mainCancel()
+			return nil, err
+		}
+		depEvents := make(chan string)
+		go deps.watch(mainCtx, depEvents)
+
+		// removeAbstract removes the job, if the job file became abstract,
+		// because abstract jobs are only used as base jobs.
+		removeAbstract := func(file string) {
+			log.Println(file, "is abstract, not scheduling it")
+			deps.remove(file)
+			e.Remove(file)
+		}
+
+		// add parses the job file and hands the job to addJob.
+		add := func(file string, addJob func(*jobInfo) error) {
+			j, err := e.parse(file)
+			if err == errAbstract {
+				removeAbstract(file)
+				return
+			}
+			if err != nil {
+				log.Println("error parsing", file, err)
+				return
+			}
+			deps.set(file, j.c.Dependencies())
+			if err := addJob(j); err != nil {
+				log.Println("error adding", file, err)
+			}
+		}
+
+		// only the jobs present on startup catch up on runs, that have
+		// been missed while xCUTEr was down
+		files, err := jobFiles(o.JobDir)
+		if err != nil {
+			mainCancel()
+			return nil, err
+		}
+		for _, file := range files {
+			add(file, e.Load)
+		}
+		for _, name := range e.undeclaredVars() {
+			log.Println("no job declares variable", name)
+		}
+
+		// reloadAll replaces every job with a freshly parsed one. Jobs
+		// that fail to parse keep running in their old version.
+		reloadAll := func() {
+			files, err := jobFiles(o.JobDir)
+			if err != nil {
+				log.Println("error reloading jobs:", err)
+				return
+			}
+
+			current := make(map[string]bool)
+			for _, file := range files {
+				current[file] = true
+			}
+			for _, file := range e.Files() {
+				if !current[file] {
+					deps.remove(file)
+					e.Remove(file)
+				}
+			}
+
+			for _, file := range files {
+				j, err := e.parse(file)
+				if err == errAbstract {
+					removeAbstract(file)
+					continue
+				}
+				if err != nil {
+					log.Println("error parsing", file, err)
+					continue
+				}
+				deps.set(file, j.c.Dependencies())
+				if err := e.Reload(j); err != nil {
+					log.Println("error reloading", file, err)
+				}
+			}
+		}
+
+		reloads := make(chan struct{})
+		reload = func() {
+			select {
+			case reloads <- struct{}{}:
+			case <-mainCtx.Done():
+			}
+		}
+
 		// main event loop
 		go func() {
 			for {
 				select {
 				case event := <-fsEvents:
 					if event.Op&fsnotify.Create == fsnotify.Create {
-						j, err := e.parse(event.Name)
-						if err != nil {
-							log.Println("error parsing", event.Name, err)
-							continue
-						}
-						e.Add(j)
+						add(event.Name, e.Add)
 					} else if event.Op&fsnotify.Remove == fsnotify.Remove {
+						deps.remove(event.Name)
 						e.Remove(event.Name)
 					} else if event.Op&fsnotify.Rename == fsnotify.Rename {
+						deps.remove(event.Name)
 						e.Remove(event.Name)
 					} else if event.Op&fsnotify.Write == fsnotify.Write {
 						e.Remove(event.Name)
-
-						j, err := e.parse(event.Name)
-						if err != nil {
-							log.Println("error parsing", event.Name, err)
-							continue
-						}
-						e.Add(j)
+						add(event.Name, e.Add)
+					}
+				case file := <-depEvents:
+					// hosts are resolved on every run anyway, so running
+					// runs go on and the job stays scheduled, if the hosts
+					// file is invalid for now
+					j, err := e.parse(file)
+					if err == errAbstract {
+						removeAbstract(file)
+						continue
+					}
+					if err != nil {
+						log.Println("error parsing", file, "keeping the current job:", err)
+						continue
+					}
+					deps.set(file, j.c.Dependencies())
+					if e.ranOnce(j) {
+						// there is no next run to pick up the change and
+						// reloading the job must not run it again
+						log.Println(j.c.Name, "already ran once, not reloading it")
+						continue
+					}
+					if err := e.Reload(j); err != nil {
+						log.Println("error reloading", file, err)
 					}
+				case <-reloads:
+					log.Println("reloading all jobs")
+					reloadAll()
 				case <-mainCtx.Done():
 					return
 				}
@@ -124,9 +307,20 @@ func New(jobDir string, sshTTL, sshKeepAlive time.Duration, file, logFile, telem
 		Stop:            e.Stop,
 		Inactive:        e.GetInactive,
 		Scheduled:       e.GetScheduled,
+		Queued:          e.GetQueued,
 		Running:         e.GetRunning,
 		Completed:       e.GetCompleted,
 		MaxCompleted:    func() uint32 { return e.maxCompleted },
 		SetMaxCompleted: func(max uint32) { atomic.StoreUint32(&e.maxCompleted, max) },
+		DAG:             e.DAG,
+		Jobs:            e.Jobs,
+		Lookup:          e.Lookup,
+		Activate:        e.Activate,
+		Deactivate:      e.Deactivate,
+		Pause:           e.Pause,
+		Resume:          e.Resume,
+		API:             newAPI(e),
+		Drain:           e.Drain,
+		Reload:          reload,
 	}, nil
 }